@@ -2,10 +2,10 @@ package cmd
 
 // This file is the single source of truth for the algorithm names jose can
 // actually use. The jwx library knows about more algorithms than jose can
-// drive (for example HPKE key encryption, the X448 curve, or the "none"
-// signature), so "jose jwa" must report only the subset jose accepts. These
-// lists are intersected with what jwx advertises so the output never contains
-// a value that another jose subcommand would reject.
+// drive (for example HPKE key encryption or the "none" signature), so
+// "jose jwa" must report only the subset jose accepts. These lists are
+// intersected with what jwx advertises so the output never contains a value
+// that another jose subcommand would reject.
 //
 // The lists must stay in sync with the validator tags on the jws/jwe/jwk
 // option structs; algorithm_test.go fails if they drift apart.
@@ -14,7 +14,7 @@ package cmd
 // and verify with. It matches the validator tags on jwsSigner and jwsVerifier.
 func supportedSignatureAlgorithms() []string {
 	return []string{
-		"ES256", "ES384", "ES512",
+		"ES256", "ES256K", "ES384", "ES512",
 		"EdDSA",
 		"HS256", "HS384", "HS512",
 		"PS256", "PS384", "PS512",
@@ -53,7 +53,7 @@ func supportedKeyTypes() []string {
 }
 
 // supportedEllipticCurves lists the curves jose can generate: the EC curves
-// plus the OKP curves. jwx also advertises X448, which jose cannot generate.
+// plus the OKP curves.
 func supportedEllipticCurves() []string {
 	curves := append([]string{}, availableCurves()...)
 	return append(curves, availableOKPCurves()...)
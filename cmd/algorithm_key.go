@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// This file checks, before any signing, verifying, encrypting or decrypting,
+// that a key can be used with the algorithm asked for. jwx reports a mismatch
+// late and vaguely ("failed to sign payload"), or not at all when the key is
+// merely too short; these checks name the exact mismatch instead.
+
+// minRSABits is the smallest RSA modulus jose signs, verifies or encrypts
+// with (RFC 7518 3.3 and 4.2).
+const minRSABits = 2048
+
+// hmacKeyBytes is the smallest HMAC key for each HS algorithm: a key of the
+// size of the hash output (RFC 7518 3.2).
+var hmacKeyBytes = map[string]int{"HS256": 32, "HS384": 48, "HS512": 64}
+
+// signatureCurves is the curve of each ECDSA algorithm.
+var signatureCurves = map[string]string{
+	"ES256": "P-256", "ES384": "P-384", "ES512": "P-521", algES256K: curveSecp256k1,
+}
+
+// wrapKeyBytes is the AES key size of each AES key wrap algorithm.
+var wrapKeyBytes = map[string]int{
+	"A128KW": 16, "A192KW": 24, "A256KW": 32,
+	"A128GCMKW": 16, "A192GCMKW": 24, "A256GCMKW": 32,
+}
+
+// contentKeyBytes is the key size of each content encryption algorithm, which
+// the key of "dir" must have (RFC 7518 5.2 and 5.3).
+var contentKeyBytes = map[string]int{
+	"A128CBC-HS256": 32, "A192CBC-HS384": 48, "A256CBC-HS512": 64,
+	"A128GCM": 16, "A192GCM": 24, "A256GCM": 32,
+}
+
+// checkSignatureKey reports why key cannot make or check a signature with the
+// JWS algorithm alg, or nil when it can.
+func checkSignatureKey(alg string, key jwk.Key) error {
+	kty := key.KeyType().String()
+	crv, _ := curveOf(key)
+	mismatch := func(want string) error {
+		return wrap(ErrKeyAlgorithmMismatch, fmt.Sprintf("%s needs %s, the key is %s", alg, want, describeKey(key)))
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "HS"):
+		if kty != jwa.OctetSeq().String() {
+			// A public key handed over as an HMAC secret is the algorithm
+			// confusion attack of RFC 8725 2.1.
+			return wrap(ErrKeyAlgorithmMismatch, fmt.Sprintf("%s needs an oct key, the key is %s (a public key used as an HMAC secret is algorithm confusion)", alg, describeKey(key)))
+		}
+		octets := octetsOf(key)
+		if kind := publicKeyMaterial(octets); kind != "" {
+			return wrap(ErrKeyAlgorithmMismatch, fmt.Sprintf("%s needs a secret, the oct key holds a %s public key (algorithm confusion)", alg, kind))
+		}
+		if len(octets) < hmacKeyBytes[alg] {
+			return mismatch(fmt.Sprintf("an oct key of at least %d bytes", hmacKeyBytes[alg]))
+		}
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		if kty != jwa.RSA().String() {
+			return mismatch("an RSA key")
+		}
+		if rsaBits(key) < minRSABits {
+			return mismatch(fmt.Sprintf("an RSA key of at least %d bits", minRSABits))
+		}
+	case alg == "EdDSA":
+		if !contains(signatureAlgorithmsFor(kty, crv), alg) {
+			return mismatch("an OKP key on Ed25519 or Ed448")
+		}
+	default:
+		if !contains(signatureAlgorithmsFor(kty, crv), alg) {
+			return mismatch("an EC key on " + signatureCurves[alg])
+		}
+	}
+	return nil
+}
+
+// checkEncryptionKey reports why key cannot wrap or unwrap a content key with
+// the JWE key encryption algorithm alg, or nil when it can. enc, the content
+// encryption, sets the size of a "dir" key; it is not checked when empty.
+func checkEncryptionKey(alg, enc string, key jwk.Key) error {
+	kty := key.KeyType().String()
+	crv, _ := curveOf(key)
+	mismatch := func(want string) error {
+		return wrap(ErrKeyAlgorithmMismatch, fmt.Sprintf("%s needs %s, the key is %s", alg, want, describeKey(key)))
+	}
+
+	switch {
+	case strings.HasPrefix(alg, "RSA"):
+		if kty != jwa.RSA().String() {
+			return mismatch("an RSA key")
+		}
+		if rsaBits(key) < minRSABits {
+			return mismatch(fmt.Sprintf("an RSA key of at least %d bits", minRSABits))
+		}
+	case strings.HasPrefix(alg, "ECDH-ES"):
+		if !encryptsWith(alg, kty, crv) {
+			return mismatch("an EC key on P-256, P-384 or P-521, or an OKP key on X25519 or X448")
+		}
+	case kty != jwa.OctetSeq().String():
+		return mismatch("an oct key")
+	case alg == "dir":
+		if size, ok := contentKeyBytes[enc]; ok && len(octetsOf(key)) != size {
+			return mismatch(fmt.Sprintf("an oct key of %d bytes for %s", size, enc))
+		}
+	case wrapKeyBytes[alg] != 0:
+		if size := wrapKeyBytes[alg]; len(octetsOf(key)) != size {
+			return mismatch(fmt.Sprintf("an oct key of %d bytes", size))
+		}
+	}
+	return nil
+}
+
+// describeKey names the type, curve or size of key for an error message:
+// "EC P-384", "RSA 1024-bit", "oct 16 bytes".
+func describeKey(key jwk.Key) string {
+	kty := key.KeyType().String()
+	switch kty {
+	case jwa.RSA().String():
+		return fmt.Sprintf("RSA %d-bit", rsaBits(key))
+	case jwa.OctetSeq().String():
+		return fmt.Sprintf("oct %d bytes", len(octetsOf(key)))
+	}
+	if crv, ok := curveOf(key); ok {
+		return kty + " " + crv
+	}
+	return kty
+}
+
+// rsaBits returns the size of the modulus of an RSA key.
+func rsaBits(key jwk.Key) int {
+	k, ok := key.(interface{ N() ([]byte, bool) })
+	if !ok {
+		return 0
+	}
+	n, _ := k.N()
+	return new(big.Int).SetBytes(n).BitLen()
+}
+
+// octetsOf returns the secret of an oct key.
+func octetsOf(key jwk.Key) []byte {
+	k, ok := key.(interface{ Octets() ([]byte, bool) })
+	if !ok {
+		return nil
+	}
+	octets, _ := k.Octets()
+	return octets
+}
+
+// publicKeyMaterial reports the encoding, "PEM", "DER" or "JWK", of a public
+// key held in the secret of an oct key, or "" when the secret is no such key.
+func publicKeyMaterial(octets []byte) string {
+	trimmed := bytes.TrimSpace(octets)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN ")):
+		return "PEM"
+	case isDERPublicKey(octets):
+		return "DER"
+	}
+	var k struct {
+		Kty string `json:"kty"`
+	}
+	if json.Unmarshal(trimmed, &k) == nil && k.Kty != "" && k.Kty != jwa.OctetSeq().String() {
+		return "JWK"
+	}
+	return ""
+}
+
+func isDERPublicKey(der []byte) bool {
+	if _, err := x509.ParsePKIXPublicKey(der); err == nil {
+		return true
+	}
+	if _, err := x509.ParsePKCS1PublicKey(der); err == nil {
+		return true
+	}
+	_, err := x509.ParseCertificate(der)
+	return err == nil
+}
+
+// checkVerificationKeys returns nil when some key of keyset can check a
+// signature made with alg, and otherwise the mismatch of every key.
+func checkVerificationKeys(alg string, keyset jwk.Set) error {
+	var reasons []string
+	for i, key := range keyset.All() {
+		err := checkSignatureKey(alg, key)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, fmt.Sprintf("key %d: %s", i, strings.TrimPrefix(err.Error(), ErrKeyAlgorithmMismatch.Error()+": ")))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return wrap(ErrKeyAlgorithmMismatch, strings.Join(reasons, "; "))
+}
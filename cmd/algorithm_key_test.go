@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+func octKey(t *testing.T, secret []byte) jwk.Key {
+	t.Helper()
+	key, err := jwk.Import[jwk.Key](secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestCheckSignatureKey(t *testing.T) {
+	t.Parallel()
+
+	ec256 := keyOf(t, genKey(t, "EC", "P-256", 0, "json", false))
+	ec384 := keyOf(t, genKey(t, "EC", "P-384", 0, "json", false))
+	rsa := keyOf(t, genKey(t, "RSA", "", 2048, "json", false))
+	ed := keyOf(t, genKey(t, "OKP", "Ed25519", 0, "json", false))
+	x25519 := keyOf(t, genKey(t, "OKP", "X25519", 0, "json", false))
+	oct := keyOf(t, genKey(t, "oct", "", 256, "json", false))
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		alg  string
+		key  jwk.Key
+		want string
+	}{
+		{alg: "ES256", key: ec256},
+		{alg: "RS256", key: rsa},
+		{alg: "PS512", key: rsa},
+		{alg: "EdDSA", key: ed},
+		{alg: "HS256", key: oct},
+		{alg: "ES256", key: ec384, want: "ES256 needs an EC key on P-256, the key is EC P-384"},
+		{alg: "ES384", key: rsa, want: "ES384 needs an EC key on P-384, the key is RSA 2048-bit"},
+		{alg: "RS256", key: ec256, want: "RS256 needs an RSA key, the key is EC P-256"},
+		{alg: "EdDSA", key: x25519, want: "EdDSA needs an OKP key on Ed25519 or Ed448, the key is OKP X25519"},
+		{alg: "HS384", key: oct, want: "HS384 needs an oct key of at least 48 bytes, the key is oct 32 bytes"},
+		{alg: "HS256", key: rsa, want: "HS256 needs an oct key, the key is RSA 2048-bit (a public key used as an HMAC secret is algorithm confusion)"},
+		{alg: "HS256", key: ec256, want: "algorithm confusion"},
+		{alg: "HS256", key: octKey(t, []byte("-----BEGIN PUBLIC KEY-----\nMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE\n-----END PUBLIC KEY-----\n")), want: "the oct key holds a PEM public key"},
+		{alg: "HS256", key: octKey(t, der), want: "the oct key holds a DER public key"},
+		{alg: "HS256", key: octKey(t, []byte(`{"kty":"RSA","n":"AQAB","e":"AQAB","padding":"to make it long enough"}`)), want: "the oct key holds a JWK public key"},
+	} {
+		err := checkSignatureKey(tt.alg, tt.key)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s with %s: %v", tt.alg, describeKey(tt.key), err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrKeyAlgorithmMismatch) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s with %s: want %q, got %v", tt.alg, describeKey(tt.key), tt.want, err)
+		}
+	}
+}
+
+func TestCheckEncryptionKey(t *testing.T) {
+	t.Parallel()
+
+	ec := keyOf(t, genKey(t, "EC", "P-256", 0, "json", false))
+	rsa := keyOf(t, genKey(t, "RSA", "", 2048, "json", false))
+	x25519 := keyOf(t, genKey(t, "OKP", "X25519", 0, "json", false))
+	oct16 := octKey(t, make([]byte, 16))
+	oct32 := octKey(t, make([]byte, 32))
+
+	for _, tt := range []struct {
+		alg, enc string
+		key      jwk.Key
+		want     string
+	}{
+		{alg: "RSA-OAEP", enc: "A128GCM", key: rsa},
+		{alg: "ECDH-ES", enc: "A256GCM", key: ec},
+		{alg: "ECDH-ES+A128KW", enc: "A256GCM", key: x25519},
+		{alg: "A128KW", enc: "A256GCM", key: oct16},
+		{alg: "dir", enc: "A128CBC-HS256", key: oct32},
+		{alg: "dir", key: oct16},
+		{alg: "PBES2-HS256+A128KW", enc: "A128GCM", key: oct16},
+		{alg: "RSA-OAEP-256", enc: "A128GCM", key: ec, want: "RSA-OAEP-256 needs an RSA key, the key is EC P-256"},
+		{alg: "ECDH-ES", enc: "A128GCM", key: rsa, want: "ECDH-ES needs an EC key on P-256, P-384 or P-521, or an OKP key on X25519 or X448, the key is RSA 2048-bit"},
+		{alg: "A256KW", enc: "A128GCM", key: oct16, want: "A256KW needs an oct key of 32 bytes, the key is oct 16 bytes"},
+		{alg: "A128GCMKW", enc: "A128GCM", key: ec, want: "A128GCMKW needs an oct key, the key is EC P-256"},
+		{alg: "dir", enc: "A256GCM", key: oct16, want: "dir needs an oct key of 32 bytes for A256GCM, the key is oct 16 bytes"},
+	} {
+		err := checkEncryptionKey(tt.alg, tt.enc, tt.key)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s/%s with %s: %v", tt.alg, tt.enc, describeKey(tt.key), err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrKeyAlgorithmMismatch) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s/%s with %s: want %q, got %v", tt.alg, tt.enc, describeKey(tt.key), tt.want, err)
+		}
+	}
+}
+
+func TestJWSVerifyNeedsOneFittingKey(t *testing.T) {
+	t.Parallel()
+
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	rsaPath := genKey(t, "RSA", "", 2048, "json", false)
+	payload := writeFile(t, "payload.txt", "fits")
+	message := writeFile(t, "token.jws", signWith(t, ecPath, "ES256", payload, ""))
+
+	// A set that holds one fitting key passes the check.
+	if err := checkVerificationKeys("ES256", keysOf(t, rsaPath, ecPath)); err != nil {
+		t.Errorf("set with an EC key: %v", err)
+	}
+
+	v := &jwsVerifier{Algorithm: "ES256", Key: rsaPath, KeyFormat: "json", InputFilePath: message, Output: "-"}
+	err := v.verify()
+	if !errors.Is(err, ErrKeyAlgorithmMismatch) || !strings.Contains(err.Error(), "key 0: ES256 needs an EC key on P-256, the key is RSA 2048-bit") {
+		t.Errorf("want the mismatch of key 0, got %v", err)
+	}
+}
+
+func TestJWSVerifySkipsKeysThatDoNotFit(t *testing.T) {
+	t.Parallel()
+
+	// An HS512 token made with a 32-byte key, which jose would not sign with.
+	weak, strong := octKey(t, []byte(strings.Repeat("w", 32))), octKey(t, []byte(strings.Repeat("s", 64)))
+	for _, key := range []jwk.Key{weak, strong} {
+		if err := key.Set(jwk.AlgorithmKey, "HS512"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := weak.Set(jwk.KeyIDKey, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := strong.Set(jwk.KeyIDKey, "k2"); err != nil {
+		t.Fatal(err)
+	}
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.KeyIDKey, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	message, err := jws.Sign([]byte("weak"), jws.WithKey(jwa.HS512(), weak, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed := jwk.NewSet()
+	for _, key := range []jwk.Key{strong, weak} {
+		if err := mixed.AddKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		v    *jwsVerifier
+		want error
+	}{
+		{"algorithm", &jwsVerifier{Algorithm: "HS512"}, ErrKeyAlgorithmMismatch},
+		{"match-kid", &jwsVerifier{MatchKeyID: true}, ErrKeyAlgorithmMismatch},
+		{"require any", &jwsVerifier{Algorithm: "HS512", Require: "any"}, ErrVerifyPolicy},
+		{"match-kid require any", &jwsVerifier{MatchKeyID: true, Require: "any"}, ErrVerifyPolicy},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			if err := tt.v.writeVerifyResult(&buf, message, mixed); !errors.Is(err, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+			if buf.Len() != 0 {
+				t.Errorf("payload written: %q", buf.String())
+			}
+		})
+	}
+
+	results, _, err := (&jwsVerifier{Algorithm: "HS512"}).verifySignatures(message, mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Verified || !errors.Is(results[0].Err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("result = %+v, want the mismatch of the weak key", results[0])
+	}
+	if c := (&jwsVerifier{MatchKeyID: true}).checkKey(message, "HS512", "k1", 1, weak); c.Verified || c.Signature != "not checked, HS512 needs an oct key of at least 64 bytes, the key is oct 32 bytes" {
+		t.Errorf("explain: signature %q, verified %v", c.Signature, c.Verified)
+	}
+}
+
+func TestJWEEncryptAndDecryptCheckTheKey(t *testing.T) {
+	t.Parallel()
+
+	payload := writeFile(t, "payload.txt", "secret")
+	e := &jweEncrypter{ContentEncryption: "A256GCM", Key: genKey(t, "oct", "", 256, "json", false), KeyEncryption: "A192KW", KeyFormat: "json", InputFilePath: payload, Output: "-"}
+	if err := e.encrypt(); !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("encrypt: want ErrKeyAlgorithmMismatch, got %v", err)
+	}
+
+	// Without --key-encryption the recipient's alg from the message is
+	// checked.
+	message := encryptWith(t, genKey(t, "EC", "P-256", 0, "json", false), "ECDH-ES", "A256GCM", payload, false)
+	_, err := decryptWith(t, genKey(t, "RSA", "", 2048, "json", false), message)
+	if !errors.Is(err, ErrKeyAlgorithmMismatch) || !strings.Contains(err.Error(), "ECDH-ES needs an EC key") {
+		t.Errorf("decrypt: want the ECDH-ES mismatch, got %v", err)
+	}
+}
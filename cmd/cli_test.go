@@ -25,9 +25,19 @@ func TestCLIJWKGenerateToStdout(t *testing.T) {
 }
 
 func TestCLIJWKGenerateInvalidCurve(t *testing.T) {
-	_, code := runCLI(t, "jwk", "generate", "--type", "OKP", "--curve", "X448")
+	_, code := runCLI(t, "jwk", "generate", "--type", "OKP", "--curve", "X999")
 	if code != 1 {
-		t.Errorf("expected failure for X448, exit code = %d", code)
+		t.Errorf("expected failure for X999, exit code = %d", code)
+	}
+}
+
+func TestCLIJWKGenerateSpecRejectsKeyFlags(t *testing.T) {
+	spec := writeFile(t, "keys.yaml", "keys:\n  - type: oct\n    size: 256\n    private: a.jwk\n")
+	if _, code := runCLI(t, "jwk", "generate", "--spec", spec, "--type", "RSA"); code != 1 {
+		t.Errorf("--spec with --type: exit code = %d", code)
+	}
+	if _, code := runCLI(t, "jwk", "generate", "--type", "RSA", "--force"); code != 1 {
+		t.Errorf("--force without --spec: exit code = %d", code)
 	}
 }
 
@@ -152,7 +152,7 @@ func TestGenerateECDSARejectsUnknownCurve(t *testing.T) {
 
 func TestGenerateOKPRejectsUnknownCurve(t *testing.T) {
 	t.Parallel()
-	g := &jwkGenerater{KeyType: "OKP", Curve: "Ed448"}
+	g := &jwkGenerater{KeyType: "OKP", Curve: "Ed999"}
 	if _, err := g.generateOKP(); !errors.Is(err, ErrInvalidCurve) {
 		t.Errorf("want ErrInvalidCurve, got %v", err)
 	}
@@ -186,8 +186,8 @@ func TestSignerReportsBadHeader(t *testing.T) {
 	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
 	payload := writeFile(t, "payload.json", `{"sub":"a"}`)
 	s := &jwsSigner{
-		Algorithm:     "ES256",
-		Key:           keyPath,
+		Algorithms:    []string{"ES256"},
+		Keys:          []string{keyPath},
 		KeyFormat:     "json",
 		Header:        "{not valid json",
 		InputFilePath: payload,
@@ -202,8 +202,8 @@ func TestSignerReportsMissingInput(t *testing.T) {
 	t.Parallel()
 	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
 	s := &jwsSigner{
-		Algorithm:     "ES256",
-		Key:           keyPath,
+		Algorithms:    []string{"ES256"},
+		Keys:          []string{keyPath},
 		KeyFormat:     "json",
 		InputFilePath: filepath.Join(t.TempDir(), "no-such-input.json"),
 		Output:        "-",
@@ -340,8 +340,8 @@ func TestSignerReportsMissingKeyFile(t *testing.T) {
 	t.Parallel()
 	payload := writeFile(t, "payload.json", `{"sub":"a"}`)
 	s := &jwsSigner{
-		Algorithm:     "ES256",
-		Key:           filepath.Join(t.TempDir(), "no-such-key.jwk"),
+		Algorithms:    []string{"ES256"},
+		Keys:          []string{filepath.Join(t.TempDir(), "no-such-key.jwk")},
 		KeyFormat:     "json",
 		InputFilePath: payload,
 		Output:        "-",
@@ -6,47 +6,108 @@ import (
 )
 
 var (
-	ErrNoOptions                = errors.New("no options specified")
-	ErrRequireFileName          = errors.New(`filename required (use "-" to read from stdin)`)
-	ErrOpenFile                 = errors.New("failed to open file")
-	ErrReadFile                 = errors.New("failed to read file")
-	ErrEllipticCurveType        = errors.New("elliptic curve type is 'P-256', 'P-384', 'P-521' (EC) or 'Ed25519', 'X25519' (OKP)")
-	ErrInvalidCurve             = errors.New("invalid elliptic curve")
-	ErrRequireCurve             = errors.New("EC and OKP keys require --curve")
-	ErrRequireKeyFile           = errors.New("key file required (you must specify --key option)")
-	ErrKeyType                  = errors.New("key type is one of 'RSA', 'EC', 'OKP', 'oct'")
-	ErrKeySize                  = errors.New("key size must be in bits, a multiple of 8 and at least 256 (default = 2048)")
-	ErrPemForOct                = errors.New("oct (symmetric) keys support only json output (do not use --output-format pem)")
-	ErrPublicKeyForOct          = errors.New("oct (symmetric) keys have no public key (do not use --public-key)")
-	ErrPemForX25519             = errors.New("OKP X25519 keys support only json output (do not use --output-format pem)")
-	ErrInvalidAlgorithm         = errors.New("signature algorithm is one of 'ES256' 'ES384' 'ES512' 'EdDSA' 'HS256' 'HS384' 'HS512' 'PS256' 'PS384' 'PS512' 'RS256' 'RS384' 'RS512'")
-	ErrUnsupportedShell         = errors.New("unsupported shell (supported: bash, zsh, fish)")
-	ErrInvalidKeyFormat         = errors.New("invalid output format (only support json or pem)")
-	ErrInvalidKeyEncryption     = errors.New("invalid key encryption; the supported key encryption can be checked with '$jose jwa -K'")
-	ErrInvalidContentEncryption = errors.New("content encryption is one of 'A128CBC-HS256', 'A128GCM', 'A192CBC-HS384', 'A192GCM', 'A256CBC-HS512', 'A256GCM'")
-	ErrFormatKeyInPem           = errors.New("failed to format key in PEM format")
-	ErrWriteKey                 = errors.New("failed to write key")
-	ErrEmptyKey                 = errors.New("key did not exist after key generation")
-	ErrEmptyAlogorithm          = errors.New("sign alogorithm is empty")
-	ErrNotContainKey            = errors.New("jwk file must contain exactly one key")
-	ErrParseKey                 = errors.New("failed to parse key")
-	ErrParseHeader              = errors.New("failed to parse header")
-	ErrParseMessage             = errors.New("failed to parse message")
-	ErrSignPayload              = errors.New("failed to sign payload")
-	ErrVerifyJWSMessage         = errors.New("failed to verify jws message")
-	ErrRetriveKey               = errors.New("failed to retrieve public key")
-	ErrSerializeJOSN            = errors.New("failed to serialize to JSON")
-	ErrWriteJSON                = errors.New("failed to write JSON")
-	ErrCreateFile               = errors.New("failed to create file")
-	ErrEncrypt                  = errors.New("failed to encrypt message")
-	ErrDecrypt                  = errors.New("failed to decrypt message")
-	ErrGenerateRSA              = errors.New("failed to generate RSA private key")
-	ErrGenertateECDSA           = errors.New("failed to generate ECDSA private key")
-	ErrGenerateEd25519          = errors.New("failed to generate ed25519 private key")
-	ErrGenerateX25519           = errors.New("failed to generate X25519 private key")
-	ErrGenerateOctetSeq         = errors.New("failed to generate octet sequence key")
-	ErrGeneratePublicKey        = errors.New("failed to generate public keys")
-	ErrGenerateJWKFromRawKey    = errors.New("failed to generate new JWK from raw key")
+	ErrNoOptions                  = errors.New("no options specified")
+	ErrRequireFileName            = errors.New(`filename required (use "-" to read from stdin)`)
+	ErrOpenFile                   = errors.New("failed to open file")
+	ErrReadFile                   = errors.New("failed to read file")
+	ErrInputTooLarge              = errors.New("input is larger than --max-input-size")
+	ErrInvalidMaxInputSize        = errors.New("--max-input-size takes a size such as 1048576, 512KiB, 64MiB or 2GB")
+	ErrEllipticCurveType          = errors.New("elliptic curve type is 'P-256', 'P-384', 'P-521', 'secp256k1' (EC) or 'Ed25519', 'X25519', 'Ed448', 'X448' (OKP)")
+	ErrInvalidCurve               = errors.New("invalid elliptic curve")
+	ErrRequireCurve               = errors.New("EC and OKP keys require --curve")
+	ErrRequireKeyFile             = errors.New("key file required (you must specify --key option)")
+	ErrKeyType                    = errors.New("key type is one of 'RSA', 'EC', 'OKP', 'oct'")
+	ErrKeySize                    = errors.New("key size must be in bits, a multiple of 8 and at least 256 (default = 2048)")
+	ErrPemForOct                  = errors.New("oct (symmetric) keys support only json output (do not use --output-format pem)")
+	ErrPublicKeyForOct            = errors.New("oct (symmetric) keys have no public key (do not use --public-key)")
+	ErrPemForX25519               = errors.New("OKP X25519 keys support only json output (do not use --output-format pem)")
+	ErrPemFor448                  = errors.New("OKP Ed448 and X448 keys support only json output (do not use --output-format pem)")
+	ErrPemForSecp256k1            = errors.New("EC secp256k1 keys support only json output (do not use --output-format pem)")
+	ErrInvalidAlgorithm           = errors.New("signature algorithm is one of 'ES256' 'ES256K' 'ES384' 'ES512' 'EdDSA' 'HS256' 'HS384' 'HS512' 'PS256' 'PS384' 'PS512' 'RS256' 'RS384' 'RS512'")
+	ErrUnsupportedShell           = errors.New("unsupported shell (supported: bash, zsh, fish)")
+	ErrInvalidKeyFormat           = errors.New("invalid key format (keys are read as json, pem, p12 or jks and written as json or pem)")
+	ErrInvalidKeyEncryption       = errors.New("invalid key encryption; the supported key encryption can be checked with '$jose jwa -K'")
+	ErrInvalidContentEncryption   = errors.New("content encryption is one of 'A128CBC-HS256', 'A128GCM', 'A192CBC-HS384', 'A192GCM', 'A256CBC-HS512', 'A256GCM'")
+	ErrFormatKeyInPem             = errors.New("failed to format key in PEM format")
+	ErrWriteKey                   = errors.New("failed to write key")
+	ErrEmptyKey                   = errors.New("key did not exist after key generation")
+	ErrEmptyAlogorithm            = errors.New("sign alogorithm is empty")
+	ErrNotContainKey              = errors.New("jwk file must contain exactly one key")
+	ErrParseKey                   = errors.New("failed to parse key")
+	ErrParseHeader                = errors.New("failed to parse header")
+	ErrAlgorithmFromKey           = errors.New("cannot take the algorithm from the key")
+	ErrHeaderAlgorithm            = errors.New("the header alg conflicts with the signature algorithm")
+	ErrKeyAlgorithmMismatch       = errors.New("the key does not fit the algorithm")
+	ErrAllowAlgConflict           = errors.New("--allow-alg cannot be combined with --algorithm or --match-kid")
+	ErrAlgorithmNotAllowed        = errors.New("the signature does not meet --allow-alg")
+	ErrCountersignDetached        = errors.New("a message with a detached payload cannot be countersigned")
+	ErrInvalidSetHeader           = errors.New("--set-header takes NAME=VALUE")
+	ErrParseMessage               = errors.New("failed to parse message")
+	ErrSignPayload                = errors.New("failed to sign payload")
+	ErrVerifyJWSMessage           = errors.New("failed to verify jws message")
+	ErrRetriveKey                 = errors.New("failed to retrieve public key")
+	ErrSerializeJOSN              = errors.New("failed to serialize to JSON")
+	ErrWriteJSON                  = errors.New("failed to write JSON")
+	ErrCreateFile                 = errors.New("failed to create file")
+	ErrEncrypt                    = errors.New("failed to encrypt message")
+	ErrDecrypt                    = errors.New("failed to decrypt message")
+	ErrGenerateRSA                = errors.New("failed to generate RSA private key")
+	ErrGenertateECDSA             = errors.New("failed to generate ECDSA private key")
+	ErrGenerateEd25519            = errors.New("failed to generate ed25519 private key")
+	ErrGenerateX25519             = errors.New("failed to generate X25519 private key")
+	ErrGenerateEd448              = errors.New("failed to generate ed448 private key")
+	ErrGenerateX448               = errors.New("failed to generate X448 private key")
+	ErrGenerateOctetSeq           = errors.New("failed to generate octet sequence key")
+	ErrGeneratePublicKey          = errors.New("failed to generate public keys")
+	ErrGenerateJWKFromRawKey      = errors.New("failed to generate new JWK from raw key")
+	ErrKeystoreNotFound           = errors.New("keystore does not exist (create it with 'jose keystore init')")
+	ErrKeystoreExists             = errors.New("keystore already exists (use --force to overwrite it)")
+	ErrKeystorePassword           = errors.New("keystore password required (set JOSE_KEYSTORE_PASSWORD or use --password-file)")
+	ErrOpenKeystore               = errors.New("failed to open keystore (wrong password or corrupted file)")
+	ErrSaveKeystore               = errors.New("failed to save keystore")
+	ErrKeystoreEntryName          = errors.New("keystore entry name is required and may contain only letters, digits, '.', '_' and '-'")
+	ErrKeystoreEntryExists        = errors.New("keystore entry already exists (use --force to replace it)")
+	ErrKeystoreEntryNotFound      = errors.New("keystore entry not found")
+	ErrParseCertificate           = errors.New("failed to parse certificate")
+	ErrRequireCertificate         = errors.New("p12 output needs a certificate (use --cert or a key with x5c)")
+	ErrCertificateKeyMismatch     = errors.New("the end-entity certificate does not belong to the key")
+	ErrEncodePKCS12               = errors.New("failed to encode PKCS#12 bundle")
+	ErrRequireAlias               = errors.New("keystore holds several entries (use --alias to pick one)")
+	ErrUnsupportedKeystoreEntry   = errors.New("unsupported keystore entry (only private key and trusted certificate entries can be read)")
+	ErrRequireListenAddress       = errors.New("listen address required (use --addr, e.g. ':8080')")
+	ErrInvalidJWKSPath            = errors.New("JWKS path must start with '/', hold no '{', '}' or spaces, and differ from /.well-known/openid-configuration")
+	ErrInvalidMaxAge              = errors.New("max-age must be zero or a positive number of seconds")
+	ErrInvalidIssuer              = errors.New("issuer must be an absolute URL (e.g. https://issuer.example)")
+	ErrSymmetricKeyInJWKS         = errors.New("oct (symmetric) keys cannot be published in a JWKS")
+	ErrServeJWKS                  = errors.New("failed to serve JWKS")
+	ErrPublicKeyForP12            = errors.New("p12 output holds a private key (do not use --public-key)")
+	ErrRequireSpecFile            = errors.New("spec file required (use --spec)")
+	ErrSpecWithKeyFlags           = errors.New("--spec takes the key definitions from the file and cannot be combined with key flags")
+	ErrForceWithoutSpec           = errors.New("--force only applies to --spec")
+	ErrInvalidKeySpec             = errors.New("invalid key spec")
+	ErrInvalidKeyUse              = errors.New("key use is one of 'sig', 'enc'")
+	ErrKeySpecOutput              = errors.New("each key needs a private key file; spec keys are written to files, not standard output")
+	ErrKeySpecAlgorithm           = errors.New("alg does not fit the key")
+	ErrKeySpecPEMMetadata         = errors.New("a PEM file cannot carry kid, alg or use (use format: json)")
+	ErrInvalidSerialization       = errors.New("serialization is one of 'compact', 'json', 'flattened'")
+	ErrUnprotectedHeaderInCompact = errors.New("compact JWS has no unprotected header (use --serialization json or flattened)")
+	ErrKeyAlgorithmPairs          = errors.New("give one --algorithm per --key, or omit --algorithm and use one JWK set whose keys carry alg")
+	ErrMultipleSignatures         = errors.New("several signatures need the general JSON serialization (use --serialization json)")
+	ErrInvalidRequire             = errors.New("require is 'any', 'all' or a positive number of signatures")
+	ErrVerifyPolicy               = errors.New("signatures do not meet the verification policy")
+	ErrRequireDetachedPayload     = errors.New("the message has a detached payload (use --payload to supply it)")
+	ErrPayloadAndMessageFromStdin = errors.New("the message and --payload cannot both be read from STDIN")
+	ErrInvalidHeaderURL           = errors.New("jku and x5u must be https URLs")
+	ErrEmbedSymmetricKey          = errors.New("a symmetric key cannot be embedded in the header (--embed-jwk)")
+	ErrInvalidPin                 = errors.New("pin is the base64url RFC 7638 SHA-256 thumbprint of a key")
+	ErrCriticalHeader             = errors.New("the crit header is not acceptable")
+	ErrInvalidUnderstoodCrit      = errors.New("--understood-crit takes header parameter names")
+	ErrHeaderExpectation          = errors.New("the protected header does not meet the expectation")
+	ErrInvalidExpectKid           = errors.New("--expect-kid takes key IDs")
+	ErrInvalidExpectHeader        = errors.New("--expect-header takes NAME=VALUE")
+	ErrInvalidJobs                = errors.New("--jobs must not be negative")
+	ErrBatchConflict              = errors.New("--batch cannot be combined with this flag")
+	ErrBatchVerify                = errors.New("some tokens of the batch failed verification")
 )
 
 // wrap return wrapping error with message.
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -52,6 +53,10 @@ func TestLooksLikeCompactJWS(t *testing.T) {
 		{name: "plain file name", in: "token.jws", want: false},
 		{name: "two dots but header not JSON", in: "abc.def.ghi", want: false},
 		{name: "empty header", in: ".payload.sig", want: false},
+		{name: "detached payload", in: "eyJhbGciOiJFUzI1NiJ9..YP7wVtRe3TxLFkeJ2ei83f67ZT5a", want: true},
+		{name: "no payload and no signature", in: "eyJhbGciOiJFUzI1NiJ9..", want: false},
+		{name: "unencoded payload", in: "eyJhbGciOiJFUzI1NiIsImI2NCI6ZmFsc2UsImNyaXQiOlsiYjY0Il19.pay $100, now.c-7tfVgu6pmA", want: true},
+		{name: "text payload without b64 false", in: "eyJhbGciOiJFUzI1NiJ9.pay $100, now.c-7tfVgu6pmA", want: false},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -67,7 +72,7 @@ func TestLooksLikeCompactJWS(t *testing.T) {
 func TestReadCompactJWSInlineToken(t *testing.T) {
 	t.Parallel()
 
-	got, err := readCompactJWS(sampleJWS)
+	got, err := readJWSMessage(sampleJWS)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -81,7 +86,7 @@ func TestReadCompactJWSMissingFileReportsOpenError(t *testing.T) {
 
 	// A typo that is not token-shaped must surface as a file-open error, not a
 	// parse error.
-	_, err := readCompactJWS("does-not-exist.jws")
+	_, err := readJWSMessage("does-not-exist.jws")
 	if !errors.Is(err, ErrOpenFile) {
 		t.Errorf("expected ErrOpenFile for a missing file, got %v", err)
 	}
@@ -91,7 +96,7 @@ func TestReadCompactJWSFromFile(t *testing.T) {
 	t.Parallel()
 
 	path := writeFile(t, "token.jws", sampleJWS)
-	got, err := readCompactJWS(path)
+	got, err := readJWSMessage(path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -103,7 +108,7 @@ func TestReadCompactJWSFromFile(t *testing.T) {
 func TestReadCompactJWSFromPipe(t *testing.T) {
 	withStdinPipe(t, sampleJWS)
 
-	got, err := readCompactJWS("")
+	got, err := readJWSMessage("")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -148,3 +153,65 @@ func TestReadInputReadsAll(t *testing.T) {
 		t.Errorf("readInput mismatch: %q", got)
 	}
 }
+
+// withMaxInputSize sets the --max-input-size limit until the test ends. Tests
+// that use it must not run in parallel.
+func withMaxInputSize(t *testing.T, size int64) {
+	t.Helper()
+	old := maxInputSize
+	maxInputSize = size
+	t.Cleanup(func() { maxInputSize = old })
+}
+
+func TestReadInputStopsAtMaxInputSize(t *testing.T) {
+	withMaxInputSize(t, 5)
+
+	if got, err := readInput(writeFile(t, "token.jws", "hello")); err != nil || string(got) != "hello" {
+		t.Errorf("at the limit: %q, %v", got, err)
+	}
+	if _, err := readInput(writeFile(t, "payload.txt", "hello!")); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("past the limit: want ErrInputTooLarge, got %v", err)
+	}
+
+	// The payload of jwe encrypt is read into memory, so the limit holds.
+	e := &jweEncrypter{
+		ContentEncryption: "A256GCM",
+		Key:               genKey(t, "oct", "", 256, "json", false),
+		KeyEncryption:     "A256KW",
+		KeyFormat:         "json",
+		InputFilePath:     writeFile(t, "payload.txt", "hello!"),
+		Output:            filepath.Join(t.TempDir(), "out.jwe"),
+	}
+	if err := e.encrypt(); !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("jwe encrypt: want ErrInputTooLarge, got %v", err)
+	}
+
+	withMaxInputSize(t, 0)
+	if got, err := readInput(writeFile(t, "payload.txt", "no limit")); err != nil || string(got) != "no limit" {
+		t.Errorf("no limit: %q, %v", got, err)
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]int64{
+		"0":       0,
+		"1048576": 1 << 20,
+		"512KiB":  512 << 10,
+		"64MiB":   64 << 20,
+		"64m":     64 << 20,
+		"2GB":     2_000_000_000,
+		" 10 kb ": 10_000,
+		"1TiB":    1 << 40,
+	} {
+		if got, err := parseByteSize(in); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "MiB", "-1", "1.5GB", "10 bytes", "99999999999TiB"} {
+		if _, err := parseByteSize(in); !errors.Is(err, ErrInvalidMaxInputSize) {
+			t.Errorf("parseByteSize(%q): want ErrInvalidMaxInputSize, got %v", in, err)
+		}
+	}
+}
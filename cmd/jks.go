@@ -0,0 +1,381 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"  //nolint:gosec // JCEKS protects keys with Triple DES; jose only reads it
+	"crypto/md5"  //nolint:gosec // JCEKS derives its key with MD5; jose only reads it
+	"crypto/sha1" //nolint:gosec // JKS uses SHA-1 for its key protector and integrity check
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// This file is a read-only decoder for Java keystores: the original Sun JKS
+// format and its JCEKS variant. Both share one container layout and differ
+// in how a private key entry is protected. jose reads private key entries
+// and trusted certificate entries; JCEKS secret key entries are Java
+// serialized objects, which are skipped (jks_serial.go) but not supported.
+
+const (
+	jksMagic          = 0xfeedfeed
+	jceksMagic        = 0xcececece
+	jksPrivateKeyTag  = 1
+	jksTrustedCertTag = 2
+	jksSecretKeyTag   = 3
+	// jksIntegrityWhitener is mixed into the integrity digest by
+	// sun.security.provider.JavaKeyStore.
+	jksIntegrityWhitener = "Mighty Aphrodite"
+)
+
+var (
+	oidJKSKeyProtector   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+	oidJCEKSKeyProtector = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 19, 1}
+)
+
+// encryptedPrivateKeyInfo is the PKCS#8 EncryptedPrivateKeyInfo structure
+// that wraps a protected private key entry.
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbeParameter is the PKCS#5 PBEParameter of a JCEKS protected key.
+type pbeParameter struct {
+	Salt       []byte
+	Iterations int
+}
+
+// jksEntry is a private key or trusted certificate entry of a keystore. err
+// is why an entry jose stepped over cannot be used.
+type jksEntry struct {
+	alias        string
+	protectedKey []byte
+	chain        []*x509.Certificate
+	err          error
+}
+
+// parseJKS reads the entry called alias from a JKS or JCEKS keystore into a
+// key set. A private key entry yields the private key with its certificate
+// chain as "x5c"; a trusted certificate entry yields the certificate's public
+// key. alias may be empty when the keystore holds a single entry.
+// storePassword checks the keystore integrity and entryPassword unlocks a
+// private key; an empty entryPassword falls back to storePassword, which is
+// how keytool creates entries by default.
+func parseJKS(data []byte, storePassword, entryPassword, alias string) (jwk.Set, error) {
+	entry, err := findJKSEntry(data, storePassword, alias)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.protectedKey == nil {
+		// Trusted certificate entry.
+		key, err := importWithChain(entry.chain[0].PublicKey, entry.chain)
+		if err != nil {
+			return nil, err
+		}
+		return keySetOf(key)
+	}
+
+	if entryPassword == "" {
+		entryPassword = storePassword
+	}
+	der, err := unprotectJKSKey(entry.protectedKey, entryPassword)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	key, err := importWithChain(priv, entry.chain)
+	if err != nil {
+		return nil, err
+	}
+	return keySetOf(key)
+}
+
+// findJKSEntry walks the keystore and returns the entry called alias. Java
+// stores JKS aliases in lower case, so the comparison ignores case. Entries
+// jose cannot use, such as JCEKS secret keys, are skipped unless they are the
+// one asked for.
+func findJKSEntry(data []byte, storePassword, alias string) (*jksEntry, error) {
+	if len(data) < 12+sha1.Size {
+		return nil, wrap(ErrParseKey, "keystore is truncated")
+	}
+	body := data[:len(data)-sha1.Size]
+	if storePassword != "" {
+		if !bytes.Equal(jksIntegrityDigest(body, storePassword), data[len(body):]) {
+			return nil, wrap(ErrParseKey, "keystore password is incorrect or the keystore was tampered with")
+		}
+	}
+
+	r := &jksReader{data: body}
+	magic := r.uint32()
+	version := r.uint32()
+	count := r.uint32()
+	if r.err != nil {
+		return nil, wrap(ErrParseKey, r.err.Error())
+	}
+	if magic != jksMagic && magic != jceksMagic {
+		return nil, wrap(ErrParseKey, "not a JKS or JCEKS keystore")
+	}
+	if version != 1 && version != 2 {
+		return nil, wrap(ErrParseKey, fmt.Sprintf("unsupported keystore version %d", version))
+	}
+	if alias == "" && count != 1 {
+		return nil, wrap(ErrRequireAlias, fmt.Sprintf("keystore holds %d entries", count))
+	}
+
+	for range count {
+		tag := r.uint32()
+		entry := &jksEntry{alias: r.utf()}
+		_ = r.uint64() // creation time in milliseconds
+
+		switch tag {
+		case jksPrivateKeyTag:
+			entry.protectedKey = r.bytes()
+			for n := r.uint32(); n > 0 && r.err == nil; n-- {
+				c, err := r.certificate(version)
+				entry.chain = append(entry.chain, c)
+				entry.err = errors.Join(entry.err, err)
+			}
+		case jksTrustedCertTag:
+			c, err := r.certificate(version)
+			entry.chain, entry.err = []*x509.Certificate{c}, err
+		case jksSecretKeyTag:
+			r.skipJavaObject()
+			entry.err = wrap(ErrUnsupportedKeystoreEntry, fmt.Sprintf("%q is a secret key entry", entry.alias))
+		default:
+			if r.err == nil {
+				return nil, wrap(ErrParseKey, fmt.Sprintf("unknown keystore entry tag %d", tag))
+			}
+		}
+		if r.err != nil {
+			return nil, wrap(ErrParseKey, r.err.Error())
+		}
+		if alias == "" || strings.EqualFold(entry.alias, alias) {
+			if entry.err != nil {
+				return nil, entry.err
+			}
+			return entry, nil
+		}
+	}
+	return nil, wrap(ErrKeystoreEntryNotFound, "alias "+alias)
+}
+
+// jksIntegrityDigest computes the keyed SHA-1 digest that ends a JKS or JCEKS
+// keystore.
+func jksIntegrityDigest(body []byte, password string) []byte {
+	h := sha1.New() //nolint:gosec // mandated by the JKS format
+	h.Write(utf16BE(password))
+	h.Write([]byte(jksIntegrityWhitener))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// unprotectJKSKey decrypts a protected private key entry to its PKCS#8 DER
+// encoding.
+func unprotectJKSKey(protected []byte, password string) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(protected, &info); err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+
+	switch {
+	case info.Algorithm.Algorithm.Equal(oidJKSKeyProtector):
+		return jksKeyProtectorDecrypt(info.EncryptedData, password)
+	case info.Algorithm.Algorithm.Equal(oidJCEKSKeyProtector):
+		var params pbeParameter
+		if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, wrap(ErrParseKey, err.Error())
+		}
+		return jceksKeyProtectorDecrypt(info.EncryptedData, password, params)
+	default:
+		return nil, wrap(ErrParseKey, "unsupported key protection algorithm "+info.Algorithm.Algorithm.String())
+	}
+}
+
+// jksKeyProtectorDecrypt reverses sun.security.provider.KeyProtector: the key
+// is XORed with a SHA-1 keystream seeded by a salt, and followed by a SHA-1
+// check value over the password and the plain key.
+func jksKeyProtectorDecrypt(data []byte, password string) ([]byte, error) {
+	if len(data) < 2*sha1.Size {
+		return nil, wrap(ErrParseKey, "protected key is truncated")
+	}
+	passwd := utf16BE(password)
+	salt := data[:sha1.Size]
+	encrypted := data[sha1.Size : len(data)-sha1.Size]
+	check := data[len(data)-sha1.Size:]
+
+	plain := make([]byte, len(encrypted))
+	digest := salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		h := sha1.New() //nolint:gosec // mandated by the JKS format
+		h.Write(passwd)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		subtle.XORBytes(plain[i:], encrypted[i:], digest)
+	}
+
+	h := sha1.New() //nolint:gosec // mandated by the JKS format
+	h.Write(passwd)
+	h.Write(plain)
+	if !bytes.Equal(h.Sum(nil), check) {
+		return nil, wrap(ErrParseKey, "keystore entry password is incorrect")
+	}
+	return plain, nil
+}
+
+// jceksKeyProtectorDecrypt reverses Sun's PBEWithMD5AndTripleDES: two MD5
+// chains over the salt halves and the password yield a 24 byte Triple DES
+// key and an 8 byte IV for CBC decryption.
+func jceksKeyProtectorDecrypt(data []byte, password string, params pbeParameter) ([]byte, error) {
+	if len(params.Salt) != 8 || params.Iterations <= 0 {
+		return nil, wrap(ErrParseKey, "invalid PBE parameters")
+	}
+	if len(data) == 0 || len(data)%des.BlockSize != 0 {
+		return nil, wrap(ErrParseKey, "protected key is not a whole number of blocks")
+	}
+
+	derived := jceksDeriveKey(password, params)
+	c, err := des.NewTripleDESCipher(derived[:24])
+	if err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(c, derived[24:]).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > des.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, wrap(ErrParseKey, "keystore entry password is incorrect")
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// jceksDeriveKey derives the 24 byte Triple DES key followed by the 8 byte IV
+// of PBEWithMD5AndTripleDES.
+func jceksDeriveKey(password string, params pbeParameter) []byte {
+	units := utf16.Encode([]rune(password))
+	passwd := make([]byte, len(units))
+	for i, u := range units {
+		passwd[i] = byte(u & 0x7f)
+	}
+	salt := bytes.Clone(params.Salt)
+	if bytes.Equal(salt[:4], salt[4:]) {
+		// Sun "inverts" the first half when both halves are equal, but its
+		// loop assigns salt[3-1] instead of salt[3-i]; keep the quirk.
+		for i := range 2 {
+			tmp := salt[i]
+			salt[i] = salt[3-i]
+			salt[2] = tmp
+		}
+	}
+
+	derived := make([]byte, 0, 2*md5.Size)
+	for i := range 2 {
+		block := salt[i*4 : (i+1)*4]
+		for range params.Iterations {
+			h := md5.New() //nolint:gosec // mandated by the JCEKS format
+			h.Write(block)
+			h.Write(passwd)
+			block = h.Sum(nil)
+		}
+		derived = append(derived, block...)
+	}
+	return derived
+}
+
+// utf16BE encodes s the way Java turns a char[] password into bytes for the
+// JKS digests.
+func utf16BE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		b = binary.BigEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// jksReader reads the big-endian primitives of a Java DataInputStream. The
+// first error sticks, so a caller can check it once after a run of reads.
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+var errJKSTruncated = errors.New("keystore is truncated")
+
+func (r *jksReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data) {
+		r.err = errJKSTruncated
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *jksReader) uint64() uint64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+// utf reads a DataInput.readUTF string. Java's modified UTF-8 matches UTF-8
+// for the aliases and type names found in keystores.
+func (r *jksReader) utf() string {
+	b := r.next(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.next(int(binary.BigEndian.Uint16(b))))
+}
+
+// bytes reads a length-prefixed byte string.
+func (r *jksReader) bytes() []byte {
+	return r.next(int(r.uint32()))
+}
+
+// certificate reads one certificate. Version 2 keystores name the
+// certificate type before the encoding. A certificate jose cannot decode is
+// reported in the error, with r still in step for the next entry.
+func (r *jksReader) certificate(version uint32) (*x509.Certificate, error) {
+	typ := "X.509"
+	if version == 2 {
+		typ = r.utf()
+	}
+	der := r.bytes()
+	if r.err != nil {
+		return nil, nil
+	}
+	if typ != "X.509" {
+		return nil, wrap(ErrUnsupportedKeystoreEntry, fmt.Sprintf("certificate type %q", typ))
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	return c, nil
+}
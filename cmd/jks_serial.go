@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// JCEKS stores a secret key entry as a Java serialized object
+// (javax.crypto.SealedObject) with no length in front of it. jose cannot use
+// such an entry, but it has to step over one to reach the entries after it,
+// so this file walks the Java Object Serialization Stream Protocol far enough
+// to know where an object ends. Nothing it reads is kept.
+
+// Stream constants of java.io.ObjectStreamConstants.
+const (
+	javaStreamMagic   = 0xaced
+	javaStreamVersion = 5
+	javaBaseHandle    = 0x7e0000
+
+	tcNull           = 0x70
+	tcReference      = 0x71
+	tcClassDesc      = 0x72
+	tcObject         = 0x73
+	tcString         = 0x74
+	tcArray          = 0x75
+	tcClass          = 0x76
+	tcBlockData      = 0x77
+	tcEndBlockData   = 0x78
+	tcReset          = 0x79
+	tcBlockDataLong  = 0x7a
+	tcLongString     = 0x7c
+	tcProxyClassDesc = 0x7d
+	tcEnum           = 0x7e
+
+	scWriteMethod    = 0x01
+	scSerializable   = 0x02
+	scExternalizable = 0x04
+	scBlockData      = 0x08
+)
+
+// javaMaxDepth bounds the nesting of objects in a serialized entry, so a
+// hostile keystore cannot exhaust the stack.
+const javaMaxDepth = 64
+
+var errJavaEndBlock = errors.New("end of block data")
+
+// javaClassDesc is what skipping needs of a class descriptor: how its
+// instances are written.
+type javaClassDesc struct {
+	name   string
+	flags  byte
+	fields []byte // type codes, in stream order
+	super  *javaClassDesc
+}
+
+// javaStream skips the content of one object stream.
+type javaStream struct {
+	r       *jksReader
+	handles []any
+	depth   int
+}
+
+// skipJavaObject steps over one serialized object, stream header included.
+func (r *jksReader) skipJavaObject() {
+	header := r.next(4)
+	if header == nil {
+		return
+	}
+	if binary.BigEndian.Uint16(header) != javaStreamMagic || binary.BigEndian.Uint16(header[2:]) != javaStreamVersion {
+		r.err = errors.New("secret key entry is not a Java serialized object")
+		return
+	}
+	s := &javaStream{r: r}
+	if _, err := s.content(); err != nil && r.err == nil {
+		r.err = err
+	}
+}
+
+func (s *javaStream) byte() byte {
+	b := s.r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (s *javaStream) uint16() uint16 {
+	b := s.r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (s *javaStream) newHandle(v any) {
+	s.handles = append(s.handles, v)
+}
+
+// content reads one content element and returns the class descriptor it
+// defines or refers to, if any.
+func (s *javaStream) content() (*javaClassDesc, error) {
+	if s.depth++; s.depth > javaMaxDepth {
+		return nil, errors.New("secret key entry nests too deep")
+	}
+	defer func() { s.depth-- }()
+
+	tag := s.byte()
+	if s.r.err != nil {
+		return nil, s.r.err
+	}
+	switch tag {
+	case tcNull:
+		return nil, nil
+	case tcReference:
+		h := int(s.r.uint32()) - javaBaseHandle
+		if s.r.err != nil || h < 0 || h >= len(s.handles) {
+			return nil, errors.New("secret key entry refers to an unknown object")
+		}
+		desc, _ := s.handles[h].(*javaClassDesc)
+		return desc, nil
+	case tcClassDesc:
+		return s.classDesc()
+	case tcProxyClassDesc:
+		desc := &javaClassDesc{flags: scSerializable}
+		s.newHandle(desc)
+		for n := s.r.uint32(); n > 0 && s.r.err == nil; n-- {
+			_ = s.r.utf()
+		}
+		if err := s.skipAnnotation(); err != nil {
+			return nil, err
+		}
+		super, err := s.content()
+		desc.super = super
+		return desc, err
+	case tcObject:
+		desc, err := s.content()
+		if err != nil {
+			return nil, err
+		}
+		s.newHandle(nil)
+		return nil, s.classData(desc)
+	case tcString:
+		_ = s.r.utf()
+		s.newHandle(nil)
+	case tcLongString:
+		_ = s.r.next(int(s.r.uint64()))
+		s.newHandle(nil)
+	case tcArray:
+		desc, err := s.content()
+		if err != nil {
+			return nil, err
+		}
+		if desc == nil || len(desc.name) < 2 {
+			return nil, errors.New("secret key entry holds an array of no class")
+		}
+		s.newHandle(nil)
+		for n := s.r.uint32(); n > 0 && s.r.err == nil; n-- {
+			if err := s.value(desc.name[1]); err != nil {
+				return nil, err
+			}
+		}
+	case tcClass:
+		if _, err := s.content(); err != nil {
+			return nil, err
+		}
+		s.newHandle(nil)
+	case tcEnum:
+		if _, err := s.content(); err != nil {
+			return nil, err
+		}
+		s.newHandle(nil)
+		if _, err := s.content(); err != nil {
+			return nil, err
+		}
+	case tcBlockData:
+		_ = s.r.next(int(s.byte()))
+	case tcBlockDataLong:
+		_ = s.r.next(int(s.r.uint32()))
+	case tcEndBlockData:
+		return nil, errJavaEndBlock
+	case tcReset:
+		s.handles = nil
+	default:
+		return nil, fmt.Errorf("secret key entry has unknown serialization tag 0x%02x", tag)
+	}
+	return nil, s.r.err
+}
+
+// classDesc reads the body of a TC_CLASSDESC.
+func (s *javaStream) classDesc() (*javaClassDesc, error) {
+	desc := &javaClassDesc{name: s.r.utf()}
+	_ = s.r.uint64() // serialVersionUID
+	s.newHandle(desc)
+	desc.flags = s.byte()
+	for n := s.uint16(); n > 0 && s.r.err == nil; n-- {
+		typ := s.byte()
+		_ = s.r.utf()
+		if typ == 'L' || typ == '[' {
+			// The field's class name, a string or a reference to one.
+			if _, err := s.content(); err != nil {
+				return nil, err
+			}
+		}
+		desc.fields = append(desc.fields, typ)
+	}
+	if err := s.skipAnnotation(); err != nil {
+		return nil, err
+	}
+	super, err := s.content()
+	desc.super = super
+	return desc, err
+}
+
+// skipAnnotation skips contents up to the TC_ENDBLOCKDATA that ends a class
+// annotation or the data written by writeObject.
+func (s *javaStream) skipAnnotation() error {
+	for {
+		_, err := s.content()
+		if errors.Is(err, errJavaEndBlock) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// classData skips the fields of an object of class desc, superclass first.
+func (s *javaStream) classData(desc *javaClassDesc) error {
+	var chain []*javaClassDesc
+	for d := desc; d != nil; d = d.super {
+		chain = append([]*javaClassDesc{d}, chain...)
+	}
+	for _, d := range chain {
+		switch {
+		case d.flags&scExternalizable != 0:
+			if d.flags&scBlockData == 0 {
+				return fmt.Errorf("secret key entry holds %s in the old externalizable format", d.name)
+			}
+			if err := s.skipAnnotation(); err != nil {
+				return err
+			}
+		case d.flags&scSerializable != 0:
+			for _, typ := range d.fields {
+				if err := s.value(typ); err != nil {
+					return err
+				}
+			}
+			if d.flags&scWriteMethod != 0 {
+				if err := s.skipAnnotation(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return s.r.err
+}
+
+// value skips one field or array element of the given type code.
+func (s *javaStream) value(typ byte) error {
+	switch typ {
+	case 'B', 'Z':
+		_ = s.r.next(1)
+	case 'C', 'S':
+		_ = s.r.next(2)
+	case 'I', 'F':
+		_ = s.r.next(4)
+	case 'J', 'D':
+		_ = s.r.next(8)
+	case 'L', '[':
+		if _, err := s.content(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("secret key entry has unknown field type %q", typ)
+	}
+	return s.r.err
+}
@@ -0,0 +1,511 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"crypto/des" //nolint:gosec // the test builds JCEKS entries
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // the test builds JKS entries
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// testJKSEntry is one entry written by buildJKS. A nil protectedKey makes a
+// trusted certificate entry; secret makes a JCEKS secret key entry.
+type testJKSEntry struct {
+	alias        string
+	protectedKey []byte
+	chain        []*x509.Certificate
+	secret       bool
+}
+
+// buildJKS writes a version 2 keystore in the layout of Java's JKS and JCEKS
+// implementations.
+func buildJKS(t *testing.T, magic uint32, password string, entries ...testJKSEntry) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	u32 := func(v uint32) { _ = binary.Write(&b, binary.BigEndian, v) }
+	utf := func(s string) {
+		_ = binary.Write(&b, binary.BigEndian, uint16(len(s)))
+		b.WriteString(s)
+	}
+	blob := func(p []byte) {
+		u32(uint32(len(p)))
+		b.Write(p)
+	}
+	certs := func(chain []*x509.Certificate) {
+		for _, c := range chain {
+			utf("X.509")
+			blob(c.Raw)
+		}
+	}
+
+	u32(magic)
+	u32(2)
+	u32(uint32(len(entries)))
+	for _, e := range entries {
+		switch {
+		case e.secret:
+			u32(jksSecretKeyTag)
+		case e.protectedKey == nil:
+			u32(jksTrustedCertTag)
+		default:
+			u32(jksPrivateKeyTag)
+		}
+		utf(e.alias)
+		_ = binary.Write(&b, binary.BigEndian, uint64(0))
+		switch {
+		case e.secret:
+			b.Write(sealedKeyObject())
+		case e.protectedKey == nil:
+			certs(e.chain)
+		default:
+			blob(e.protectedKey)
+			u32(uint32(len(e.chain)))
+			certs(e.chain)
+		}
+	}
+	b.Write(jksIntegrityDigest(b.Bytes(), password))
+	return b.Bytes()
+}
+
+// sealedKeyObject returns the Java serialization of a
+// com.sun.crypto.provider.SealedObjectForKeyProtector, as JCEKS writes a
+// secret key entry. Handles are numbered in stream order from 0x7e0000.
+func sealedKeyObject() []byte {
+	var b bytes.Buffer
+	w := func(v any) { _ = binary.Write(&b, binary.BigEndian, v) }
+	utf := func(s string) {
+		w(uint16(len(s)))
+		b.WriteString(s)
+	}
+	classDesc := func(name string, fields func()) {
+		b.WriteByte(tcClassDesc)
+		utf(name)
+		w(uint64(0x1234))
+		b.WriteByte(scSerializable)
+		fields()
+		b.WriteByte(tcEndBlockData)
+	}
+
+	w(uint16(javaStreamMagic))
+	w(uint16(javaStreamVersion))
+	b.WriteByte(tcObject)
+	classDesc("com.sun.crypto.provider.SealedObjectForKeyProtector", func() { w(uint16(0)) }) // 0
+	classDesc("javax.crypto.SealedObject", func() {                                           // 1
+		w(uint16(4))
+		b.WriteByte('[')
+		utf("encodedParams")
+		b.WriteByte(tcString)
+		utf("[B") // 2
+		b.WriteByte('[')
+		utf("encryptedContent")
+		b.WriteByte(tcReference)
+		w(uint32(javaBaseHandle + 2))
+		b.WriteByte('L')
+		utf("paramsAlg")
+		b.WriteByte(tcString)
+		utf("Ljava/lang/String;") // 3
+		b.WriteByte('L')
+		utf("sealAlg")
+		b.WriteByte(tcReference)
+		w(uint32(javaBaseHandle + 3))
+	})
+	b.WriteByte(tcNull) // no superclass; the object is 4
+
+	b.WriteByte(tcArray)
+	classDesc("[B", func() { w(uint16(0)) }) // 5
+	b.WriteByte(tcNull)
+	w(uint32(3)) // the array is 6
+	b.Write([]byte{0x30, 0x01, 0x00})
+	b.WriteByte(tcArray)
+	b.WriteByte(tcReference)
+	w(uint32(javaBaseHandle + 5))
+	w(uint32(16)) // 7
+	b.Write(make([]byte, 16))
+	b.WriteByte(tcString)
+	utf("PBEWithMD5AndTripleDES") // 8
+	b.WriteByte(tcReference)
+	w(uint32(javaBaseHandle + 8))
+	return b.Bytes()
+}
+
+// protectJKS wraps priv the way sun.security.provider.KeyProtector does.
+func protectJKS(t *testing.T, priv crypto.PrivateKey, password string) []byte {
+	t.Helper()
+	plain, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwd := utf16BE(password)
+	salt := make([]byte, sha1.Size)
+	_, _ = rand.Read(salt)
+
+	encrypted := make([]byte, len(plain))
+	digest := salt
+	for i := 0; i < len(plain); i += sha1.Size {
+		h := sha1.New() //nolint:gosec // mandated by the JKS format
+		h.Write(passwd)
+		h.Write(digest)
+		digest = h.Sum(nil)
+		subtle.XORBytes(encrypted[i:], plain[i:], digest)
+	}
+	h := sha1.New() //nolint:gosec // mandated by the JKS format
+	h.Write(passwd)
+	h.Write(plain)
+
+	data := append(append(bytes.Clone(salt), encrypted...), h.Sum(nil)...)
+	return marshalEncryptedPrivateKeyInfo(t, pkix.AlgorithmIdentifier{Algorithm: oidJKSKeyProtector, Parameters: asn1.NullRawValue}, data)
+}
+
+// protectJCEKS wraps priv with PBEWithMD5AndTripleDES as JCEKS does.
+func protectJCEKS(t *testing.T, priv crypto.PrivateKey, password string) []byte {
+	t.Helper()
+	plain, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := pbeParameter{Salt: make([]byte, 8), Iterations: 200}
+	_, _ = rand.Read(params.Salt)
+
+	derived := jceksDeriveKey(password, params)
+	c, err := des.NewTripleDESCipher(derived[:24])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := des.BlockSize - len(plain)%des.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(c, derived[24:]).CryptBlocks(encrypted, plain)
+
+	rawParams, err := asn1.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return marshalEncryptedPrivateKeyInfo(t, pkix.AlgorithmIdentifier{Algorithm: oidJCEKSKeyProtector, Parameters: asn1.RawValue{FullBytes: rawParams}}, encrypted)
+}
+
+func marshalEncryptedPrivateKeyInfo(t *testing.T, alg pkix.AlgorithmIdentifier, data []byte) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(encryptedPrivateKeyInfo{Algorithm: alg, EncryptedData: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writeKeystoreFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestJKSSignWithPrivateEntryVerifyWithTrustedEntry(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := selfSignedCert(t, priv)
+	path := writeKeystoreFile(t, "keystore.jks", buildJKS(t, jksMagic, "storepw",
+		testJKSEntry{alias: "signer", protectedKey: protectJKS(t, priv, "storepw"), chain: []*x509.Certificate{c}},
+		testJKSEntry{alias: "ca", chain: []*x509.Certificate{c}},
+	))
+	pwFile := writeFile(t, "pw", "storepw\n")
+
+	// Aliases are matched without regard to case, like keytool does.
+	keyset, err := keySource{Path: path, Format: "jks", PasswordFile: pwFile, Alias: "Signer"}.load()
+	if err != nil {
+		t.Fatalf("load jks: %v", err)
+	}
+	key, _ := keyset.Key(0)
+	chain, err := certificateChainOf(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || !chain[0].Equal(c) {
+		t.Fatalf("x5c does not hold the entry certificate: %v", chain)
+	}
+
+	payloadPath := writeFile(t, "payload.txt", "jks signed")
+	out := filepath.Join(t.TempDir(), "out.jws")
+	s := &jwsSigner{
+		Algorithms:      []string{"ES256"},
+		Keys:            []string{path},
+		KeyFormat:       "jks",
+		KeyPasswordFile: pwFile,
+		Alias:           "signer",
+		InputFilePath:   payloadPath,
+		Output:          out,
+	}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	jwsMessage, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, err := keySource{Path: path, Format: "jks", PasswordFile: pwFile, Alias: "ca"}.load()
+	if err != nil {
+		t.Fatalf("load trusted entry: %v", err)
+	}
+	pub, _ := trusted.Key(0)
+	if _, ok := pub.(jwk.ECDSAPublicKey); !ok {
+		t.Fatalf("trusted certificate entry should be a public key, got %T", pub)
+	}
+	var buf bytes.Buffer
+	if err := (&jwsVerifier{Algorithm: "ES256"}).writeVerifyResult(&buf, jwsMessage, trusted); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if buf.String() != "jks signed" {
+		t.Errorf("payload mismatch: %q", buf.String())
+	}
+}
+
+func TestJKSErrors(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := selfSignedCert(t, priv)
+	path := writeKeystoreFile(t, "keystore.jks", buildJKS(t, jksMagic, "storepw",
+		testJKSEntry{alias: "signer", protectedKey: protectJKS(t, priv, "entrypw"), chain: []*x509.Certificate{c}},
+		testJKSEntry{alias: "ca", chain: []*x509.Certificate{c}},
+	))
+	secretPath := writeKeystoreFile(t, "secret.jceks", buildJKS(t, jceksMagic, "storepw",
+		testJKSEntry{alias: "aes", secret: true},
+	))
+	storePw := writeFile(t, "pw", "storepw")
+
+	tests := []struct {
+		name string
+		src  keySource
+		want error
+	}{
+		{"wrong store password", keySource{PasswordFile: writeFile(t, "bad", "nope"), Alias: "ca"}, ErrParseKey},
+		{"alias required", keySource{PasswordFile: storePw}, ErrRequireAlias},
+		{"unknown alias", keySource{PasswordFile: storePw, Alias: "missing"}, ErrKeystoreEntryNotFound},
+		{"entry password defaults to store password", keySource{PasswordFile: storePw, Alias: "signer"}, ErrParseKey},
+		{"secret key entry", keySource{Path: secretPath, PasswordFile: storePw, Alias: "aes"}, ErrUnsupportedKeystoreEntry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if tt.src.Path == "" {
+				tt.src.Path = path
+			}
+			tt.src.Format = "jks"
+			if _, err := tt.src.load(); !errors.Is(err, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	src := keySource{Path: path, Format: "jks", PasswordFile: storePw, Alias: "signer", EntryPasswordFile: writeFile(t, "entry", "entrypw")}
+	if _, err := src.load(); err != nil {
+		t.Errorf("entry password: %v", err)
+	}
+
+	notJKS := writeKeystoreFile(t, "key.jks", bytes.Repeat([]byte{0}, 64))
+	if _, err := (keySource{Path: notJKS, Format: "jks"}).load(); !errors.Is(err, ErrParseKey) {
+		t.Errorf("want ErrParseKey for a non keystore file, got %v", err)
+	}
+}
+
+func TestJWKExportJCEKS(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeKeystoreFile(t, "keystore.jceks", buildJKS(t, jceksMagic, "storepw",
+		testJKSEntry{alias: "only", protectedKey: protectJCEKS(t, priv, "entrypw"), chain: []*x509.Certificate{selfSignedCert(t, priv)}},
+	))
+
+	out := filepath.Join(t.TempDir(), "out.jwk")
+	e := &jwkExporter{
+		Key:               path,
+		KeyFormat:         "jks",
+		KeyPasswordFile:   writeFile(t, "pw", "storepw"),
+		EntryPasswordFile: writeFile(t, "entry", "entrypw"),
+		OutputFormat:      "json",
+		Output:            out,
+	}
+	if err := e.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.export(); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+
+	got := keyOf(t, out)
+	if _, ok := got.X509CertChain(); !ok {
+		t.Error("json export of a jks entry lost x5c")
+	}
+	want, err := jwk.Import[jwk.Key](priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTP, _ := want.Thumbprint(crypto.SHA256)
+	gotTP, _ := got.Thumbprint(crypto.SHA256)
+	if !bytes.Equal(wantTP, gotTP) {
+		t.Error("jceks export changed the key")
+	}
+}
+
+func TestJWKExportRejectsJKSOutput(t *testing.T) {
+	t.Parallel()
+
+	// jose reads keystores but does not write them; the output file must be
+	// left alone when -O jks is refused.
+	out := writeFile(t, "existing.jks", "keep me")
+	root := newRootCmd()
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	root.SetArgs([]string{"jwk", "export", "--key", genKey(t, "EC", "P-256", 0, "json", false), "-O", "jks", "-o", out})
+	if err := root.Execute(); !errors.Is(err, ErrInvalidKeyFormat) {
+		t.Errorf("want ErrInvalidKeyFormat, got %v", err)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != "keep me" {
+		t.Errorf("output file changed: %q, %v", data, err)
+	}
+}
+
+func TestJKSSkipsEntriesItCannotUse(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := selfSignedCert(t, priv)
+	path := writeKeystoreFile(t, "keystore.jceks", buildJKS(t, jceksMagic, "storepw",
+		testJKSEntry{alias: "aes", secret: true},
+		testJKSEntry{alias: "broken", chain: []*x509.Certificate{{Raw: []byte("not a certificate")}}},
+		testJKSEntry{alias: "signer", protectedKey: protectJCEKS(t, priv, "storepw"), chain: []*x509.Certificate{c}},
+	))
+	storePw := writeFile(t, "pw", "storepw")
+
+	if _, err := (keySource{Path: path, Format: "jks", PasswordFile: storePw, Alias: "signer"}).load(); err != nil {
+		t.Errorf("signer after a secret key entry: %v", err)
+	}
+	if _, err := (keySource{Path: path, Format: "jks", PasswordFile: storePw, Alias: "aes"}).load(); !errors.Is(err, ErrUnsupportedKeystoreEntry) {
+		t.Errorf("aes: want ErrUnsupportedKeystoreEntry, got %v", err)
+	}
+	if _, err := (keySource{Path: path, Format: "jks", PasswordFile: storePw, Alias: "broken"}).load(); !errors.Is(err, ErrParseKey) {
+		t.Errorf("broken: want ErrParseKey, got %v", err)
+	}
+}
+
+// TestJKSIndependentFixture reads a keystore written by keystore-go, another
+// implementation of the format (testdata/jks/README.md).
+func TestJKSIndependentFixture(t *testing.T) {
+	t.Parallel()
+
+	keyset, err := keySource{
+		Path:              filepath.Join("testdata", "jks", "keystore-go.jks"),
+		Format:            "jks",
+		PasswordFile:      writeFile(t, "pw", "password"),
+		EntryPasswordFile: writeFile(t, "entry", "keypassword"),
+		Alias:             "alias",
+	}.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := keyset.Key(0)
+	if _, ok := got.X509CertChain(); !ok {
+		t.Error("the entry certificate is missing from x5c")
+	}
+	want, err := getKeyFile(filepath.Join("testdata", "jks", "keystore-go.pem"), "pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantKey, _ := want.Key(0)
+	wantTP, _ := wantKey.Thumbprint(crypto.SHA256)
+	gotTP, _ := got.Thumbprint(crypto.SHA256)
+	if !bytes.Equal(wantTP, gotTP) {
+		t.Error("the keystore-go entry does not hold the key of keystore-go.pem")
+	}
+}
+
+// TestJKSKeytoolFixtures reads keystores written by the JDK's keytool
+// (testdata/jks/gen.sh).
+func TestJKSKeytoolFixtures(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join("testdata", "jks")
+	for _, name := range []string{"keytool.jks", "keytool.jceks"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Skipf("%s is missing; run testdata/jks/gen.sh with a JDK", name)
+		}
+	}
+	storePw := writeFile(t, "pw", "storepw")
+	entryPw := writeFile(t, "entry", "entrypw")
+
+	load := func(name, alias, entryPasswordFile string) (jwk.Key, error) {
+		keyset, err := keySource{Path: filepath.Join(dir, name), Format: "jks", PasswordFile: storePw, EntryPasswordFile: entryPasswordFile, Alias: alias}.load()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := keyset.Key(0)
+		return key, nil
+	}
+
+	signer, err := load("keytool.jks", "signer", entryPw)
+	if err != nil {
+		t.Fatalf("jks PrivateKeyEntry: %v", err)
+	}
+	if _, ok := signer.(jwk.ECDSAPrivateKey); !ok {
+		t.Errorf("jks PrivateKeyEntry: want an EC private key, got %T", signer)
+	}
+	ca, err := load("keytool.jks", "ca", "")
+	if err != nil {
+		t.Fatalf("jks trustedCertEntry: %v", err)
+	}
+	public, err := signer.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTP, _ := public.Thumbprint(crypto.SHA256)
+	gotTP, _ := ca.Thumbprint(crypto.SHA256)
+	if !bytes.Equal(wantTP, gotTP) {
+		t.Error("jks trustedCertEntry does not hold the signer's public key")
+	}
+
+	jceksSigner, err := load("keytool.jceks", "signer", entryPw)
+	if err != nil {
+		t.Fatalf("jceks PrivateKeyEntry next to a SecretKeyEntry: %v", err)
+	}
+	gotTP, _ = jceksSigner.Thumbprint(crypto.SHA256)
+	wantTP, _ = signer.Thumbprint(crypto.SHA256)
+	if !bytes.Equal(wantTP, gotTP) {
+		t.Error("jceks PrivateKeyEntry differs from the jks one it was imported from")
+	}
+	if _, err := load("keytool.jceks", "aes", ""); !errors.Is(err, ErrUnsupportedKeystoreEntry) {
+		t.Errorf("jceks SecretKeyEntry: want ErrUnsupportedKeystoreEntry, got %v", err)
+	}
+}
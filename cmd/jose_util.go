@@ -1,12 +1,15 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto/elliptic"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/lestrrat-go/jwx/v4/jwk"
@@ -15,8 +18,18 @@ import (
 
 const (
 	defaultKeySize = 2048
+	// keyPasswordEnv holds the password of a protected key file when
+	// --key-password-file is not given.
+	keyPasswordEnv = "JOSE_KEY_PASSWORD"
+	// defaultMaxInputSize is the default of --max-input-size: far more than
+	// any token, far less than a runaway "cat /dev/zero |".
+	defaultMaxInputSize = "64MiB"
 )
 
+// maxInputSize is the most bytes readInput reads, set from --max-input-size
+// before every command runs. 0 means no limit.
+var maxInputSize int64 = 64 << 20
+
 func writeJSON(w io.Writer, v interface{}) error {
 	buf, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
@@ -63,8 +76,10 @@ func openInputFile(path string) (io.ReadCloser, error) {
 }
 
 // readInput reads all bytes from the input named by path. path may be a file
-// path, "-" for stdin, or empty to read piped stdin. It is the payload/message
-// reader shared by sign, encrypt, and decrypt.
+// path, "-" for stdin, or empty to read piped stdin. It stops with
+// ErrInputTooLarge past maxInputSize bytes instead of exhausting memory on a
+// runaway input; only a payload streamed through the hash (jws sign
+// --detached, jws verify --payload) is read without it.
 func readInput(path string) ([]byte, error) {
 	src, err := openInputFile(path)
 	if err != nil {
@@ -74,37 +89,95 @@ func readInput(path string) ([]byte, error) {
 		_ = src.Close()
 	}()
 
-	data, err := io.ReadAll(src)
+	limit := maxInputSize
+	var r io.Reader = src
+	if limit > 0 {
+		// One byte more than allowed tells a full input from a larger one.
+		r = io.LimitReader(src, limit+1)
+	}
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, wrap(ErrReadFile, err.Error())
 	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, wrap(ErrInputTooLarge, fmt.Sprintf("more than %d bytes (raise --max-input-size)", limit))
+	}
 	return data, nil
 }
 
+// byteUnits are the suffixes parseByteSize accepts, by their multiplier.
+var byteUnits = map[string]int64{
+	"": 1, "b": 1,
+	"kb": 1000, "mb": 1000 * 1000, "gb": 1000 * 1000 * 1000, "tb": 1000 * 1000 * 1000 * 1000,
+	"k": 1 << 10, "kib": 1 << 10, "m": 1 << 20, "mib": 1 << 20, "g": 1 << 30, "gib": 1 << 30, "t": 1 << 40, "tib": 1 << 40,
+}
+
+// parseByteSize reads a size such as "1048576", "512KiB", "64MiB" or "2GB".
+// The binary units (KiB, MiB, GiB, TiB, or just K, M, G, T) are powers of
+// 1024 and the decimal ones (KB, MB, GB, TB) powers of 1000.
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := byteUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if i == 0 || !ok {
+		return 0, wrap(ErrInvalidMaxInputSize, s)
+	}
+	n, err := strconv.ParseInt(s[:i], 10, 64)
+	if err != nil || n > math.MaxInt64/unit {
+		return 0, wrap(ErrInvalidMaxInputSize, s)
+	}
+	return n * unit, nil
+}
+
 // looksLikeCompactJWS reports whether s has the shape of a compact JWS:
 // three base64url segments separated by dots, where the protected header
 // (the first segment) base64url-decodes to valid JSON. This lets jose tell an
-// inline token apart from a mistyped file name like "does-not-exist.jws".
+// inline token apart from a mistyped file name like "does-not-exist.jws". The
+// payload segment is empty when the payload is detached ("header..signature").
 func looksLikeCompactJWS(s string) bool {
 	parts := strings.Split(s, ".")
 	if len(parts) != 3 {
 		return false
 	}
-	// The header and payload must be present; an unsecured JWS could have an
-	// empty signature, so only the first two segments are required.
-	if parts[0] == "" || parts[1] == "" {
+	// The header must be present. An unsecured JWS has an empty signature and
+	// a detached one an empty payload, but not both.
+	if parts[0] == "" || parts[1] == "" && parts[2] == "" {
 		return false
 	}
-	for _, p := range parts {
-		if !isBase64URL(p) {
-			return false
-		}
+	if !isBase64URL(parts[0]) || !isBase64URL(parts[2]) {
+		return false
 	}
 	header, err := base64.RawURLEncoding.DecodeString(parts[0])
-	if err != nil {
+	if err != nil || !json.Valid(header) {
 		return false
 	}
-	return json.Valid(header)
+	// An unencoded payload (RFC 7797 "b64": false) is any text without ".".
+	var b64 struct {
+		B64 *bool `json:"b64"`
+	}
+	if err := json.Unmarshal(header, &b64); err == nil && b64.B64 != nil && !*b64.B64 {
+		return true
+	}
+	return isBase64URL(parts[1])
+}
+
+// hasDetachedPayload reports whether message, compact or JSON, was signed
+// with a detached payload: an empty payload segment or no "payload" member.
+func hasDetachedPayload(message []byte) bool {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) != 0 && trimmed[0] == '{' {
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &members); err != nil {
+			return false
+		}
+		_, ok := members["payload"]
+		return !ok
+	}
+	parts := bytes.Split(trimmed, []byte("."))
+	return len(parts) == 3 && len(parts[1]) == 0
 }
 
 // isBase64URL reports whether s contains only base64url characters (the
@@ -124,19 +197,34 @@ func isBase64URL(s string) bool {
 	return true
 }
 
-// readCompactJWS resolves the bytes of a JWS message from a positional
+// looksLikeJSONJWS reports whether s is a JSON object with the members of a
+// general ("signatures") or flattened ("signature") JWS JSON serialization.
+func looksLikeJSONJWS(s string) bool {
+	if !strings.HasPrefix(strings.TrimSpace(s), "{") {
+		return false
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &members); err != nil {
+		return false
+	}
+	_, general := members["signatures"]
+	_, flattened := members["signature"]
+	return general || flattened
+}
+
+// readJWSMessage resolves the bytes of a JWS message from a positional
 // argument. The argument may be a file path, "-" for stdin, or an inline
-// compact JWS token; when arg is empty and stdin is piped it reads stdin. A
-// value that is neither an existing file nor a token-shaped string is treated
-// as a file path so that a typo reports "failed to open file" instead of a
-// confusing parse error.
-func readCompactJWS(arg string) ([]byte, error) {
+// compact or JSON serialized JWS; when arg is empty and stdin is piped it
+// reads stdin. A value that is neither an existing file nor a message-shaped
+// string is treated as a file path so that a typo reports "failed to open
+// file" instead of a confusing parse error.
+func readJWSMessage(arg string) ([]byte, error) {
 	switch {
 	case arg == "" || arg == "-":
 		// stdin (piped or "-"); fall through to openInputFile.
 	case file.IsFile(arg):
 		// existing file; fall through to openInputFile.
-	case looksLikeCompactJWS(arg):
+	case looksLikeCompactJWS(arg), looksLikeJSONJWS(arg):
 		return []byte(arg), nil
 		// default: not a file and not token-shaped; openInputFile reports the
 		// real file-open error below.
@@ -170,21 +258,21 @@ func openOutputFile(path string) (io.WriteCloser, error) {
 }
 
 // availableCurves returns the elliptic curves usable for EC keys
-// (P-256/P-384/P-521).
+// (P-256/P-384/P-521 and secp256k1, wired up in secp256k1.go).
 func availableCurves() []string {
 	return []string{
 		elliptic.P256().Params().Name,
 		elliptic.P384().Params().Name,
 		elliptic.P521().Params().Name,
+		curveSecp256k1,
 	}
 }
 
 // availableOKPCurves returns the curves jose can actually generate for OKP
-// keys. The jwx library advertises Ed448/X448 as constants, but the Go
-// standard library has no generator for them, so jose only supports
-// Ed25519 and X25519.
+// keys. Ed25519/X25519 come from the Go standard library and Ed448/X448 from
+// the pure-Go implementation wired up in okp448.go.
 func availableOKPCurves() []string {
-	return []string{"Ed25519", "X25519"}
+	return []string{"Ed25519", "X25519", "Ed448", "X448"}
 }
 
 // contains reports whether s is present in list.
@@ -197,22 +285,68 @@ func contains(list []string, s string) bool {
 	return false
 }
 
+// keySource describes where a key set comes from: a key file in one of the
+// supported formats, or a "keystore:<name>" reference. PasswordFile is only
+// consulted by password-protected formats such as p12 and jks. Alias and
+// EntryPasswordFile pick and unlock one entry of a Java keystore.
+type keySource struct {
+	Path              string
+	Format            string
+	PasswordFile      string
+	Alias             string
+	EntryPasswordFile string
+}
+
+// getKeyFile loads the key set in keyFile. It is shorthand for a keySource
+// without a password.
 func getKeyFile(keyFile, format string) (jwk.Set, error) {
+	return keySource{Path: keyFile, Format: format}.load()
+}
+
+func (s keySource) load() (jwk.Set, error) {
+	// "keystore:<name>" names an entry of the local keystore rather than a
+	// file, so the on-disk format does not apply.
+	if isKeystoreRef(s.Path) {
+		return loadKeystoreKey(s.Path)
+	}
+
 	var keyoptions []jwk.ParseOption
-	switch format {
+	switch s.Format {
 	case "json":
 	case "pem":
 		// v4 renamed WithPEM to WithX509 for PEM-framed X.509 input.
 		keyoptions = append(keyoptions, jwk.WithX509(true))
+	case "p12", "jks":
 	default:
-		return nil, wrap(ErrInvalidKeyFormat, "format is "+format)
+		return nil, wrap(ErrInvalidKeyFormat, "format is "+s.Format)
 	}
 
-	data, err := os.ReadFile(keyFile) //nolint:gosec // key path is supplied by the user on purpose
+	data, err := os.ReadFile(s.Path) //nolint:gosec // key path is supplied by the user on purpose
 	if err != nil {
 		return nil, wrap(ErrOpenFile, err.Error())
 	}
 
+	switch s.Format {
+	case "p12":
+		password, err := keyPassword(s.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		return parsePKCS12(data, password)
+	case "jks":
+		password, err := keyPassword(s.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		entryPassword := ""
+		if s.EntryPasswordFile != "" {
+			if entryPassword, err = keyPassword(s.EntryPasswordFile); err != nil {
+				return nil, err
+			}
+		}
+		return parseJKS(data, password, entryPassword, s.Alias)
+	}
+
 	keySet, err := jwk.Parse(data, keyoptions...)
 	if err != nil {
 		return nil, wrap(ErrParseKey, err.Error())
@@ -220,6 +354,20 @@ func getKeyFile(keyFile, format string) (jwk.Set, error) {
 	return keySet, nil
 }
 
+// keyPassword returns the password that protects a key file: the content of
+// passwordFile, or $JOSE_KEY_PASSWORD when no file is given. An empty
+// password is valid because PKCS#12 bundles are often exported without one.
+func keyPassword(passwordFile string) (string, error) {
+	if passwordFile == "" {
+		return os.Getenv(keyPasswordEnv), nil
+	}
+	data, err := os.ReadFile(passwordFile) //nolint:gosec // password path is supplied by the user on purpose
+	if err != nil {
+		return "", wrap(ErrOpenFile, err.Error())
+	}
+	return chop(string(data)), nil
+}
+
 func chop(s string) string {
 	s = strings.TrimRight(s, "\n")
 	if strings.HasSuffix(s, "\r") {
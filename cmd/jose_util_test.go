@@ -77,7 +77,7 @@ func TestAvailableCurves(t *testing.T) {
 	}{
 		{
 			name: "Get available curves",
-			want: []string{"P-256", "P-384", "P-521"},
+			want: []string{"P-256", "P-384", "P-521", "secp256k1"},
 		},
 	}
 	for _, tt := range tests {
@@ -32,15 +32,22 @@ func newJWEEncryptCmd() *cobra.Command {
 		Long: `Encrypt contents of FILE and generate a JWE message using
 the specified algorithms and key. Use "-" as FILE to
 read from STDIN.		
+
+The key must fit --key-encryption: RSA of at least 2048 bits for RSA*, an EC
+or X25519/X448 key for ECDH-ES*, an oct key of the AES key size for AnKW and
+AnGCMKW, and for dir an oct key of the size of --content-encryption.
 `,
 		RunE: runJWEEncrypt,
 	}
 
 	cmd.Flags().StringP("content-encryption", "c", "", "Content encryption algorithm name `NAME` (A128CBC-HS256/A128GCM/A192CBC-HS384/A192GCM/A256CBC-HS512/A256GCM)")
 	cmd.Flags().StringP("output", "o", "-", "output to file")
-	cmd.Flags().StringP("key", "k", "", "JWK to encrypt with")
+	cmd.Flags().StringP("key", "k", "", "JWK to encrypt with (file name or keystore:<name>)")
 	cmd.Flags().StringP("key-encryption", "K", "", "Key encryption algorithm name `NAME` (e.g. RSA-OAEP, ECDH-ES, etc)")
-	cmd.Flags().StringP("key-format", "F", "json", "JWK format: json or pem")
+	cmd.Flags().StringP("key-format", "F", "json", "JWK format: json, pem, p12 or jks")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
 	cmd.Flags().BoolP("compress", "z", false, "Enable compression")
 
 	return cmd
@@ -51,7 +58,10 @@ type jweEncrypter struct {
 	ContentEncryption string `validate:"oneof=A128CBC-HS256 A128GCM A192CBC-HS384 A192GCM A256CBC-HS512 A256GCM"`
 	Key               string `validate:"required"`
 	KeyEncryption     string `validate:"required,oneof=A128GCMKW A128KW A192GCMKW A192KW A256GCMKW A256KW ECDH-ES ECDH-ES+A128KW ECDH-ES+A192KW ECDH-ES+A256KW PBES2-HS256+A128KW PBES2-HS384+A192KW PBES2-HS512+A256KW RSA-OAEP RSA-OAEP-256 RSA1_5 dir"`
-	KeyFormat         string `validate:"oneof=json pem"`
+	KeyFormat         string `validate:"oneof=json pem p12 jks"`
+	KeyPasswordFile   string `validate:"-"`
+	Alias             string `validate:"-"`
+	EntryPasswordFile string `validate:"-"`
 	InputFilePath     string `validate:"-"`
 	Output            string `validate:"-"`
 }
@@ -77,6 +87,18 @@ func newJWEEncrypter(cmd *cobra.Command, args []string) (*jweEncrypter, error) {
 	if err != nil {
 		return nil, err
 	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return nil, err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return nil, err
+	}
 	inputFilePath := ""
 	if len(args) != 0 {
 		inputFilePath = args[0]
@@ -93,6 +115,9 @@ func newJWEEncrypter(cmd *cobra.Command, args []string) (*jweEncrypter, error) {
 		Key:               key,
 		KeyEncryption:     keyEncryption,
 		KeyFormat:         keyFormat,
+		KeyPasswordFile:   keyPasswordFile,
+		Alias:             alias,
+		EntryPasswordFile: entryPasswordFile,
 		Output:            output,
 	}, nil
 }
@@ -152,7 +177,13 @@ func (j *jweEncrypter) encrypt() error {
 		compress = jwa.Deflate()
 	}
 
-	keyset, err := getKeyFile(j.Key, j.KeyFormat)
+	keyset, err := keySource{
+		Path:              j.Key,
+		Format:            j.KeyFormat,
+		PasswordFile:      j.KeyPasswordFile,
+		Alias:             j.Alias,
+		EntryPasswordFile: j.EntryPasswordFile,
+	}.load()
 	if err != nil {
 		return err
 	}
@@ -160,6 +191,9 @@ func (j *jweEncrypter) encrypt() error {
 		return ErrNotContainKey
 	}
 	key, _ := keyset.Key(0)
+	if err := checkEncryptionKey(j.KeyEncryption, j.ContentEncryption, key); err != nil {
+		return err
+	}
 
 	publicKey, err := jwk.PublicKeyOf(key)
 	if err != nil {
@@ -192,24 +226,33 @@ func newJWEDecryptCmd() *cobra.Command {
 		Short:   "Decrypt JWE message from file or stdin",
 		Long: `Decrypt JWE message using the specified algorithms and key.
 Use "-" as FILE to read from STDIN.		
+
+The key must fit --key-encryption or, without it, the "alg" of a recipient
+of the message, as for jwe encrypt.
 `,
 		RunE: runJWEDecrypt,
 	}
 
 	cmd.Flags().StringP("output", "o", "-", "output to file")
-	cmd.Flags().StringP("key", "k", "", "JWK to decrypt with")
+	cmd.Flags().StringP("key", "k", "", "JWK to decrypt with (file name or keystore:<name>)")
 	cmd.Flags().StringP("key-encryption", "K", "", "Key encryption algorithm name `NAME` (e.g. RSA-OAEP, ECDH-ES, etc)")
-	cmd.Flags().StringP("key-format", "F", "json", "JWK format: json or pem")
+	cmd.Flags().StringP("key-format", "F", "json", "JWK format: json, pem, p12 or jks")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
 
 	return cmd
 }
 
 type jweDecrypter struct {
-	Key           string `validate:"required"`
-	KeyEncryption string `validate:"omitempty,oneof=A128GCMKW A128KW A192GCMKW A192KW A256GCMKW A256KW ECDH-ES ECDH-ES+A128KW ECDH-ES+A192KW ECDH-ES+A256KW PBES2-HS256+A128KW PBES2-HS384+A192KW PBES2-HS512+A256KW RSA-OAEP RSA-OAEP-256 RSA1_5 dir"`
-	KeyFormat     string `validate:"oneof=json pem"`
-	InputFilePath string `validate:"-"`
-	Output        string `validate:"-"`
+	Key               string `validate:"required"`
+	KeyEncryption     string `validate:"omitempty,oneof=A128GCMKW A128KW A192GCMKW A192KW A256GCMKW A256KW ECDH-ES ECDH-ES+A128KW ECDH-ES+A192KW ECDH-ES+A256KW PBES2-HS256+A128KW PBES2-HS384+A192KW PBES2-HS512+A256KW RSA-OAEP RSA-OAEP-256 RSA1_5 dir"`
+	KeyFormat         string `validate:"oneof=json pem p12 jks"`
+	KeyPasswordFile   string `validate:"-"`
+	Alias             string `validate:"-"`
+	EntryPasswordFile string `validate:"-"`
+	InputFilePath     string `validate:"-"`
+	Output            string `validate:"-"`
 }
 
 func newJWEDecrypter(cmd *cobra.Command, args []string) (*jweDecrypter, error) {
@@ -225,6 +268,18 @@ func newJWEDecrypter(cmd *cobra.Command, args []string) (*jweDecrypter, error) {
 	if err != nil {
 		return nil, err
 	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return nil, err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return nil, err
+	}
 	inputFilePath := ""
 	if len(args) != 0 {
 		inputFilePath = args[0]
@@ -235,11 +290,14 @@ func newJWEDecrypter(cmd *cobra.Command, args []string) (*jweDecrypter, error) {
 	}
 
 	return &jweDecrypter{
-		InputFilePath: inputFilePath,
-		Key:           key,
-		KeyEncryption: keyEncryption,
-		KeyFormat:     keyFormat,
-		Output:        output,
+		InputFilePath:     inputFilePath,
+		Key:               key,
+		KeyEncryption:     keyEncryption,
+		KeyFormat:         keyFormat,
+		KeyPasswordFile:   keyPasswordFile,
+		Alias:             alias,
+		EntryPasswordFile: entryPasswordFile,
+		Output:            output,
 	}, nil
 }
 
@@ -282,7 +340,13 @@ func (j *jweDecrypter) decrypt() error {
 		return err
 	}
 
-	keyset, err := getKeyFile(j.Key, j.KeyFormat)
+	keyset, err := keySource{
+		Path:              j.Key,
+		Format:            j.KeyFormat,
+		PasswordFile:      j.KeyPasswordFile,
+		Alias:             j.Alias,
+		EntryPasswordFile: j.EntryPasswordFile,
+	}.load()
 	if err != nil {
 		return err
 	}
@@ -290,6 +354,9 @@ func (j *jweDecrypter) decrypt() error {
 		return ErrNotContainKey
 	}
 	key, _ := keyset.Key(0)
+	if err := j.checkKey(buf, key); err != nil {
+		return err
+	}
 
 	decrypted, err := j.decryptMessage(buf, key)
 	if err != nil {
@@ -333,3 +400,39 @@ func (j *jweDecrypter) decryptMessage(input []byte, key jwk.Key) ([]byte, error)
 	}
 	return v, nil
 }
+
+// checkKey checks key against --key-encryption or, without it, against the
+// key encryption of the recipients of the message, one of which the key must
+// fit. A message that does not parse is left for jwe.Decrypt to report.
+func (j *jweDecrypter) checkKey(input []byte, key jwk.Key) error {
+	msg, err := jwe.Parse(input)
+	if err != nil {
+		return nil
+	}
+	enc := ""
+	if v, ok := msg.ProtectedHeaders().ContentEncryption(); ok {
+		enc = v.String()
+	}
+	if j.KeyEncryption != "" {
+		return checkEncryptionKey(j.KeyEncryption, enc, key)
+	}
+
+	var errs []error
+	for _, r := range msg.Recipients() {
+		alg, ok := r.Headers().Algorithm()
+		if !ok {
+			if alg, ok = msg.ProtectedHeaders().Algorithm(); !ok {
+				alg, ok = msg.UnprotectedHeaders().Algorithm()
+			}
+		}
+		if !ok {
+			continue
+		}
+		err := checkEncryptionKey(alg.String(), enc, key)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
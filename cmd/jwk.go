@@ -11,6 +11,8 @@ import (
 	"io"
 	"strings"
 
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/go-playground/validator/v10"
 	"github.com/lestrrat-go/jwx/v4/jwa"
 	"github.com/lestrrat-go/jwx/v4/jwk"
@@ -25,6 +27,7 @@ func newJWKCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(newJWKGenerateCmd())
+	cmd.AddCommand(newJWKExportCmd())
 	return cmd
 }
 
@@ -36,12 +39,14 @@ func newJWKGenerateCmd() *cobra.Command {
 		RunE:    runJWKGenerate,
 	}
 
-	cmd.Flags().StringP("curve", "c", "", "elliptic curve for EC (P-256/P-384/P-521) or OKP (Ed25519/X25519) keys")
+	cmd.Flags().StringP("curve", "c", "", "elliptic curve for EC (P-256/P-384/P-521/secp256k1) or OKP (Ed25519/X25519/Ed448/X448) keys")
 	cmd.Flags().StringP("type", "t", "", "jwk type (RSA/EC/OKP/oct)")
 	cmd.Flags().IntP("size", "s", defaultKeySize, "key size in bits for RSA or oct keys (default 2048)")
 	cmd.Flags().StringP("output-format", "O", "json", "output format for RSA/EC keys (json/pem)")
 	cmd.Flags().StringP("output", "o", "-", "output to file")
 	cmd.Flags().BoolP("public-key", "p", false, "display public key")
+	cmd.Flags().String("spec", "", "YAML file that defines several keys to generate")
+	cmd.Flags().Bool("force", false, "with --spec, regenerate keys whose files already exist")
 
 	return cmd
 }
@@ -150,8 +155,9 @@ func (j *jwkGenerater) validOct() error {
 
 // validPemSupport rejects PEM output for key types jose cannot frame as X.509,
 // so the user gets a clear message instead of an internal encoder error. oct
-// keys have no X.509 form, and OKP X25519 maps to Go's crypto/ecdh type, which
-// the PEM encoder does not handle.
+// keys have no X.509 form, OKP X25519 maps to Go's crypto/ecdh type, which
+// the PEM encoder does not handle, Ed448/X448 keys come from circl, which
+// has no PKCS#8 encoder, and crypto/x509 does not know the secp256k1 OID.
 func (j *jwkGenerater) validPemSupport() error {
 	if j.OutputFormat != "pem" {
 		return nil
@@ -161,6 +167,10 @@ func (j *jwkGenerater) validPemSupport() error {
 		return ErrPemForOct
 	case j.KeyType == jwa.OKP().String() && j.Curve == "X25519":
 		return ErrPemForX25519
+	case j.KeyType == jwa.OKP().String() && (j.Curve == "Ed448" || j.Curve == "X448"):
+		return ErrPemFor448
+	case j.KeyType == jwa.EC().String() && j.Curve == curveSecp256k1:
+		return ErrPemForSecp256k1
 	}
 	return nil
 }
@@ -179,8 +189,8 @@ func (j *jwkGenerater) validKeySize() error {
 }
 
 // validCurve validates --curve against the curves jose can actually generate
-// for the requested key type. EC keys use P-256/P-384/P-521 and OKP keys use
-// Ed25519/X25519; other key types do not use a curve.
+// for the requested key type. EC keys use P-256/P-384/P-521/secp256k1 and OKP
+// keys use Ed25519/X25519/Ed448/X448; other key types do not use a curve.
 func (j *jwkGenerater) validCurve() error {
 	switch j.KeyType {
 	case jwa.EC().String():
@@ -202,29 +212,9 @@ func (j *jwkGenerater) validCurve() error {
 }
 
 func (j *jwkGenerater) generate() (err error) {
-	var rawKey interface{}
-	switch j.KeyType {
-	case jwa.RSA().String():
-		if rawKey, err = j.generateRSA(); err != nil {
-			return err
-		}
-	case jwa.EC().String():
-		if rawKey, err = j.generateECDSA(); err != nil {
-			return err
-		}
-	case jwa.OctetSeq().String():
-		if rawKey, err = j.generateOctetSeq(); err != nil {
-			return err
-		}
-	case jwa.OKP().String():
-		if rawKey, err = j.generateOKP(); err != nil {
-			return err
-		}
-	}
-
-	key, err := jwk.Import[jwk.Key](rawKey)
+	key, err := j.generateKey()
 	if err != nil {
-		return wrap(ErrGenerateJWKFromRawKey, err.Error())
+		return err
 	}
 
 	if err := j.KeySet.AddKey(key); err != nil {
@@ -249,6 +239,36 @@ func (j *jwkGenerater) generate() (err error) {
 	return j.writeJWKSet(output)
 }
 
+// generateKey generates a new private key of the configured type and curve or
+// size.
+func (j *jwkGenerater) generateKey() (key jwk.Key, err error) {
+	var rawKey interface{}
+	switch j.KeyType {
+	case jwa.RSA().String():
+		if rawKey, err = j.generateRSA(); err != nil {
+			return nil, err
+		}
+	case jwa.EC().String():
+		if rawKey, err = j.generateECDSA(); err != nil {
+			return nil, err
+		}
+	case jwa.OctetSeq().String():
+		if rawKey, err = j.generateOctetSeq(); err != nil {
+			return nil, err
+		}
+	case jwa.OKP().String():
+		if rawKey, err = j.generateOKP(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err = jwk.Import[jwk.Key](rawKey)
+	if err != nil {
+		return nil, wrap(ErrGenerateJWKFromRawKey, err.Error())
+	}
+	return key, nil
+}
+
 func (j *jwkGenerater) setPublicKey() error {
 	publicKey, err := jwk.PublicSetOf(j.KeySet)
 	if err != nil {
@@ -275,6 +295,8 @@ func (j *jwkGenerater) generateECDSA() (interface{}, error) {
 		curve = elliptic.P384()
 	case "P-521":
 		curve = elliptic.P521()
+	case curveSecp256k1:
+		curve = secp256k1.S256()
 	default:
 		return nil, wrap(ErrInvalidCurve, "EC supports "+strings.Join(availableCurves(), "/"))
 	}
@@ -311,9 +333,19 @@ func (j *jwkGenerater) generateOKP() (interface{}, error) {
 			return nil, wrap(ErrGenerateX25519, err.Error())
 		}
 		rawKey = priv
+	case "Ed448":
+		_, priv, err := ed448.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, wrap(ErrGenerateEd448, err.Error())
+		}
+		rawKey = priv
+	case "X448":
+		priv, err := generateX448()
+		if err != nil {
+			return nil, wrap(ErrGenerateX448, err.Error())
+		}
+		rawKey = priv
 	default:
-		// jwx accepts Ed448/X448 as constants, but Go has no generator for
-		// them, so anything other than Ed25519/X25519 is unsupported.
 		return nil, wrap(ErrInvalidCurve, "OKP supports "+strings.Join(availableOKPCurves(), "/"))
 	}
 	return rawKey, nil
@@ -365,6 +397,20 @@ func (j *jwkGenerater) writeJWKSetByPemByJSONFormat(w io.Writer) error {
 }
 
 func runJWKGenerate(cmd *cobra.Command, _ []string) error {
+	if cmd.Flags().Changed("spec") {
+		generator, err := newJWKSpecGenerator(cmd)
+		if err != nil {
+			return err
+		}
+		if err := generator.valid(); err != nil {
+			return err
+		}
+		return generator.run()
+	}
+	if cmd.Flags().Changed("force") {
+		return ErrForceWithoutSpec
+	}
+
 	generator, err := newJWKGenerater(cmd)
 	if err != nil {
 		return err
@@ -0,0 +1,383 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/nao1215/gorky/file"
+	"github.com/spf13/cobra"
+	"go.yaml.in/yaml/v3"
+)
+
+// keyDefinitionFile is the document read by "jose jwk generate --spec":
+//
+//	keys:
+//	  - kid: signer
+//	    type: RSA
+//	    size: 2048
+//	    alg: RS256
+//	    use: sig
+//	    private: signer.jwk
+//	    public: signer.pub.jwk
+type keyDefinitionFile struct {
+	Keys []keyDefinition `yaml:"keys"`
+}
+
+// keyDefinition describes one key of a spec file. Private and Public are resolved
+// against the directory of the spec file when they are relative.
+type keyDefinition struct {
+	Kid     string `yaml:"kid" validate:"-"`
+	Type    string `yaml:"type" validate:"required,oneof=RSA EC OKP oct"`
+	Curve   string `yaml:"curve" validate:"-"`
+	Size    int    `yaml:"size" validate:"-"`
+	Alg     string `yaml:"alg" validate:"-"`
+	Use     string `yaml:"use" validate:"omitempty,oneof=sig enc"`
+	Format  string `yaml:"format" validate:"omitempty,oneof=json pem"`
+	Private string `yaml:"private" validate:"required,ne=-"`
+	Public  string `yaml:"public" validate:"ne=-"`
+}
+
+type jwkSpecGenerator struct {
+	Spec  string `validate:"required"`
+	Force bool   `validate:"-"`
+}
+
+// plannedKey is a validated spec entry with its output paths resolved.
+type plannedKey struct {
+	spec    keyDefinition
+	gen     *jwkGenerater
+	private string
+	public  string
+}
+
+func newJWKSpecGenerator(cmd *cobra.Command) (*jwkSpecGenerator, error) {
+	spec, err := cmd.Flags().GetString("spec")
+	if err != nil {
+		return nil, err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"type", "curve", "size", "output-format", "output", "public-key"} {
+		if cmd.Flags().Changed(name) {
+			return nil, wrap(ErrSpecWithKeyFlags, "--"+name)
+		}
+	}
+	return &jwkSpecGenerator{Spec: spec, Force: force}, nil
+}
+
+func (s *jwkSpecGenerator) valid() error {
+	validate := validator.New()
+	if err := validate.Struct(s); err != nil {
+		return ErrRequireSpecFile
+	}
+	return nil
+}
+
+// run generates every key of the spec. The whole file is validated before
+// anything is written, so a mistake in the last entry does not leave the
+// first ones half provisioned.
+func (s *jwkSpecGenerator) run() error {
+	plan, err := s.plan()
+	if err != nil {
+		return err
+	}
+	for _, p := range plan {
+		if err := s.apply(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan reads and validates the spec file.
+func (s *jwkSpecGenerator) plan() ([]plannedKey, error) {
+	data, err := os.ReadFile(s.Spec) //nolint:gosec // spec path is supplied by the user on purpose
+	if err != nil {
+		return nil, wrap(ErrOpenFile, err.Error())
+	}
+	var doc keyDefinitionFile
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		return nil, wrap(ErrInvalidKeySpec, err.Error())
+	}
+	if len(doc.Keys) == 0 {
+		return nil, wrap(ErrInvalidKeySpec, "no keys defined")
+	}
+
+	dir := filepath.Dir(s.Spec)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	var (
+		e     error
+		plan  = make([]plannedKey, 0, len(doc.Keys))
+		kids  = map[string]int{}
+		paths = map[string]int{}
+	)
+	for i, spec := range doc.Keys {
+		p := plannedKey{spec: spec, private: resolve(spec.Private), public: resolve(spec.Public)}
+		p.gen = &jwkGenerater{
+			Curve:        spec.Curve,
+			KeyType:      spec.Type,
+			KeySize:      cmp.Or(spec.Size, defaultKeySize),
+			OutputFormat: cmp.Or(spec.Format, "json"),
+			PublicKey:    spec.Public != "",
+		}
+		err := spec.valid(p.gen)
+		if spec.Kid != "" {
+			if j, ok := kids[spec.Kid]; ok {
+				err = errors.Join(err, fmt.Errorf("kid %q is also used by keys[%d]", spec.Kid, j))
+			}
+			kids[spec.Kid] = i
+		}
+		for _, path := range []string{p.private, p.public} {
+			if path == "" {
+				continue
+			}
+			if j, ok := paths[filepath.Clean(path)]; ok {
+				err = errors.Join(err, fmt.Errorf("%s is also written by keys[%d]", path, j))
+			}
+			paths[filepath.Clean(path)] = i
+		}
+		for _, err := range unjoin(err) {
+			e = errors.Join(e, fmt.Errorf("%w: %s: %w", ErrInvalidKeySpec, spec.describe(i), err))
+		}
+		plan = append(plan, p)
+	}
+	if e != nil {
+		return nil, e
+	}
+	return plan, nil
+}
+
+// valid checks one entry with the same rules as the flags of "jwk generate"
+// plus the spec only members.
+func (k keyDefinition) valid(gen *jwkGenerater) error {
+	validate := validator.New()
+	if err := validate.Struct(k); err != nil {
+		var e error
+		for _, v := range err.(validator.ValidationErrors) {
+			switch v.Field() {
+			case "Type":
+				e = errors.Join(e, ErrKeyType)
+			case "Use":
+				e = errors.Join(e, ErrInvalidKeyUse)
+			case "Format":
+				e = errors.Join(e, ErrInvalidKeyFormat)
+			case "Private", "Public":
+				e = errors.Join(e, ErrKeySpecOutput)
+			}
+		}
+		return e
+	}
+	if err := gen.valid(); err != nil {
+		return err
+	}
+	if err := k.validPEM(); err != nil {
+		return err
+	}
+	return k.validAlg()
+}
+
+// validPEM refuses kid, alg and use for a PEM entry: PEM has no place for
+// them, and dropping them would leave keys that do not match the spec.
+func (k keyDefinition) validPEM() error {
+	if k.Format != "pem" {
+		return nil
+	}
+	var members []string
+	for _, m := range [][2]string{{"kid", k.Kid}, {"alg", k.Alg}, {"use", k.Use}} {
+		if m[1] != "" {
+			members = append(members, m[0])
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return wrap(ErrKeySpecPEMMetadata, strings.Join(members, ", "))
+}
+
+// validAlg checks that alg is one jose can use with this type of key and that
+// it agrees with use.
+func (k keyDefinition) validAlg() error {
+	if k.Alg == "" {
+		return nil
+	}
+	switch {
+	case contains(supportedSignatureAlgorithms(), k.Alg):
+		if k.Use == "enc" {
+			return wrap(ErrInvalidKeyUse, k.Alg+" is a signature algorithm")
+		}
+		if !contains(signatureAlgorithmsFor(k.Type, k.Curve), k.Alg) {
+			return wrap(ErrKeySpecAlgorithm, k.Alg+" does not sign with "+k.keyName())
+		}
+	case contains(supportedKeyEncryptionAlgorithms(), k.Alg):
+		if k.Use == "sig" {
+			return wrap(ErrInvalidKeyUse, k.Alg+" is a key encryption algorithm")
+		}
+		if !encryptsWith(k.Alg, k.Type, k.Curve) {
+			return wrap(ErrKeySpecAlgorithm, k.Alg+" does not encrypt with "+k.keyName())
+		}
+	default:
+		return wrap(ErrKeySpecAlgorithm, "unknown alg "+k.Alg)
+	}
+	return nil
+}
+
+// signatureAlgorithmsFor returns the JWS algorithms that sign with a key of
+// type kty on curve crv.
+func signatureAlgorithmsFor(kty, crv string) []string {
+	switch kty {
+	case jwa.RSA().String():
+		return []string{"PS256", "PS384", "PS512", "RS256", "RS384", "RS512"}
+	case jwa.OctetSeq().String():
+		return []string{"HS256", "HS384", "HS512"}
+	case jwa.EC().String():
+		return map[string][]string{
+			"P-256":        {"ES256"},
+			"P-384":        {"ES384"},
+			"P-521":        {"ES512"},
+			curveSecp256k1: {algES256K},
+		}[crv]
+	case jwa.OKP().String():
+		if crv == "Ed25519" || crv == "Ed448" {
+			return []string{"EdDSA"}
+		}
+	}
+	return nil
+}
+
+// encryptsWith reports whether the JWE key encryption algorithm alg works with
+// a key of type kty on curve crv.
+func encryptsWith(alg, kty, crv string) bool {
+	switch {
+	case strings.HasPrefix(alg, "RSA"):
+		return kty == jwa.RSA().String()
+	case strings.HasPrefix(alg, "ECDH-ES"):
+		return kty == jwa.EC().String() && crv != curveSecp256k1 ||
+			kty == jwa.OKP().String() && (crv == "X25519" || crv == "X448")
+	default:
+		return kty == jwa.OctetSeq().String()
+	}
+}
+
+// unjoin returns the errors joined in err, or err alone.
+func unjoin(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func (k keyDefinition) keyName() string {
+	if k.Curve != "" {
+		return k.Type + " " + k.Curve + " keys"
+	}
+	return k.Type + " keys"
+}
+
+func (k keyDefinition) describe(i int) string {
+	if k.Kid != "" {
+		return fmt.Sprintf("keys[%d] (kid %q)", i, k.Kid)
+	}
+	return fmt.Sprintf("keys[%d]", i)
+}
+
+// apply generates the key of p unless its private key file already exists and
+// --force was not given. An existing key still gets its missing public half.
+func (s *jwkSpecGenerator) apply(p plannedKey) error {
+	if file.Exists(p.private) && !s.Force {
+		if p.public == "" || file.Exists(p.public) {
+			log.Info("key exists, skipping", "private", p.private)
+			return nil
+		}
+		set, err := getKeyFile(p.private, p.gen.OutputFormat)
+		if err != nil {
+			return err
+		}
+		log.Info("key exists, writing its public key", "private", p.private, "public", p.public)
+		return writeSpecKeys(p.public, p.gen.OutputFormat, set, true)
+	}
+
+	key, err := p.gen.generateKey()
+	if err != nil {
+		return err
+	}
+	if err := p.spec.setMembers(key); err != nil {
+		return err
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return wrap(ErrGenerateJWKFromRawKey, err.Error())
+	}
+	if err := writeSpecKeys(p.private, p.gen.OutputFormat, set, false); err != nil {
+		return err
+	}
+	if p.public != "" {
+		if err := writeSpecKeys(p.public, p.gen.OutputFormat, set, true); err != nil {
+			return err
+		}
+	}
+	log.Info("generated key", "kid", p.spec.Kid, "private", p.private, "public", p.public)
+	return nil
+}
+
+// setMembers stores kid, alg and use in key.
+func (k keyDefinition) setMembers(key jwk.Key) error {
+	for name, value := range map[string]string{
+		jwk.KeyIDKey:     k.Kid,
+		jwk.AlgorithmKey: k.Alg,
+		jwk.KeyUsageKey:  k.Use,
+	} {
+		if value == "" {
+			continue
+		}
+		if err := key.Set(name, value); err != nil {
+			return wrap(ErrGenerateJWKFromRawKey, err.Error())
+		}
+	}
+	return nil
+}
+
+// writeSpecKeys writes set, or its public keys, to path in format, creating
+// the parent directories as needed.
+func writeSpecKeys(path, format string, set jwk.Set, public bool) (err error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return wrap(ErrCreateFile, err.Error())
+	}
+	g := &jwkGenerater{OutputFormat: format, KeySet: set}
+	if public {
+		if err := g.setPublicKey(); err != nil {
+			return err
+		}
+	}
+	output, err := openOutputFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := output.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+	return g.writeJWKSet(output)
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKeySpec = `keys:
+  - kid: signer
+    type: RSA
+    alg: RS256
+    use: sig
+    private: keys/signer.jwk
+    public: keys/signer.pub.jwk
+  - kid: enc
+    type: EC
+    curve: P-256
+    alg: ECDH-ES
+    use: enc
+    private: keys/enc.jwk
+    public: keys/enc.pub.jwk
+  - kid: hmac
+    type: oct
+    size: 256
+    alg: HS256
+    private: keys/hmac.jwk
+`
+
+func TestJWKGenerateSpec(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	specPath := filepath.Join(dir, "keys.yaml")
+	if err := os.WriteFile(specPath, []byte(testKeySpec), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s := &jwkSpecGenerator{Spec: specPath}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	signer := keyOf(t, filepath.Join(dir, "keys", "signer.jwk"))
+	if kid, _ := signer.KeyID(); kid != "signer" {
+		t.Errorf("kid = %q", kid)
+	}
+	if alg, _ := signer.Algorithm(); alg.String() != "RS256" {
+		t.Errorf("alg = %v", alg)
+	}
+	if use, _ := signer.KeyUsage(); use != "sig" {
+		t.Errorf("use = %q", use)
+	}
+	pub := keyOf(t, filepath.Join(dir, "keys", "enc.pub.jwk"))
+	if kid, _ := pub.KeyID(); kid != "enc" {
+		t.Errorf("public kid = %q", kid)
+	}
+	if _, err := pub.PublicKey(); err != nil {
+		t.Error(err)
+	}
+
+	// A second run leaves existing keys alone and only fills in a missing
+	// public half; --force regenerates.
+	hmacPath := filepath.Join(dir, "keys", "hmac.jwk")
+	before, err := os.ReadFile(hmacPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "keys", "signer.pub.jwk")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.run(); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if after, _ := os.ReadFile(hmacPath); !bytes.Equal(before, after) {
+		t.Error("second run replaced an existing key")
+	}
+	if !sameKey(t, genKeyPublicOf(t, filepath.Join(dir, "keys", "signer.jwk")), filepath.Join(dir, "keys", "signer.pub.jwk")) {
+		t.Error("restored public key does not belong to the existing private key")
+	}
+
+	s.Force = true
+	if err := s.run(); err != nil {
+		t.Fatalf("forced run: %v", err)
+	}
+	if after, _ := os.ReadFile(hmacPath); bytes.Equal(before, after) {
+		t.Error("--force did not regenerate the key")
+	}
+}
+
+func TestJWKGenerateSpecValidatesEverythingFirst(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		spec string
+		want error
+	}{
+		{"empty", "keys: []\n", ErrInvalidKeySpec},
+		{"unknown member", "keys:\n  - type: RSA\n    private: a.jwk\n    sizes: 2048\n", ErrInvalidKeySpec},
+		{"bad type", "keys:\n  - type: DSA\n    private: a.jwk\n", ErrKeyType},
+		{"missing curve", "keys:\n  - type: EC\n    private: a.jwk\n", ErrRequireCurve},
+		{"no private path", "keys:\n  - type: oct\n    size: 256\n", ErrKeySpecOutput},
+		{"private to stdout", "keys:\n  - type: oct\n    size: 256\n    private: '-'\n", ErrKeySpecOutput},
+		{"public of oct", "keys:\n  - type: oct\n    size: 256\n    private: a.jwk\n    public: b.jwk\n", ErrPublicKeyForOct},
+		{"bad use", "keys:\n  - type: oct\n    size: 256\n    use: mac\n    private: a.jwk\n", ErrInvalidKeyUse},
+		{"alg against use", "keys:\n  - type: RSA\n    alg: RS256\n    use: enc\n    private: a.jwk\n", ErrInvalidKeyUse},
+		{"alg against curve", "keys:\n  - type: EC\n    curve: P-384\n    alg: ES256\n    private: a.jwk\n", ErrKeySpecAlgorithm},
+		{"alg against key type", "keys:\n  - type: OKP\n    curve: Ed25519\n    alg: ECDH-ES\n    private: a.jwk\n", ErrKeySpecAlgorithm},
+		{"unknown alg", "keys:\n  - type: RSA\n    alg: RS1\n    private: a.jwk\n", ErrKeySpecAlgorithm},
+		{"kid in pem", "keys:\n  - kid: k\n    type: RSA\n    format: pem\n    private: a.pem\n", ErrKeySpecPEMMetadata},
+		{"alg and use in pem", "keys:\n  - type: EC\n    curve: P-256\n    alg: ES256\n    use: sig\n    format: pem\n    private: a.pem\n", ErrKeySpecPEMMetadata},
+		{"duplicate kid", "keys:\n  - kid: k\n    type: RSA\n    private: a.jwk\n  - kid: k\n    type: RSA\n    private: b.jwk\n", ErrInvalidKeySpec},
+		{"duplicate path", "keys:\n  - type: RSA\n    private: a.jwk\n  - type: RSA\n    private: ./a.jwk\n", ErrInvalidKeySpec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			// A valid first entry proves that nothing is written when a later
+			// entry is wrong.
+			spec := "keys:\n  - type: oct\n    size: 256\n    private: first.jwk\n" + tt.spec[len("keys:\n"):]
+			if tt.name == "empty" {
+				spec = tt.spec
+			}
+			specPath := filepath.Join(dir, "keys.yaml")
+			if err := os.WriteFile(specPath, []byte(spec), 0600); err != nil {
+				t.Fatal(err)
+			}
+			err := (&jwkSpecGenerator{Spec: specPath}).run()
+			if !errors.Is(err, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "first.jwk")); !os.IsNotExist(err) {
+				t.Error("a key was written although the spec is invalid")
+			}
+		})
+	}
+}
+
+// sameKey reports whether two JWK files hold the same key.
+func sameKey(t *testing.T, a, b string) bool {
+	t.Helper()
+	ta, err := keyOf(t, a).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := keyOf(t, b).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Equal(ta, tb)
+}
@@ -209,13 +209,13 @@ func TestJWKGenerateValidation(t *testing.T) {
 			wantErr: ErrInvalidCurve,
 		},
 		{
-			name:    "OKP with unsupported X448 curve",
-			gen:     &jwkGenerater{KeyType: "OKP", Curve: "X448", KeySize: 2048, OutputFormat: "json"},
+			name:    "OKP with unknown curve",
+			gen:     &jwkGenerater{KeyType: "OKP", Curve: "X999", KeySize: 2048, OutputFormat: "json"},
 			wantErr: ErrInvalidCurve,
 		},
 		{
-			name:    "OKP with unsupported Ed448 curve",
-			gen:     &jwkGenerater{KeyType: "OKP", Curve: "Ed448", KeySize: 2048, OutputFormat: "json"},
+			name:    "OKP with EC curve",
+			gen:     &jwkGenerater{KeyType: "OKP", Curve: "P-256", KeySize: 2048, OutputFormat: "json"},
 			wantErr: ErrInvalidCurve,
 		},
 		{
@@ -248,6 +248,21 @@ func TestJWKGenerateValidation(t *testing.T) {
 			gen:     &jwkGenerater{KeyType: "OKP", Curve: "X25519", KeySize: 2048, OutputFormat: "pem"},
 			wantErr: ErrPemForX25519,
 		},
+		{
+			name:    "OKP Ed448 with pem output is rejected",
+			gen:     &jwkGenerater{KeyType: "OKP", Curve: "Ed448", KeySize: 2048, OutputFormat: "pem"},
+			wantErr: ErrPemFor448,
+		},
+		{
+			name:    "OKP X448 with pem output is rejected",
+			gen:     &jwkGenerater{KeyType: "OKP", Curve: "X448", KeySize: 2048, OutputFormat: "pem"},
+			wantErr: ErrPemFor448,
+		},
+		{
+			name:    "EC secp256k1 with pem output is rejected",
+			gen:     &jwkGenerater{KeyType: "EC", Curve: "secp256k1", KeySize: 2048, OutputFormat: "pem"},
+			wantErr: ErrPemForSecp256k1,
+		},
 	}
 
 	for _, tt := range tests {
@@ -267,8 +282,8 @@ func TestJWKGenerateUnsupportedOKPCurveErrorsAtGenerate(t *testing.T) {
 
 	// Even if validation were bypassed, generating an OKP key for a curve jose
 	// cannot produce must fail with a clear error, not a nil-key panic.
-	g := &jwkGenerater{KeyType: "OKP", Curve: "X448", KeySize: 2048, OutputFormat: "json", Output: "-", KeySet: jwk.NewSet()}
+	g := &jwkGenerater{KeyType: "OKP", Curve: "X999", KeySize: 2048, OutputFormat: "json", Output: "-", KeySet: jwk.NewSet()}
 	if _, err := g.generateOKP(); err == nil {
-		t.Error("expected error generating OKP X448, got nil")
+		t.Error("expected error generating OKP X999, got nil")
 	}
 }
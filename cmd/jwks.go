@@ -0,0 +1,352 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/go-playground/validator/v10"
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultJWKSPath   = "/.well-known/jwks.json"
+	openIDConfigPath  = "/.well-known/openid-configuration"
+	defaultJWKSMaxAge = 300
+	jwksServerTimeout = 10 * time.Second
+)
+
+func newJWKSCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "jwks",
+		Short: "JWKS is toolset for JSON Web Key Sets",
+	}
+
+	cmd.AddCommand(newJWKSServeCmd())
+	return cmd
+}
+
+func newJWKSServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the public keys of a JWK set over HTTP",
+		Long: `Serve the public half of the keys in --key as a JWKS document over HTTP.
+
+The response carries Cache-Control and ETag headers and answers
+If-None-Match with 304 Not Modified. The key file, or the keystore for a
+"keystore:<name>" key, is checked on every request and reloaded when it
+changes; a file that no longer parses is
+logged and the last good set keeps being served. Symmetric (oct) keys are
+refused because they have no public half.
+
+With --issuer, /.well-known/openid-configuration is served as well, with
+"jwks_uri" pointing at the JWKS path under the issuer.
+`,
+		RunE: runJWKSServe,
+	}
+
+	cmd.Flags().StringP("key", "k", "", "file name that contains the JWK set to serve, or keystore:<name>")
+	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem)")
+	cmd.Flags().String("addr", ":8080", "address to listen on")
+	cmd.Flags().String("path", defaultJWKSPath, "URL path of the JWKS document")
+	cmd.Flags().Int("max-age", defaultJWKSMaxAge, "max-age of the Cache-Control header in seconds")
+	cmd.Flags().String("issuer", "", "issuer URL; serves /.well-known/openid-configuration when set")
+
+	return cmd
+}
+
+type jwksServer struct {
+	Key       string `validate:"required"`
+	KeyFormat string `validate:"oneof=json pem"`
+	Addr      string `validate:"required"`
+	Path      string `validate:"startswith=/"`
+	MaxAge    int    `validate:"gte=0"`
+	Issuer    string `validate:"omitempty,url"`
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	body    []byte
+	etag    string
+}
+
+func newJWKSServer(cmd *cobra.Command) (*jwksServer, error) {
+	key, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return nil, err
+	}
+	keyFormat, err := cmd.Flags().GetString("key-format")
+	if err != nil {
+		return nil, err
+	}
+	addr, err := cmd.Flags().GetString("addr")
+	if err != nil {
+		return nil, err
+	}
+	path, err := cmd.Flags().GetString("path")
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := cmd.Flags().GetInt("max-age")
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := cmd.Flags().GetString("issuer")
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwksServer{
+		Key:       key,
+		KeyFormat: keyFormat,
+		Addr:      addr,
+		Path:      path,
+		MaxAge:    maxAge,
+		Issuer:    issuer,
+	}, nil
+}
+
+func (j *jwksServer) valid() error {
+	validate := validator.New()
+	if err := validate.Struct(j); err != nil {
+		var e error
+		for _, v := range err.(validator.ValidationErrors) {
+			filedName := v.Field()
+
+			switch filedName {
+			case "Key":
+				e = errors.Join(e, ErrRequireKeyFile)
+			case "KeyFormat":
+				e = errors.Join(e, ErrInvalidKeyFormat)
+			case "Addr":
+				e = errors.Join(e, ErrRequireListenAddress)
+			case "Path":
+				e = errors.Join(e, ErrInvalidJWKSPath)
+			case "MaxAge":
+				e = errors.Join(e, ErrInvalidMaxAge)
+			case "Issuer":
+				e = errors.Join(e, ErrInvalidIssuer)
+			}
+		}
+		return e
+	}
+	if j.Issuer != "" && j.Path == openIDConfigPath {
+		return ErrInvalidJWKSPath
+	}
+	// http.ServeMux panics on a pattern it cannot parse; wildcards and
+	// method prefixes are never meant here.
+	if strings.ContainsAny(j.Path, "{} \t\r\n") {
+		return wrap(ErrInvalidJWKSPath, j.Path)
+	}
+	return nil
+}
+
+func runJWKSServe(cmd *cobra.Command, _ []string) error {
+	server, err := newJWKSServer(cmd)
+	if err != nil {
+		return err
+	}
+	if err := server.valid(); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return server.serve(ctx)
+}
+
+// serve loads the key set once, so a bad file fails at start up, and then
+// listens until ctx is done.
+func (j *jwksServer) serve(ctx context.Context) error {
+	if _, _, err := j.current(); err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              j.Addr,
+		Handler:           j.handler(),
+		ReadHeaderTimeout: jwksServerTimeout,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- srv.ListenAndServe()
+	}()
+	log.Info("serving JWKS", "addr", j.Addr, "path", j.Path, "key", j.Key)
+
+	select {
+	case err := <-errCh:
+		return wrap(ErrServeJWKS, err.Error())
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), jwksServerTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			return wrap(ErrServeJWKS, err.Error())
+		}
+		return nil
+	}
+}
+
+func (j *jwksServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(j.Path, j.serveJWKS)
+	if j.Issuer != "" {
+		mux.HandleFunc(openIDConfigPath, j.serveOpenIDConfiguration)
+	}
+	return mux
+}
+
+func (j *jwksServer) serveJWKS(w http.ResponseWriter, r *http.Request) {
+	if !allowReadOnly(w, r) {
+		return
+	}
+	body, etag, err := j.current()
+	if err != nil {
+		log.Error("cannot serve JWKS", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	j.writeCached(w, r, body, etag)
+}
+
+func (j *jwksServer) serveOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	if !allowReadOnly(w, r) {
+		return
+	}
+	issuer := strings.TrimSuffix(j.Issuer, "/")
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, map[string]any{
+		"issuer":   issuer,
+		"jwks_uri": issuer + j.Path,
+	}); err != nil {
+		log.Error("cannot serve openid-configuration", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	j.writeCached(w, r, buf.Bytes(), etagOf(buf.Bytes()))
+}
+
+// writeCached writes a JSON body with the cache headers shared by every
+// document jwks serve publishes.
+func (j *jwksServer) writeCached(w http.ResponseWriter, r *http.Request, body []byte, etag string) {
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(j.MaxAge))
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// current returns the JWKS document and its ETag, reloading the key file when
+// its size or modification time changed since the last load. When a reload
+// fails after a good load, the previous document is kept.
+func (j *jwksServer) current() ([]byte, string, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	info, err := j.statKey()
+	if err != nil {
+		if j.body != nil {
+			log.Warn("cannot stat key file, serving the last loaded set", "key", j.Key, "err", err)
+			return j.body, j.etag, nil
+		}
+		return nil, "", wrap(ErrOpenFile, err.Error())
+	}
+	if j.body != nil && info.ModTime().Equal(j.modTime) && info.Size() == j.size {
+		return j.body, j.etag, nil
+	}
+
+	body, err := j.load()
+	if err != nil {
+		if j.body != nil {
+			log.Warn("cannot reload key file, serving the last loaded set", "key", j.Key, "err", err)
+			return j.body, j.etag, nil
+		}
+		return nil, "", err
+	}
+	if j.body != nil {
+		log.Info("reloaded JWKS", "key", j.Key)
+	}
+	j.modTime, j.size = info.ModTime(), info.Size()
+	j.body, j.etag = body, etagOf(body)
+	return j.body, j.etag, nil
+}
+
+// statKey stats the file --key is read from: the keystore for a
+// "keystore:<name>" reference, which is reloaded whenever any entry changes.
+func (j *jwksServer) statKey() (os.FileInfo, error) {
+	path := j.Key
+	if isKeystoreRef(j.Key) {
+		var err error
+		if path, err = resolveKeystorePath(""); err != nil {
+			return nil, err
+		}
+	}
+	return os.Stat(path)
+}
+
+// load reads the key file and renders the JSON of its public keys.
+func (j *jwksServer) load() ([]byte, error) {
+	keyset, err := getKeyFile(j.Key, j.KeyFormat)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keyset.Len() {
+		key, _ := keyset.Key(i)
+		if key.KeyType() == jwa.OctetSeq() {
+			return nil, ErrSymmetricKeyInJWKS
+		}
+	}
+	public, err := jwk.PublicSetOf(keyset)
+	if err != nil {
+		return nil, wrap(ErrGeneratePublicKey, err.Error())
+	}
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, public); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// allowReadOnly answers 405 for anything but GET and HEAD.
+func allowReadOnly(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+	w.Header().Set("Allow", "GET, HEAD")
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	return false
+}
+
+// etagOf returns a strong ETag derived from the SHA-256 of body.
+func etagOf(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header lists etag or "*".
+func etagMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// getJWKS issues a request against the handler of s.
+func getJWKS(t *testing.T, s *jwksServer, method, path, ifNoneMatch string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+// replaceKeyFile overwrites path with the key in src and moves its
+// modification time forward, so a reload is seen even on coarse clocks.
+func replaceKeyFile(t *testing.T, path, src string, at time.Time) {
+	t.Helper()
+	data, err := os.ReadFile(src) //nolint:gosec // test fixture
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJWKSServeCachingAndReload(t *testing.T) {
+	t.Parallel()
+
+	path := writeFile(t, "keys.jwks", "")
+	replaceKeyFile(t, path, genKey(t, "EC", "P-256", 0, "json", false), time.Now())
+	s := &jwksServer{Key: path, KeyFormat: "json", Addr: ":0", Path: defaultJWKSPath, MaxAge: 60}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := getJWKS(t, s, http.MethodGet, defaultJWKSPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+	set, err := jwk.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("served body is not a JWKS: %v", err)
+	}
+	key, _ := set.Key(0)
+	if _, ok := key.(jwk.ECDSAPublicKey); !ok || set.Len() != 1 {
+		t.Errorf("want a single public key, got %d keys (%T)", set.Len(), key)
+	}
+
+	if rec := getJWKS(t, s, http.MethodGet, defaultJWKSPath, etag); rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status = %d, want 304", rec.Code)
+	}
+
+	// A changed file is picked up on the next request.
+	replaceKeyFile(t, path, genKey(t, "RSA", "", 2048, "json", false), time.Now().Add(time.Minute))
+	rec = getJWKS(t, s, http.MethodGet, defaultJWKSPath, etag)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("after reload: status = %d", rec.Code)
+	}
+	newETag := rec.Header().Get("ETag")
+	if newETag == etag {
+		t.Error("ETag did not change after reload")
+	}
+
+	// A broken file keeps the last good set online.
+	replaceKeyFile(t, path, writeFile(t, "broken", "{"), time.Now().Add(2*time.Minute))
+	rec = getJWKS(t, s, http.MethodGet, defaultJWKSPath, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != newETag {
+		t.Errorf("broken file: status = %d, ETag = %q, want the previous set", rec.Code, rec.Header().Get("ETag"))
+	}
+}
+
+func TestJWKSServeOpenIDConfiguration(t *testing.T) {
+	t.Parallel()
+
+	path := genKey(t, "EC", "P-256", 0, "json", false)
+	s := &jwksServer{Key: path, KeyFormat: "json", Addr: ":0", Path: "/keys", Issuer: "https://issuer.example/"}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := getJWKS(t, s, http.MethodGet, openIDConfigPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var doc map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["issuer"] != "https://issuer.example" || doc["jwks_uri"] != "https://issuer.example/keys" {
+		t.Errorf("unexpected document: %v", doc)
+	}
+
+	if rec := getJWKS(t, s, http.MethodPost, "/keys", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", rec.Code)
+	}
+	if rec := getJWKS(t, s, http.MethodHead, "/keys", ""); rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("HEAD: status = %d, body %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	s = &jwksServer{Key: path, KeyFormat: "json", Addr: ":0", Path: "/keys"}
+	if rec := getJWKS(t, s, http.MethodGet, openIDConfigPath, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("without --issuer: status = %d, want 404", rec.Code)
+	}
+}
+
+// TestJWKSServeKeystoreReference checks that "keystore:<name>" can be served
+// and that a change to the keystore is picked up.
+func TestJWKSServeKeystoreReference(t *testing.T) {
+	o := newTestKeystore(t)
+	t.Setenv(keystorePathEnv, o.Path)
+	t.Setenv(keystorePasswordEnv, string(o.Password))
+	if err := o.add("issuer", keyOf(t, genKey(t, "EC", "P-256", 0, "json", false)), false); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &jwksServer{Key: "keystore:issuer", KeyFormat: "json", Addr: ":0", Path: defaultJWKSPath}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	rec := getJWKS(t, s, http.MethodGet, defaultJWKSPath, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body.String())
+	}
+	set, err := jwk.Parse(rec.Body.Bytes())
+	if err != nil || set.Len() != 1 {
+		t.Fatalf("want one key, got %v", err)
+	}
+
+	if err := o.add("issuer", keyOf(t, genKey(t, "RSA", "", 2048, "json", false)), true); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(o.Path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	rec = getJWKS(t, s, http.MethodGet, defaultJWKSPath, "")
+	set, err = jwk.Parse(rec.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := set.Key(0)
+	if _, ok := key.(jwk.RSAPublicKey); !ok {
+		t.Errorf("want the replaced RSA key, got %T", key)
+	}
+}
+
+func TestJWKSServeErrors(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	tests := []struct {
+		name string
+		s    *jwksServer
+		want error
+	}{
+		{"key required", &jwksServer{KeyFormat: "json", Addr: ":0", Path: "/"}, ErrRequireKeyFile},
+		{"relative path", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: "jwks"}, ErrInvalidJWKSPath},
+		{"wildcard path", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: "/{bad"}, ErrInvalidJWKSPath},
+		{"method in path", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: "/keys GET"}, ErrInvalidJWKSPath},
+		{"path clash", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: openIDConfigPath, Issuer: "https://a.example"}, ErrInvalidJWKSPath},
+		{"negative max-age", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: "/", MaxAge: -1}, ErrInvalidMaxAge},
+		{"bad issuer", &jwksServer{Key: keyPath, KeyFormat: "json", Addr: ":0", Path: "/", Issuer: "issuer"}, ErrInvalidIssuer},
+		{"no address", &jwksServer{Key: keyPath, KeyFormat: "json", Path: "/"}, ErrRequireListenAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.s.valid(); !errors.Is(err, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	oct := &jwksServer{Key: octKeyFileWithKid(t, "HS256", "k1"), KeyFormat: "json", Addr: "127.0.0.1:0", Path: "/"}
+	if err := oct.serve(context.Background()); !errors.Is(err, ErrSymmetricKeyInJWKS) {
+		t.Errorf("want ErrSymmetricKeyInJWKS, got %v", err)
+	}
+}
+
+func TestJWKSServeShutsDownWithContext(t *testing.T) {
+	t.Parallel()
+
+	s := &jwksServer{Key: genKey(t, "EC", "P-256", 0, "json", false), KeyFormat: "json", Addr: "127.0.0.1:0", Path: defaultJWKSPath}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.serve(ctx) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after cancel")
+	}
+}
@@ -1,11 +1,15 @@
 package cmd
 
 import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/lestrrat-go/jwx/v4/jwa"
@@ -20,6 +24,8 @@ func newJWSCmd() *cobra.Command {
 		Short: "Work with JWS messages",
 	}
 
+	cmd.AddCommand(newJWSCountersignCmd())
+	cmd.AddCommand(newJWSInspectCmd())
 	cmd.AddCommand(newJWSParseCmd())
 	cmd.AddCommand(newJWSSignCmd())
 	cmd.AddCommand(newJWSVerifyCmd())
@@ -31,7 +37,8 @@ func newJWSParseCmd() *cobra.Command {
 		Use:   "parse",
 		Short: "Parse a JWS message and print its payload",
 		Long: `Parse JWS and display payload in the JWS message.
-Use "-" as FILE to read from STDIN.`,
+Use "-" as FILE to read from STDIN. The message may use the compact, general
+JSON or flattened JSON serialization.`,
 		RunE: runJWSParse,
 	}
 	cmd.Flags().BoolP("all", "a", false, "print all information (payload, header, signature)")
@@ -59,7 +66,7 @@ func newJWSParser(cmd *cobra.Command, args []string) (*jwsParser, error) {
 		return nil, errors.New("you must specify file or jws token")
 	}
 
-	jws, err := readCompactJWS(arg)
+	jws, err := readJWSMessage(arg)
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +111,13 @@ func printAll(w io.Writer, msg *jws.Message) error {
 		if err := writeJSON(w, sig.ProtectedHeaders()); err != nil {
 			return err
 		}
+		// Only the JSON serializations carry an unprotected header.
+		if h := sig.PublicHeaders(); h != nil && len(h.Keys()) != 0 {
+			fmt.Fprintf(w, "Signature %d unprotected header: ", i)
+			if err := writeJSON(w, h); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
@@ -111,40 +125,105 @@ func printAll(w io.Writer, msg *jws.Message) error {
 func newJWSSignCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "sign",
-		Short: "Creates a signed JWS message in compact format from a key and payload.",
-		Long: `Signs the payload in FILE and generates a JWS message in compact format.
+		Short: "Creates a signed JWS message from a key and payload.",
+		Long: `Signs the payload in FILE and generates a JWS message.
 Use "-" as FILE to read from STDIN.
 
-Currently, only single key signature mode is supported.
+The message is written in compact format by default. --serialization json
+writes the general JWS JSON serialization ("signatures" array) and
+--serialization flattened the flattened one. Unprotected header members
+(--unprotected-header) exist only in the JSON serializations.
+
+--header-file FILE, --header JSON and --set-header NAME=VALUE (repeatable)
+build the protected header, in that order, a later one overriding a member
+an earlier one set. VALUE is read as JSON when it parses as JSON (2, true,
+{"a":1}, "2") and as a string otherwise, so --set-header typ=JWT needs no
+quoting. An "alg" member must name the algorithm of the signature.
+
+--unencoded-payload signs the payload as is instead of base64url encoded
+(RFC 7797): the protected header gets "b64": false and "crit": ["b64"]. In
+the compact serialization the payload must then not contain ".", so it is
+best combined with --detached or a JSON serialization.
+
+--embed-jwk puts the public key into the protected header, --jku and --x5u
+name where the key or its certificate can be fetched, and --x5c FILE adds the
+PEM certificate chain of the key, its own certificate first.
+
+--detached leaves the payload out of the message (RFC 7515 Appendix F): the
+compact form becomes "header..signature" and the JSON forms have no
+"payload" member. The verifier supplies the payload with --payload. The
+payload is streamed rather than read into memory, so --max-input-size does
+not limit it, except with EdDSA, which signs the whole message.
+
+--algorithm from-key signs with the algorithm the key declares in "alg".
+
+Every key must fit its algorithm: the key type and curve it names, an RSA
+modulus of at least 2048 bits, and an oct key at least as long as the hash
+of HS256, HS384 or HS512. A public RSA, EC or OKP key, or an oct key that
+holds one in PEM, DER or JWK form, is never used as an HMAC secret.
+
+Repeat --key and --algorithm in pairs to sign with several keys, or omit
+--algorithm and give one JWK set whose keys all carry "alg". Every key adds
+one signature with its kid in the protected header (the RFC 7638 thumbprint
+when the key has no kid). Several signatures need --serialization json.
 `,
 		RunE: runJWSSign,
 	}
 
-	cmd.Flags().StringP("algorithm", "a", "", "signature algorithm (required, e.g. ES256, RS256, HS256, EdDSA)")
-	cmd.Flags().StringP("key", "k", "", "file name that contains the key to use. single JWK or JWK set")
-	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem)")
-	cmd.Flags().StringP("header", "H", "", "header object to inject into JWS message protected header")
+	cmd.Flags().StringArrayP("algorithm", "a", nil, "signature algorithm (e.g. ES256, RS256, HS256, EdDSA, or from-key for the alg of the key); repeat once per --key")
+	cmd.Flags().StringArrayP("key", "k", nil, "file name that contains the key to use. single JWK or JWK set, or keystore:<name>; repeatable")
+	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem/p12/jks)")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
+	cmd.Flags().StringP("header", "H", "", "header object to inject into the protected header of every signature")
+	cmd.Flags().String("header-file", "", "file that holds a header object to inject into the protected header")
+	cmd.Flags().StringArray("set-header", nil, "set NAME=VALUE in the protected header (VALUE is JSON or a string); repeatable")
+	cmd.Flags().String("unprotected-header", "", "header object to put in the unprotected header (json and flattened serialization only)")
+	cmd.Flags().String("serialization", "compact", "output serialization (compact/json/flattened)")
+	cmd.Flags().Bool("detached", false, "leave the payload out of the message (detached payload)")
+	cmd.Flags().Bool("unencoded-payload", false, "sign the payload as is, without base64url encoding (RFC 7797 b64=false)")
+	cmd.Flags().Bool("embed-jwk", false, "embed the public key in the protected header (jwk)")
+	cmd.Flags().String("jku", "", "https URL of a JWK set that holds the key (jku header)")
+	cmd.Flags().String("x5u", "", "https URL of the certificate chain of the key (x5u header)")
+	cmd.Flags().String("x5c", "", "PEM file with the certificate chain of the key to embed (x5c header)")
 	cmd.Flags().StringP("output", "o", "-", "output to file")
 
 	return cmd
 }
 
 type jwsSigner struct {
-	Algorithm     string `validate:"required,oneof=ES256 ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512"`
-	Key           string `validate:"required"`
-	KeyFormat     string `validate:"oneof=json pem"`
-	Header        string `validate:"-"`
-	InputFilePath string `validate:"-"`
-	Output        string `validate:"-"`
+	Algorithms        []string `validate:"dive,oneof=ES256 ES256K ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512 from-key"`
+	Keys              []string `validate:"required,dive,required"`
+	KeyFormat         string   `validate:"oneof=json pem p12 jks"`
+	KeyPasswordFile   string   `validate:"-"`
+	Alias             string   `validate:"-"`
+	EntryPasswordFile string   `validate:"-"`
+	Header            string   `validate:"-"`
+	HeaderFile        string   `validate:"-"`
+	SetHeaders        []string `validate:"-"`
+	UnprotectedHeader string   `validate:"-"`
+	Serialization     string   `validate:"omitempty,oneof=compact json flattened"`
+	Detached          bool     `validate:"-"`
+	UnencodedPayload  bool     `validate:"-"`
+	EmbedJWK          bool     `validate:"-"`
+	JKU               string   `validate:"omitempty,url,startswith=https://"`
+	X5U               string   `validate:"omitempty,url,startswith=https://"`
+	X5C               string   `validate:"-"`
+	InputFilePath     string   `validate:"-"`
+	Output            string   `validate:"-"`
+
+	// chain holds the certificates read from X5C.
+	chain []*x509.Certificate
 }
 
 func newJWSSigner(cmd *cobra.Command, args []string) (*jwsSigner, error) {
-	algorithm, err := cmd.Flags().GetString("algorithm")
+	algorithms, err := cmd.Flags().GetStringArray("algorithm")
 	if err != nil {
 		return nil, err
 	}
 
-	key, err := cmd.Flags().GetString("key")
+	keys, err := cmd.Flags().GetStringArray("key")
 	if err != nil {
 		return nil, err
 	}
@@ -153,11 +232,63 @@ func newJWSSigner(cmd *cobra.Command, args []string) (*jwsSigner, error) {
 	if err != nil {
 		return nil, err
 	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return nil, err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return nil, err
+	}
 
 	header, err := cmd.Flags().GetString("header")
 	if err != nil {
 		return nil, err
 	}
+	headerFile, err := cmd.Flags().GetString("header-file")
+	if err != nil {
+		return nil, err
+	}
+	setHeaders, err := cmd.Flags().GetStringArray("set-header")
+	if err != nil {
+		return nil, err
+	}
+	unprotectedHeader, err := cmd.Flags().GetString("unprotected-header")
+	if err != nil {
+		return nil, err
+	}
+	serialization, err := cmd.Flags().GetString("serialization")
+	if err != nil {
+		return nil, err
+	}
+	detached, err := cmd.Flags().GetBool("detached")
+	if err != nil {
+		return nil, err
+	}
+	unencodedPayload, err := cmd.Flags().GetBool("unencoded-payload")
+	if err != nil {
+		return nil, err
+	}
+	embedJWK, err := cmd.Flags().GetBool("embed-jwk")
+	if err != nil {
+		return nil, err
+	}
+	jku, err := cmd.Flags().GetString("jku")
+	if err != nil {
+		return nil, err
+	}
+	x5u, err := cmd.Flags().GetString("x5u")
+	if err != nil {
+		return nil, err
+	}
+	x5c, err := cmd.Flags().GetString("x5c")
+	if err != nil {
+		return nil, err
+	}
 
 	inputFilePath := ""
 	if len(args) != 0 {
@@ -170,12 +301,25 @@ func newJWSSigner(cmd *cobra.Command, args []string) (*jwsSigner, error) {
 	}
 
 	return &jwsSigner{
-		Algorithm:     algorithm,
-		Key:           key,
-		KeyFormat:     keyFormat,
-		Header:        header,
-		InputFilePath: inputFilePath,
-		Output:        output,
+		Algorithms:        algorithms,
+		Keys:              keys,
+		KeyFormat:         keyFormat,
+		KeyPasswordFile:   keyPasswordFile,
+		Alias:             alias,
+		EntryPasswordFile: entryPasswordFile,
+		Header:            header,
+		HeaderFile:        headerFile,
+		SetHeaders:        setHeaders,
+		UnprotectedHeader: unprotectedHeader,
+		Serialization:     serialization,
+		Detached:          detached,
+		UnencodedPayload:  unencodedPayload,
+		EmbedJWK:          embedJWK,
+		JKU:               jku,
+		X5U:               x5u,
+		X5C:               x5c,
+		InputFilePath:     inputFilePath,
+		Output:            output,
 	}, nil
 }
 
@@ -184,22 +328,50 @@ func (j *jwsSigner) valid() error {
 	if err := validate.Struct(j); err != nil {
 		var e error
 		for _, v := range err.(validator.ValidationErrors) {
-			filedName := v.Field()
+			// Elements of Algorithms and Keys are reported as "Keys[1]".
+			filedName, _, _ := strings.Cut(v.Field(), "[")
 
 			switch filedName {
-			case "Algorithm":
+			case "Algorithms":
 				e = errors.Join(e, ErrInvalidAlgorithm)
-			case "Key":
+			case "Keys":
 				e = errors.Join(e, ErrRequireKeyFile)
 			case "KeyFormat":
 				e = errors.Join(e, ErrInvalidKeyFormat)
+			case "Serialization":
+				e = errors.Join(e, ErrInvalidSerialization)
+			case "JKU", "X5U":
+				e = errors.Join(e, ErrInvalidHeaderURL)
 			}
 		}
 		return e
 	}
+	// Without --algorithm the algorithms come from the keys of a single
+	// JWK set; otherwise every key needs its own algorithm.
+	if len(j.Algorithms) != 0 && len(j.Algorithms) != len(j.Keys) ||
+		len(j.Algorithms) == 0 && len(j.Keys) != 1 {
+		return wrap(ErrKeyAlgorithmPairs, fmt.Sprintf("%d --key, %d --algorithm", len(j.Keys), len(j.Algorithms)))
+	}
+	if len(j.Keys) > 1 && j.Serialization != "json" {
+		return ErrMultipleSignatures
+	}
+	if j.UnprotectedHeader != "" && !j.jsonSerialization() {
+		return ErrUnprotectedHeaderInCompact
+	}
+	for _, assignment := range j.SetHeaders {
+		if !validHeaderAssignment(assignment) {
+			return wrap(ErrInvalidSetHeader, assignment)
+		}
+	}
 	return nil
 }
 
+// jsonSerialization reports whether the message is written in one of the JWS
+// JSON serializations rather than the compact one.
+func (j *jwsSigner) jsonSerialization() bool {
+	return j.Serialization == "json" || j.Serialization == "flattened"
+}
+
 func runJWSSign(cmd *cobra.Command, args []string) error {
 	jwsSigner, err := newJWSSigner(cmd, args)
 	if err != nil {
@@ -214,34 +386,73 @@ func runJWSSign(cmd *cobra.Command, args []string) error {
 }
 
 func (j *jwsSigner) signer() error {
-	buf, err := readInput(j.InputFilePath)
-	if err != nil {
-		return err
+	var buf []byte
+	if !j.Detached {
+		// A detached payload is read, or streamed, once the keys are known.
+		b, err := readInput(j.InputFilePath)
+		if err != nil {
+			return err
+		}
+		buf = b
 	}
 
-	keyset, err := getKeyFile(j.Key, j.KeyFormat)
+	signers, err := j.signingKeys()
 	if err != nil {
 		return err
 	}
-	if keyset.Len() != 1 {
-		return ErrNotContainKey
+	if j.X5C != "" {
+		if j.chain, err = readCertificates(j.X5C); err != nil {
+			return err
+		}
+	}
+	if len(signers) > 1 && j.Serialization != "json" {
+		return ErrMultipleSignatures
 	}
-	key, _ := keyset.Key(0)
 
-	alg, ok := jwa.LookupSignatureAlgorithm(j.Algorithm)
-	if !ok {
-		return wrap(ErrInvalidAlgorithm, "input value="+j.Algorithm)
+	for _, s := range signers {
+		if err := checkSignatureKey(s.alg.String(), s.key); err != nil {
+			return err
+		}
 	}
 
-	opts, err := j.signOptions(alg, key)
-	if err != nil {
-		return err
+	var opts []jws.SignOption
+	for _, s := range signers {
+		if len(signers) > 1 {
+			if err := setThumbprintKeyID(s.key); err != nil {
+				return err
+			}
+		}
+		o, err := j.signOptions(s.alg, s.key)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, o...)
 	}
 
+	if j.jsonSerialization() {
+		opts = append(opts, jws.WithJSON())
+	}
+	if j.Detached {
+		// jws.Sign takes a detached payload through the option and a nil
+		// payload argument.
+		payload, err := j.detachedPayload(signers)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = payload.Close()
+		}()
+		opts = append(opts, payload.option)
+	}
 	signed, err := jws.Sign(buf, opts...)
 	if err != nil {
 		return wrap(ErrSignPayload, err.Error())
 	}
+	if j.jsonSerialization() {
+		if signed, err = j.jsonJWS(signed); err != nil {
+			return err
+		}
+	}
 
 	output, err := openOutputFile(j.Output)
 	if err != nil {
@@ -258,14 +469,121 @@ func (j *jwsSigner) signer() error {
 	return nil
 }
 
+// signingKey is one signature to produce: a key and the algorithm it signs
+// with.
+type signingKey struct {
+	key jwk.Key
+	alg jwa.SignatureAlgorithm
+}
+
+// signingKeys loads the keys to sign with. With --algorithm every --key file
+// holds one key that signs with the algorithm at the same position. Without
+// it, the single --key file is a JWK set of several keys that each name their
+// algorithm in "alg".
+func (j *jwsSigner) signingKeys() ([]signingKey, error) {
+	if len(j.Algorithms) == 0 {
+		keyset, err := j.keySource(j.Keys[0]).load()
+		if err != nil {
+			return nil, err
+		}
+		if keyset.Len() < 2 {
+			return nil, wrap(ErrInvalidAlgorithm, "--algorithm is required unless --key is a JWK set of several keys that all carry alg")
+		}
+		signers := make([]signingKey, 0, keyset.Len())
+		for i, key := range keyset.All() {
+			name := ""
+			if v, ok := key.Algorithm(); ok {
+				name = v.String()
+			}
+			alg, ok := jwa.LookupSignatureAlgorithm(name)
+			if !ok || !contains(supportedSignatureAlgorithms(), name) {
+				return nil, wrap(ErrInvalidAlgorithm, fmt.Sprintf("key %d of %s has alg %q", i, j.Keys[0], name))
+			}
+			signers = append(signers, signingKey{key: key, alg: alg})
+		}
+		return signers, nil
+	}
+
+	signers := make([]signingKey, 0, len(j.Keys))
+	for i, path := range j.Keys {
+		keyset, err := j.keySource(path).load()
+		if err != nil {
+			return nil, err
+		}
+		if keyset.Len() != 1 {
+			return nil, wrap(ErrNotContainKey, path)
+		}
+		key, _ := keyset.Key(0)
+
+		name := j.Algorithms[i]
+		if name == algorithmFromKey {
+			if name, err = algorithmOfKeys(keyset); err != nil {
+				return nil, wrap(err, path)
+			}
+		}
+		alg, ok := jwa.LookupSignatureAlgorithm(name)
+		if !ok {
+			return nil, wrap(ErrInvalidAlgorithm, "input value="+name)
+		}
+		signers = append(signers, signingKey{key: key, alg: alg})
+	}
+	return signers, nil
+}
+
+func (j *jwsSigner) keySource(path string) keySource {
+	return keySource{
+		Path:              path,
+		Format:            j.KeyFormat,
+		PasswordFile:      j.KeyPasswordFile,
+		Alias:             j.Alias,
+		EntryPasswordFile: j.EntryPasswordFile,
+	}
+}
+
+// setThumbprintKeyID gives a key without kid its RFC 7638 thumbprint as kid,
+// so that every signature of a multi-signature message names its key.
+func setThumbprintKeyID(key jwk.Key) error {
+	if kid, ok := key.KeyID(); ok && kid != "" {
+		return nil
+	}
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	if err := key.Set(jwk.KeyIDKey, base64.RawURLEncoding.EncodeToString(thumbprint)); err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	return nil
+}
+
 func (j *jwsSigner) signOptions(alg jwa.KeyAlgorithm, key interface{}) ([]jws.SignOption, error) {
 	// v4 moved protected headers into a sub-option of WithKey instead of a
 	// standalone SignOption.
 	var subopts []jws.WithKeySuboption
-	if j.Header != "" {
-		h := jws.NewHeaders()
-		if err := json.Unmarshal([]byte(j.Header), h); err != nil {
-			return nil, wrap(ErrParseHeader, err.Error())
+	members, err := j.headerMembers()
+	if err != nil {
+		return nil, err
+	}
+	if len(members) != 0 || j.UnencodedPayload || j.embedsKey() {
+		h, err := protectedHeaders(members, alg)
+		if err != nil {
+			return nil, err
+		}
+		if j.UnencodedPayload {
+			// RFC 7797 requires "b64" in "crit". jws.Sign adds it to an
+			// in-memory payload but not to a streamed one, so list it here.
+			if err := h.Set(jws.B64Key, false); err != nil {
+				return nil, wrap(ErrParseHeader, err.Error())
+			}
+			crit, _ := h.Critical()
+			if !contains(crit, jws.B64Key) {
+				if err := h.Set(jws.CriticalKey, append(crit, jws.B64Key)); err != nil {
+					return nil, wrap(ErrParseHeader, err.Error())
+				}
+			}
+		}
+		if err := j.embedKey(h, key); err != nil {
+			return nil, err
 		}
 		subopts = append(subopts, jws.WithProtectedHeaders(h))
 	}
@@ -273,12 +591,110 @@ func (j *jwsSigner) signOptions(alg jwa.KeyAlgorithm, key interface{}) ([]jws.Si
 	return []jws.SignOption{jws.WithKey(alg, key, subopts...)}, nil
 }
 
+// jsonJWS completes the JWS JSON serialization that jws.Sign produces, which
+// is flattened for a single signature and general for several: it adds the
+// unprotected header to every signature and writes the form --serialization
+// asks for.
+//
+// The unprotected header is added here rather than through
+// jws.WithPublicHeaders because jwx signs over the protected and unprotected
+// members merged, which no verifier reproduces. It is not integrity protected,
+// so adding it after signing is what RFC 7515 describes.
+func (j *jwsSigner) jsonJWS(signed []byte) ([]byte, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(signed, &members); err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+
+	var signatures []map[string]json.RawMessage
+	if raw, ok := members["signatures"]; ok {
+		if err := json.Unmarshal(raw, &signatures); err != nil {
+			return nil, wrap(ErrSignPayload, err.Error())
+		}
+	} else {
+		signature := make(map[string]json.RawMessage, 3)
+		for _, name := range []string{"protected", "header", "signature"} {
+			if v, ok := members[name]; ok {
+				signature[name] = v
+				delete(members, name)
+			}
+		}
+		signatures = append(signatures, signature)
+	}
+
+	if j.UnprotectedHeader != "" {
+		for _, signature := range signatures {
+			if err := j.addUnprotectedHeader(signature); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if j.Serialization == "json" {
+		raw, err := json.Marshal(signatures)
+		if err != nil {
+			return nil, wrap(ErrSignPayload, err.Error())
+		}
+		members["signatures"] = raw
+	} else {
+		delete(members, "signatures")
+		for name, v := range signatures[0] {
+			members[name] = v
+		}
+	}
+
+	out, err := json.Marshal(members)
+	if err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+	return out, nil
+}
+
+// addUnprotectedHeader sets the "header" member of one signature object.
+func (j *jwsSigner) addUnprotectedHeader(signature map[string]json.RawMessage) error {
+	var unprotected, protected map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(j.UnprotectedHeader), &unprotected); err != nil {
+		return wrap(ErrParseHeader, err.Error())
+	}
+	if unprotected == nil {
+		return wrap(ErrParseHeader, "the unprotected header must be a JSON object")
+	}
+	// RFC 7515 section 4.1.11 and RFC 7797 section 3: crit and b64 change how
+	// the signature is checked, so they must be integrity protected.
+	for _, name := range []string{"crit", "b64"} {
+		if _, ok := unprotected[name]; ok {
+			return wrap(ErrParseHeader, fmt.Sprintf("%q must be in the protected header", name))
+		}
+	}
+	var encoded string
+	if err := json.Unmarshal(signature["protected"], &encoded); err != nil {
+		return wrap(ErrSignPayload, err.Error())
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return wrap(ErrSignPayload, err.Error())
+	}
+	if err := json.Unmarshal(decoded, &protected); err != nil {
+		return wrap(ErrSignPayload, err.Error())
+	}
+	// RFC 7515 section 7.2.1: the protected and unprotected header parameter
+	// names must be disjoint.
+	for name := range unprotected {
+		if _, ok := protected[name]; ok {
+			return wrap(ErrParseHeader, fmt.Sprintf("%q is in both the protected and the unprotected header", name))
+		}
+	}
+	signature["header"] = json.RawMessage(j.UnprotectedHeader)
+	return nil
+}
+
 func newJWSVerifyCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "verify",
 		Short: "Verify JWS messages",
 		Long: `Parses a JWS message in FILE, and verifies using the specified method.
-Use "-" as FILE to read from STDIN.
+Use "-" as FILE to read from STDIN. The message may use the compact, general
+JSON or flattened JSON serialization.
 
 By default the user is responsible for providing the algorithm to
 use to verify the signature. This is because we can not safely rely
@@ -303,26 +719,129 @@ either "alg" or "kid"
 
   { "typ": "oct", "kid": "mykey", .... }
   { "typ": "oct", "alg": "H256",  .... }
+
+--algorithm from-key takes the algorithm from the "alg" of the keys in --key,
+which must all declare the same one, and never from the message.
+
+--allow-alg ALG (repeatable) sits between the two: the key is the one whose
+kid is the kid of the signature, and the header alg must be one of the
+--allow-alg values and the "alg" of that key, which must fit it. An issuer
+that moves from RS256 to ES256 is accepted with --allow-alg RS256 --allow-alg
+ES256 and a key set that holds both keys. It cannot be combined with
+--algorithm or --match-kid.
+
+Before verifying, at least one key must fit the algorithm, as for jws sign:
+the key type and curve, an RSA modulus of at least 2048 bits, an HMAC secret
+as long as the hash and not a public key. Otherwise the mismatch of every key
+is reported.
+
+A message can carry several signatures. By default it verifies when any
+signature verifies with any key. --require checks every signature on its
+own and succeeds only when the policy holds: "any" signature, "all"
+signatures, or N signatures made by N different keys. With --explain it also
+reports which key verified each signature.
+
+A message signed with a detached payload ("header..signature", or JSON
+without "payload") is verified against the payload in --payload FILE, "-"
+for STDIN. The payload is then not printed again.
+
+--result-json writes a JSON document instead of the payload: "verified", the
+algorithm, kid and RFC 7638 thumbprint of the verifying key, the protected
+header, the payload (as JSON when it is JSON, otherwise base64 in
+"payload_base64") and one entry per signature. The exit status still tells
+whether verification succeeded.
+
+A "crit" header must name extensions jose understands: "b64" and those
+listed with --understood-crit. Messages whose "crit" lists anything else, or
+breaks RFC 7515 4.1.11 (not a non-empty list in the protected header of
+extensions present there), are rejected.
+
+--expect-typ and --expect-cty require the protected header to carry that
+"typ" or "cty", compared case-insensitively with "application/" implied as
+RFC 7515 asks. --expect-kid requires a kid from the given list, and
+--expect-header NAME=VALUE a member equal to VALUE, read as JSON when it
+parses as JSON (2, true, "2") and as a string otherwise. Every signature must
+meet them; each mismatch is reported.
+
+Keys embedded in the protected header are ignored, with a warning, unless
+trusted explicitly: --pin THUMBPRINT trusts a "jwk" whose RFC 7638 SHA-256
+thumbprint it names, and --ca-bundle FILE trusts the certificate of an "x5c"
+chain that validates against the PEM certificates in FILE. A trusted key is
+tried like a key of --key, which may then be omitted, and --explain reports
+it. "jku" and "x5u" are never fetched.
+
+--batch reads one token per line of FILE (blank lines are skipped) and
+verifies them on --jobs workers, by default one per CPU, against the key set
+of --key loaded once. It writes one JSON line per token, in input order: the
+"line" of the token and the fields of --result-json. The exit status is 1
+when any token fails. --batch cannot be combined with --payload, --explain,
+--result-json, --pin or --ca-bundle.
+
+--explain writes a report to STDERR that lists, for every signature and
+every key, whether the header alg matches, whether the kid matches, whether
+the key type and curve can make that signature, whether the key is public or
+private, and what the signature check itself said.
 `,
 		RunE: runJWSVerify,
 	}
 
-	cmd.Flags().StringP("algorithm", "a", "", "signature algorithm (required, e.g. ES256, RS256, HS256, EdDSA)")
-	cmd.Flags().StringP("key", "k", "", "file name that contains the key to use. single JWK or JWK set")
-	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem)")
+	cmd.Flags().StringP("algorithm", "a", "", "signature algorithm (required, e.g. ES256, RS256, HS256, EdDSA, or from-key for the alg of the keys)")
+	cmd.Flags().StringP("key", "k", "", "file name that contains the key to use. single JWK or JWK set, or keystore:<name>")
+	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem/p12/jks)")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
 	cmd.Flags().BoolP("match-kid", "m", false, "instead of using alg, attempt to verify only if the key ID (kid) matches")
+	cmd.Flags().StringArray("allow-alg", nil, "select the key by kid and accept this header alg when the key has the same alg; repeatable")
+	cmd.Flags().String("require", "", "signatures that must verify: any, all, or a number of different keys")
+	cmd.Flags().Bool("result-json", false, "write the verification result as JSON instead of the payload")
+	cmd.Flags().Bool("explain", false, "report to STDERR why each key does or does not verify each signature")
+	cmd.Flags().String("payload", "", "file that holds the detached payload (\"-\" for STDIN)")
+	cmd.Flags().StringSlice("understood-crit", nil, "crit header extensions the caller understands (comma-separated or repeated)")
+	cmd.Flags().String("expect-typ", "", "require this typ in the protected header (e.g. JWT)")
+	cmd.Flags().String("expect-cty", "", "require this cty in the protected header")
+	cmd.Flags().StringSlice("expect-kid", nil, "require a kid from this list in the protected header")
+	cmd.Flags().StringArray("expect-header", nil, "require NAME=VALUE in the protected header; repeatable")
+	cmd.Flags().StringArray("pin", nil, "trust an embedded jwk with this base64url SHA-256 thumbprint; repeatable")
+	cmd.Flags().String("ca-bundle", "", "PEM file of CA certificates that an embedded x5c chain must validate against")
+	cmd.Flags().Bool("batch", false, "verify one token per line of FILE and write one JSON result per line")
+	cmd.Flags().Int("jobs", 0, "tokens --batch verifies at once (default: the number of CPUs)")
 	cmd.Flags().StringP("output", "o", "-", "output to file")
 
 	return cmd
 }
 
 type jwsVerifier struct {
-	Algorithm     string `validate:"required_without=MatchKeyID,omitempty,oneof=ES256 ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512"`
-	Key           string `validate:"required"`
-	KeyFormat     string `validate:"oneof=json pem"`
-	MatchKeyID    bool   `validate:"-"`
-	InputFilePath string `validate:"-"`
-	Output        string `validate:"-"`
+	Algorithm         string   `validate:"omitempty,oneof=ES256 ES256K ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512 from-key"`
+	Key               string   `validate:"-"`
+	KeyFormat         string   `validate:"oneof=json pem p12 jks"`
+	KeyPasswordFile   string   `validate:"-"`
+	Alias             string   `validate:"-"`
+	EntryPasswordFile string   `validate:"-"`
+	MatchKeyID        bool     `validate:"-"`
+	AllowAlgs         []string `validate:"dive,oneof=ES256 ES256K ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512"`
+	Require           string   `validate:"-"`
+	Payload           string   `validate:"-"`
+	Explain           bool     `validate:"-"`
+	ResultJSON        bool     `validate:"-"`
+	UnderstoodCrit    []string `validate:"dive,required"`
+	ExpectTyp         string   `validate:"-"`
+	ExpectCty         string   `validate:"-"`
+	ExpectKid         []string `validate:"dive,required"`
+	ExpectHeaders     []string `validate:"-"`
+	Pins              []string `validate:"-"`
+	CABundle          string   `validate:"-"`
+	Batch             bool     `validate:"-"`
+	Jobs              int      `validate:"gte=0"`
+	InputFilePath     string   `validate:"-"`
+	Output            string   `validate:"-"`
+
+	// detached is the payload read from Payload, and payload the stream of
+	// Payload when it is not read into memory.
+	detached []byte
+	payload  io.Reader
+	// stderr receives the --explain report; nil means standard error.
+	stderr io.Writer
 }
 
 func newJWSVerifier(cmd *cobra.Command, args []string) (*jwsVerifier, error) {
@@ -340,11 +859,79 @@ func newJWSVerifier(cmd *cobra.Command, args []string) (*jwsVerifier, error) {
 	if err != nil {
 		return nil, err
 	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return nil, err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return nil, err
+	}
 
 	matchKeyID, err := cmd.Flags().GetBool("match-kid")
 	if err != nil {
 		return nil, err
 	}
+	allowAlgs, err := cmd.Flags().GetStringArray("allow-alg")
+	if err != nil {
+		return nil, err
+	}
+	require, err := cmd.Flags().GetString("require")
+	if err != nil {
+		return nil, err
+	}
+	payload, err := cmd.Flags().GetString("payload")
+	if err != nil {
+		return nil, err
+	}
+	explain, err := cmd.Flags().GetBool("explain")
+	if err != nil {
+		return nil, err
+	}
+	resultJSON, err := cmd.Flags().GetBool("result-json")
+	if err != nil {
+		return nil, err
+	}
+	understoodCrit, err := cmd.Flags().GetStringSlice("understood-crit")
+	if err != nil {
+		return nil, err
+	}
+	expectTyp, err := cmd.Flags().GetString("expect-typ")
+	if err != nil {
+		return nil, err
+	}
+	expectCty, err := cmd.Flags().GetString("expect-cty")
+	if err != nil {
+		return nil, err
+	}
+	expectKid, err := cmd.Flags().GetStringSlice("expect-kid")
+	if err != nil {
+		return nil, err
+	}
+	expectHeaders, err := cmd.Flags().GetStringArray("expect-header")
+	if err != nil {
+		return nil, err
+	}
+	pins, err := cmd.Flags().GetStringArray("pin")
+	if err != nil {
+		return nil, err
+	}
+	caBundle, err := cmd.Flags().GetString("ca-bundle")
+	if err != nil {
+		return nil, err
+	}
+	batch, err := cmd.Flags().GetBool("batch")
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return nil, err
+	}
 
 	inputFilePath := ""
 	if len(args) != 0 {
@@ -357,33 +944,91 @@ func newJWSVerifier(cmd *cobra.Command, args []string) (*jwsVerifier, error) {
 	}
 
 	return &jwsVerifier{
-		Algorithm:     algorithm,
-		Key:           key,
-		KeyFormat:     keyFormat,
-		MatchKeyID:    matchKeyID,
-		InputFilePath: inputFilePath,
-		Output:        output,
+		Algorithm:         algorithm,
+		Key:               key,
+		KeyFormat:         keyFormat,
+		KeyPasswordFile:   keyPasswordFile,
+		Alias:             alias,
+		EntryPasswordFile: entryPasswordFile,
+		MatchKeyID:        matchKeyID,
+		AllowAlgs:         allowAlgs,
+		Require:           require,
+		Payload:           payload,
+		Explain:           explain,
+		ResultJSON:        resultJSON,
+		UnderstoodCrit:    understoodCrit,
+		ExpectTyp:         expectTyp,
+		ExpectCty:         expectCty,
+		ExpectKid:         expectKid,
+		ExpectHeaders:     expectHeaders,
+		Pins:              pins,
+		CABundle:          caBundle,
+		Batch:             batch,
+		Jobs:              jobs,
+		InputFilePath:     inputFilePath,
+		Output:            output,
 	}, nil
 }
 
 func (j *jwsVerifier) valid() error {
 	validate := validator.New()
+	var e error
 	if err := validate.Struct(j); err != nil {
-		var e error
 		for _, v := range err.(validator.ValidationErrors) {
-			filedName := v.Field()
+			// Elements of UnderstoodCrit are reported as "UnderstoodCrit[0]".
+			filedName, _, _ := strings.Cut(v.Field(), "[")
 
 			switch filedName {
-			case "Algorithm":
+			case "Algorithm", "AllowAlgs":
 				e = errors.Join(e, ErrInvalidAlgorithm)
-			case "Key":
-				e = errors.Join(e, ErrRequireKeyFile)
+			case "UnderstoodCrit":
+				e = errors.Join(e, ErrInvalidUnderstoodCrit)
+			case "ExpectKid":
+				e = errors.Join(e, ErrInvalidExpectKid)
 			case "KeyFormat":
 				e = errors.Join(e, ErrInvalidKeyFormat)
+			case "Jobs":
+				e = errors.Join(e, ErrInvalidJobs)
 			}
 		}
+	}
+	// Without --algorithm the keys name the algorithm, under --match-kid or
+	// --allow-alg.
+	if j.Algorithm == "" && !j.MatchKeyID && len(j.AllowAlgs) == 0 {
+		e = errors.Join(e, ErrInvalidAlgorithm)
+	}
+	// The keys may all come from the message, trusted by --pin or
+	// --ca-bundle.
+	if j.Key == "" && len(j.Pins) == 0 && j.CABundle == "" {
+		e = errors.Join(e, ErrRequireKeyFile)
+	}
+	if e != nil {
 		return e
 	}
+	for _, pin := range j.Pins {
+		if !validPin(pin) {
+			return wrap(ErrInvalidPin, pin)
+		}
+	}
+	for _, expected := range j.ExpectHeaders {
+		if !validHeaderAssignment(expected) {
+			return wrap(ErrInvalidExpectHeader, expected)
+		}
+	}
+	if len(j.AllowAlgs) != 0 && (j.Algorithm != "" || j.MatchKeyID) {
+		return ErrAllowAlgConflict
+	}
+	if !validRequire(j.Require) {
+		return wrap(ErrInvalidRequire, j.Require)
+	}
+	if j.Batch {
+		if flag := j.batchConflicts(); flag != "" {
+			return wrap(ErrBatchConflict, flag)
+		}
+	}
+	if j.Payload == "-" && (j.InputFilePath == "" || j.InputFilePath == "-") {
+		return ErrPayloadAndMessageFromStdin
+	}
 	return nil
 }
 
@@ -400,15 +1045,41 @@ func runJWSVerify(cmd *cobra.Command, args []string) error {
 }
 
 func (j *jwsVerifier) verify() error {
-	buf, err := readCompactJWS(j.InputFilePath)
+	if j.Batch {
+		return j.verifyBatchInput()
+	}
+	buf, err := readJWSMessage(j.InputFilePath)
 	if err != nil {
 		return err
 	}
 
-	keyset, err := getKeyFile(j.Key, j.KeyFormat)
+	keyset := jwk.NewSet()
+	if j.Key != "" {
+		if keyset, err = j.keySource().load(); err != nil {
+			return err
+		}
+	}
+	if err := j.resolveAlgorithm(keyset); err != nil {
+		return err
+	}
+	embedded, err := j.embeddedKeys(buf)
 	if err != nil {
 		return err
 	}
+	for _, key := range embedded.All() {
+		if err := keyset.AddKey(key); err != nil {
+			return wrap(ErrParseKey, err.Error())
+		}
+	}
+	if j.Payload != "" {
+		payload, err := j.openPayload(buf, keyset)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = payload.Close()
+		}()
+	}
 
 	output, err := openOutputFile(j.Output)
 	if err != nil {
@@ -420,10 +1091,50 @@ func (j *jwsVerifier) verify() error {
 		}
 	}()
 
+	if j.Explain {
+		if err := j.explain(j.explainOutput(), buf, keyset); err != nil {
+			return err
+		}
+	}
+	if err := j.checkKeys(keyset); err != nil {
+		return err
+	}
 	return j.writeVerifyResult(output, buf, keyset)
 }
 
+// checkKeys fails when no key of keyset can check a signature made with
+// --algorithm. With --match-kid every key brings its own algorithm and is
+// checked against it once a kid selects it.
+func (j *jwsVerifier) checkKeys(keyset jwk.Set) error {
+	if j.MatchKeyID || j.Algorithm == "" {
+		return nil
+	}
+	return checkVerificationKeys(j.Algorithm, keyset)
+}
+
+func (j *jwsVerifier) keySource() keySource {
+	return keySource{
+		Path:              j.Key,
+		Format:            j.KeyFormat,
+		PasswordFile:      j.KeyPasswordFile,
+		Alias:             j.Alias,
+		EntryPasswordFile: j.EntryPasswordFile,
+	}
+}
+
 func (j *jwsVerifier) writeVerifyResult(w io.Writer, jwsMessage []byte, keyset jwk.Set) error {
+	if !j.suppliesPayload() && hasDetachedPayload(jwsMessage) {
+		return ErrRequireDetachedPayload
+	}
+	if j.ResultJSON {
+		return j.writeResultJSON(w, jwsMessage, keyset)
+	}
+	if err := j.checkHeaders(jwsMessage); err != nil {
+		return err
+	}
+	if j.Require != "" {
+		return j.writePolicyResult(w, jwsMessage, keyset)
+	}
 	if j.MatchKeyID {
 		// A JWS message signed with a private key must be verified with the
 		// corresponding public key. When the user supplies a private JWK (the
@@ -435,11 +1146,19 @@ func (j *jwsVerifier) writeVerifyResult(w io.Writer, jwsMessage []byte, keyset j
 			return wrap(ErrVerifyJWSMessage, err.Error())
 		}
 
-		payload, err := jws.Verify(jwsMessage, jws.WithKeySet(pubset))
+		payload, err := j.verifyByKid(jwsMessage, pubset, kidKey)
 		if err != nil {
-			return wrap(ErrVerifyJWSMessage, err.Error())
+			return err
+		}
+		j.writePayload(w, payload)
+		return nil
+	}
+	if len(j.AllowAlgs) != 0 {
+		payload, err := j.verifyAllowed(jwsMessage, keyset)
+		if err != nil {
+			return err
 		}
-		fmt.Fprintf(w, "%s", payload)
+		j.writePayload(w, payload)
 		return nil
 	}
 
@@ -458,6 +1177,12 @@ func (j *jwsVerifier) writeVerifyResult(w io.Writer, jwsMessage []byte, keyset j
 	// error when none of them do.
 	var lastErr error
 	for _, key := range keyset.All() {
+		// checkKeys only asks that one key of the set fits; a key that does
+		// not must not verify either.
+		if err := checkSignatureKey(alg.String(), key); err != nil {
+			lastErr = err
+			continue
+		}
 		// Verify with the public key. PublicKeyOf returns the key as-is for
 		// symmetric keys and the public counterpart for private keys, so a
 		// self-signed message created from a private JWK verifies correctly.
@@ -467,12 +1192,12 @@ func (j *jwsVerifier) writeVerifyResult(w io.Writer, jwsMessage []byte, keyset j
 			continue
 		}
 
-		payload, err := jws.Verify(jwsMessage, jws.WithKey(alg, pubkey))
+		payload, err := jws.Verify(jwsMessage, j.verifyOptions(jws.WithKey(alg, pubkey))...)
 		if err != nil {
 			lastErr = wrap(ErrVerifyJWSMessage, err.Error())
 			continue
 		}
-		fmt.Fprintf(w, "%s", payload)
+		j.writePayload(w, payload)
 		return nil
 	}
 
@@ -481,3 +1206,26 @@ func (j *jwsVerifier) writeVerifyResult(w io.Writer, jwsMessage []byte, keyset j
 	}
 	return lastErr
 }
+
+// verifyOptions completes the key option of a jws.Verify call: jose
+// understands the "b64" header parameter (RFC 7797) and the extensions of
+// --understood-crit, and a detached payload is passed along.
+func (j *jwsVerifier) verifyOptions(keyOption jws.VerifyOption) []jws.VerifyOption {
+	opts := []jws.VerifyOption{keyOption, jws.WithCritExtension(j.understoodCriticalOf()...)}
+	switch {
+	case j.payload != nil:
+		opts = append(opts, jws.WithDetachedPayloadReader(j.payload))
+	case j.detached != nil:
+		opts = append(opts, jws.WithDetachedPayload(j.detached))
+	}
+	return opts
+}
+
+// writePayload prints the verified payload unless the user supplied it as a
+// detached payload and already has it.
+func (j *jwsVerifier) writePayload(w io.Writer, payload []byte) {
+	if j.suppliesPayload() {
+		return
+	}
+	fmt.Fprintf(w, "%s", payload)
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// allowedKey returns the key of keyset that --allow-alg selects for a
+// signature whose protected header names alg and kid: the key with that kid,
+// provided alg is allowed, is the "alg" of the key, and the key fits it.
+func (j *jwsVerifier) allowedKey(alg, kid string, keyset jwk.Set) (jwk.Key, error) {
+	switch {
+	case !contains(j.AllowAlgs, alg):
+		return nil, wrap(ErrAlgorithmNotAllowed, fmt.Sprintf("alg %s is not one of %s", orNone(alg), strings.Join(j.AllowAlgs, ", ")))
+	case kid == "":
+		return nil, wrap(ErrAlgorithmNotAllowed, "the header has no kid to select the key by")
+	}
+	key, ok := keyset.LookupKeyID(kid)
+	if !ok {
+		return nil, wrap(ErrAlgorithmNotAllowed, fmt.Sprintf("no key has kid %q", kid))
+	}
+	keyAlg := ""
+	if v, ok := key.Algorithm(); ok {
+		keyAlg = v.String()
+	}
+	if keyAlg != alg {
+		return nil, wrap(ErrAlgorithmNotAllowed, fmt.Sprintf("key %q has alg %s, the header has %s", kid, orNone(keyAlg), alg))
+	}
+	if err := checkSignatureKey(alg, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// kidKey returns the key of keyset that --match-kid selects for a signature
+// whose protected header names alg and kid: the key with that kid, provided
+// its "alg" is alg and it fits alg.
+func kidKey(alg, kid string, keyset jwk.Set) (jwk.Key, error) {
+	if kid == "" {
+		return nil, wrap(ErrVerifyJWSMessage, "the header has no kid to select the key by")
+	}
+	key, ok := keyset.LookupKeyID(kid)
+	if !ok {
+		return nil, wrap(ErrVerifyJWSMessage, fmt.Sprintf("no key has kid %q", kid))
+	}
+	keyAlg := ""
+	if v, ok := key.Algorithm(); ok {
+		keyAlg = v.String()
+	}
+	if keyAlg != alg {
+		return nil, wrap(ErrVerifyJWSMessage, fmt.Sprintf("key %q has alg %s, the header has %s", kid, orNone(keyAlg), orNone(alg)))
+	}
+	if err := checkSignatureKey(alg, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// verifyAllowed verifies jwsMessage under --allow-alg with the key allowedKey
+// selects for each signature.
+func (j *jwsVerifier) verifyAllowed(jwsMessage []byte, keyset jwk.Set) ([]byte, error) {
+	pubset, err := jwk.PublicSetOf(keyset, jwk.WithAllowSymmetric(true))
+	if err != nil {
+		return nil, wrap(ErrVerifyJWSMessage, err.Error())
+	}
+	return j.verifyByKid(jwsMessage, pubset, j.allowedKey)
+}
+
+// verifyByKid verifies jwsMessage with the key selectKey picks from pubset
+// for each signature; the reasons a signature got no key are reported when
+// verification fails.
+func (j *jwsVerifier) verifyByKid(jwsMessage []byte, pubset jwk.Set, selectKey func(alg, kid string, keyset jwk.Set) (jwk.Key, error)) ([]byte, error) {
+	var rejected []error
+	provider := jws.KeyProviderFunc(func(_ context.Context, sink jws.KeySink, sig *jws.Signature, _ *jws.Message) error {
+		alg, kid := "", ""
+		if v, ok := sig.ProtectedHeaders().Algorithm(); ok {
+			alg = v.String()
+		}
+		if v, ok := sig.ProtectedHeaders().KeyID(); ok {
+			kid = v
+		}
+		key, err := selectKey(alg, kid, pubset)
+		if err != nil {
+			rejected = append(rejected, err)
+			return nil
+		}
+		sigAlg, _ := jwa.LookupSignatureAlgorithm(alg)
+		sink.Key(sigAlg, key)
+		return nil
+	})
+	payload, err := jws.Verify(jwsMessage, j.verifyOptions(jws.WithKeyProvider(provider))...)
+	if err != nil {
+		if len(rejected) != 0 {
+			return nil, errors.Join(rejected...)
+		}
+		return nil, wrap(ErrVerifyJWSMessage, err.Error())
+	}
+	return payload, nil
+}
+
+// verifyAllowedWith verifies message under --allow-alg with key alone.
+func (j *jwsVerifier) verifyAllowedWith(message []byte, key jwk.Key) error {
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return err
+	}
+	_, err := j.verifyAllowed(message, set)
+	return err
+}
+
+// selectsKeyByKid reports whether the kid of a signature selects the key and
+// the key names the algorithm, as under --match-kid and --allow-alg.
+func (j *jwsVerifier) selectsKeyByKid() bool {
+	return j.MatchKeyID || len(j.AllowAlgs) != 0
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// keyWithKid writes the key of path with alg and kid set.
+func keyWithKid(t *testing.T, path, alg, kid string) string {
+	t.Helper()
+	key := keyOf(t, path)
+	if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Set(jwk.KeyIDKey, kid); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, kid+".jwk", string(data))
+}
+
+func TestJWSVerifyAllowAlg(t *testing.T) {
+	t.Parallel()
+
+	// An issuer that rotates from RS256 ("old") to ES256 ("new").
+	oldKey := keyWithKid(t, genKey(t, "RSA", "", 2048, "json", false), "RS256", "old")
+	newKey := keyWithKid(t, genKey(t, "EC", "P-256", 0, "json", false), "ES256", "new")
+	bare := genKey(t, "EC", "P-256", 0, "json", false)
+	keyset := keysOf(t, oldKey, newKey)
+	payload := writeFile(t, "payload.txt", "rotated")
+
+	tests := []struct {
+		name    string
+		message string
+		allow   []string
+		want    string
+	}{
+		{name: "old key", message: signWith(t, oldKey, "RS256", payload, ""), allow: []string{"RS256", "ES256"}},
+		{name: "new key", message: signWith(t, newKey, "ES256", payload, ""), allow: []string{"RS256", "ES256"}},
+		{name: "alg not allowed", message: signWith(t, oldKey, "RS256", payload, ""), allow: []string{"ES256"}, want: "alg RS256 is not one of ES256"},
+		{name: "no kid", message: signWith(t, bare, "ES256", payload, ""), allow: []string{"ES256"}, want: "the header has no kid"},
+		{name: "unknown kid", message: signWith(t, bare, "ES256", payload, `{"kid":"gone"}`), allow: []string{"ES256"}, want: `no key has kid "gone"`},
+		{name: "kid of a key with another alg", message: signWith(t, bare, "ES256", payload, `{"kid":"old"}`), allow: []string{"RS256", "ES256"}, want: `key "old" has alg RS256, the header has ES256`},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			v := &jwsVerifier{AllowAlgs: tt.allow}
+			var buf bytes.Buffer
+			err := v.writeVerifyResult(&buf, []byte(tt.message), keyset)
+			if tt.want == "" {
+				if err != nil || buf.String() != "rotated" {
+					t.Fatalf("got %q, %v", buf.String(), err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAlgorithmNotAllowed) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("want %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestJWSVerifyAllowAlgChecksTheKey(t *testing.T) {
+	t.Parallel()
+
+	// A 32-byte key that claims HS512, which needs 64 bytes. jose would not
+	// sign with it, so the token is made with jwx directly.
+	weakPath := octKeyFileWithKid(t, "HS512", "hmac")
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.KeyIDKey, "hmac"); err != nil {
+		t.Fatal(err)
+	}
+	message, err := jws.Sign([]byte("weak"), jws.WithKey(jwa.HS512(), keyOf(t, weakPath), jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, require := range []string{"", requireAny} {
+		var buf bytes.Buffer
+		err := (&jwsVerifier{AllowAlgs: []string{"HS512"}, Require: require}).writeVerifyResult(&buf, message, keysOf(t, weakPath))
+		want := ErrKeyAlgorithmMismatch
+		if require != "" {
+			want = ErrVerifyPolicy
+		}
+		if !errors.Is(err, want) || buf.Len() != 0 {
+			t.Errorf("require %q: want %v, got %q, %v", require, want, buf.String(), err)
+		}
+	}
+	_, err = (&jwsVerifier{AllowAlgs: []string{"HS512"}}).allowedKey("HS512", "hmac", keysOf(t, weakPath))
+	if !errors.Is(err, ErrKeyAlgorithmMismatch) || !strings.Contains(err.Error(), "HS512 needs an oct key of at least 64 bytes") {
+		t.Errorf("want the named mismatch, got %v", err)
+	}
+}
+
+func TestJWSVerifyAllowAlgResultJSON(t *testing.T) {
+	t.Parallel()
+
+	oldKey := keyWithKid(t, genKey(t, "RSA", "", 2048, "json", false), "RS256", "old")
+	newKey := keyWithKid(t, genKey(t, "EC", "P-256", 0, "json", false), "ES256", "new")
+	payload := writeFile(t, "payload.txt", `{"sub":"alice"}`)
+	message := signWith(t, newKey, "ES256", payload, "")
+
+	v := &jwsVerifier{AllowAlgs: []string{"RS256", "ES256"}, Require: requireAll}
+	doc, err := v.resultOf([]byte(message), keysOf(t, oldKey, newKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !doc.Verified || doc.Key == nil || doc.Key.Index != 1 || doc.Key.KeyID != "new" {
+		t.Errorf("want key 1 (new) to verify, got %+v", doc)
+	}
+}
+
+func TestJWSVerifyAllowAlgValidation(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	for _, tt := range []struct {
+		verifier jwsVerifier
+		want     error
+	}{
+		{jwsVerifier{AllowAlgs: []string{"ES256"}, Algorithm: "ES256"}, ErrAllowAlgConflict},
+		{jwsVerifier{AllowAlgs: []string{"ES256"}, MatchKeyID: true}, ErrAllowAlgConflict},
+		{jwsVerifier{AllowAlgs: []string{"none"}}, ErrInvalidAlgorithm},
+		{jwsVerifier{AllowAlgs: []string{algorithmFromKey}}, ErrInvalidAlgorithm},
+		{jwsVerifier{}, ErrInvalidAlgorithm},
+		{jwsVerifier{AllowAlgs: []string{"ES256", "RS256"}}, nil},
+	} {
+		v := tt.verifier
+		v.Key, v.KeyFormat = keyPath, "json"
+		v.InputFilePath = writeFile(t, "token.jws", "x")
+		if err := v.valid(); !errors.Is(err, tt.want) {
+			t.Errorf("%+v: want %v, got %v", tt.verifier, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// batchResult is one line of "jws verify --batch": the verifyResult of the
+// token on that line of the input.
+type batchResult struct {
+	Line int `json:"line"`
+	*verifyResult
+}
+
+// batchConflicts reports the first flag that --batch cannot be combined
+// with, or "" when there is none. A batch writes JSON lines of its own and
+// verifies every token against the key set of --key alone.
+func (j *jwsVerifier) batchConflicts() string {
+	switch {
+	case j.Payload != "":
+		return "--payload"
+	case j.Explain:
+		return "--explain"
+	case j.ResultJSON:
+		return "--result-json"
+	case len(j.Pins) != 0:
+		return "--pin"
+	case j.CABundle != "":
+		return "--ca-bundle"
+	}
+	return ""
+}
+
+// verifyBatchInput verifies every token of the input file against the key
+// set of --key, loaded once, and writes one JSON line per token.
+func (j *jwsVerifier) verifyBatchInput() (err error) {
+	keyset, err := j.keySource().load()
+	if err != nil {
+		return err
+	}
+	if err := j.resolveAlgorithm(keyset); err != nil {
+		return err
+	}
+	if err := j.checkKeys(keyset); err != nil {
+		return err
+	}
+	input, err := openInputFile(j.InputFilePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = input.Close()
+	}()
+
+	output, err := openOutputFile(j.Output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := output.Close(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}()
+	return j.verifyBatch(output, input, keyset)
+}
+
+// verifyBatch reads one token per line of r, skipping blank lines, verifies
+// the tokens on --jobs workers, and writes a batchResult line for each to w
+// in input order. It fails with ErrBatchVerify when any token does not
+// verify.
+func (j *jwsVerifier) verifyBatch(w io.Writer, r io.Reader, keyset jwk.Set) error {
+	type job struct {
+		line   int
+		token  []byte
+		result chan batchResult
+	}
+	workers := cmp.Or(j.Jobs, runtime.NumCPU())
+	jobs := make(chan job)
+	// pending holds the jobs in input order; its size bounds how far the
+	// workers run ahead of the writer.
+	pending := make(chan job, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Go(func() {
+			for jb := range jobs {
+				jb.result <- j.batchResultOf(jb.line, jb.token, keyset)
+			}
+		})
+	}
+
+	var scanErr error
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		scanner := bufio.NewScanner(r)
+		limit := maxInputSize
+		if limit <= 0 || limit > math.MaxInt32 {
+			limit = math.MaxInt32
+		}
+		scanner.Buffer(nil, int(limit))
+		line := 0
+		for scanner.Scan() {
+			line++
+			token := bytes.TrimSpace(scanner.Bytes())
+			if len(token) == 0 {
+				continue
+			}
+			jb := job{line: line, token: bytes.Clone(token), result: make(chan batchResult, 1)}
+			pending <- jb
+			jobs <- jb
+		}
+		if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+			scanErr = wrap(ErrInputTooLarge, fmt.Sprintf("line %d is more than %d bytes (raise --max-input-size)", line+1, limit))
+		} else if err != nil {
+			scanErr = wrap(ErrReadFile, err.Error())
+		}
+	}()
+
+	var writeErr error
+	total, failed := 0, 0
+	for jb := range pending {
+		res := <-jb.result
+		total++
+		if !res.Verified {
+			failed++
+		}
+		if writeErr != nil {
+			// Keep draining so that the workers finish.
+			continue
+		}
+		line, err := json.Marshal(res)
+		if err != nil {
+			writeErr = wrap(ErrSerializeJOSN, err.Error())
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			writeErr = wrap(ErrWriteJSON, err.Error())
+		}
+	}
+	wg.Wait()
+
+	switch {
+	case writeErr != nil:
+		return writeErr
+	case scanErr != nil:
+		return scanErr
+	case failed != 0:
+		return wrap(ErrBatchVerify, fmt.Sprintf("%d of %d tokens failed", failed, total))
+	}
+	return nil
+}
+
+// batchResultOf verifies the token on line of the batch input.
+func (j *jwsVerifier) batchResultOf(line int, token []byte, keyset jwk.Set) batchResult {
+	if hasDetachedPayload(token) {
+		return batchResult{Line: line, verifyResult: &verifyResult{Signatures: []signatureReport{}, Error: ErrRequireDetachedPayload.Error()}}
+	}
+	doc, err := j.resultOf(token, keyset)
+	if doc == nil {
+		doc = &verifyResult{Signatures: []signatureReport{}, Error: err.Error()}
+	}
+	return batchResult{Line: line, verifyResult: doc}
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJWSVerifyBatch(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	other := genKey(t, "EC", "P-256", 0, "json", false)
+	payload := writeFile(t, "payload.txt", `{"n":1}`)
+	good := signWith(t, keyPath, "ES256", payload, "")
+	bad := signWith(t, other, "ES256", payload, "")
+
+	// Enough tokens that the workers finish out of order.
+	var input strings.Builder
+	wantVerified := map[int]bool{}
+	line := 0
+	for i := range 60 {
+		line++
+		switch {
+		case i%10 == 3:
+			input.WriteString("\n")
+			continue
+		case i%7 == 0:
+			input.WriteString(bad + "\n")
+			wantVerified[line] = false
+		case i%11 == 0:
+			input.WriteString("not a token\n")
+			wantVerified[line] = false
+		default:
+			input.WriteString("  " + good + "\r\n")
+			wantVerified[line] = true
+		}
+	}
+
+	var out bytes.Buffer
+	v := &jwsVerifier{Algorithm: "ES256", Jobs: 4}
+	err := v.verifyBatch(&out, strings.NewReader(input.String()), keysOf(t, keyPath))
+	if !errors.Is(err, ErrBatchVerify) {
+		t.Fatalf("want ErrBatchVerify, got %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(wantVerified) {
+		t.Fatalf("%d result lines, want %d", len(lines), len(wantVerified))
+	}
+	previous, failed := 0, 0
+	for _, l := range lines {
+		var got struct {
+			Line     int             `json:"line"`
+			Verified bool            `json:"verified"`
+			Payload  json.RawMessage `json:"payload"`
+			Error    string          `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(l), &got); err != nil {
+			t.Fatalf("%q: %v", l, err)
+		}
+		if got.Line <= previous {
+			t.Errorf("line %d written after line %d", got.Line, previous)
+		}
+		previous = got.Line
+		if got.Verified != wantVerified[got.Line] {
+			t.Errorf("line %d: verified = %v", got.Line, got.Verified)
+		}
+		if got.Verified && string(got.Payload) != `{"n":1}` {
+			t.Errorf("line %d: payload = %s", got.Line, got.Payload)
+		}
+		if !got.Verified {
+			failed++
+			if got.Error == "" {
+				t.Errorf("line %d: no error", got.Line)
+			}
+		}
+	}
+	if !strings.Contains(err.Error(), "of 54 tokens failed") {
+		t.Errorf("error = %v", err)
+	}
+	if failed == 0 {
+		t.Error("no failures reported")
+	}
+
+	out.Reset()
+	if err := v.verifyBatch(&out, strings.NewReader(good+"\n"+good), keysOf(t, keyPath)); err != nil || strings.Count(out.String(), "\n") != 2 {
+		t.Errorf("all verified: %q, %v", out.String(), err)
+	}
+}
+
+func TestJWSVerifyBatchLineTooLong(t *testing.T) {
+	withMaxInputSize(t, 64)
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	var out bytes.Buffer
+	err := (&jwsVerifier{Algorithm: "ES256"}).verifyBatch(&out, strings.NewReader(strings.Repeat("a", 100)), keysOf(t, keyPath))
+	if !errors.Is(err, ErrInputTooLarge) {
+		t.Errorf("want ErrInputTooLarge, got %v", err)
+	}
+}
+
+func TestJWSVerifyBatchConflicts(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	for name, v := range map[string]*jwsVerifier{
+		"--payload":     {Payload: "payload.txt"},
+		"--explain":     {Explain: true},
+		"--result-json": {ResultJSON: true},
+		"--pin":         {Pins: []string{strings.Repeat("A", 43)}},
+	} {
+		v.Batch, v.Algorithm, v.Key, v.KeyFormat = true, "ES256", keyPath, "json"
+		if err := v.valid(); !errors.Is(err, ErrBatchConflict) || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: want ErrBatchConflict, got %v", name, err)
+		}
+	}
+	v := &jwsVerifier{Batch: true, Jobs: -1, Algorithm: "ES256", Key: keyPath, KeyFormat: "json"}
+	if err := v.valid(); !errors.Is(err, ErrInvalidJobs) {
+		t.Errorf("want ErrInvalidJobs, got %v", err)
+	}
+}
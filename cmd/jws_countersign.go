@@ -0,0 +1,337 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/spf13/cobra"
+)
+
+func newJWSCountersignCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "countersign",
+		Short: "Add a signature to an existing JWS message",
+		Long: `Adds one signature per --key to the JWS message in FILE, over the payload
+the message already carries, and writes the message in the general JSON
+serialization. Use "-" as FILE to read from STDIN. The message may use the
+compact, general JSON or flattened JSON serialization; its signatures are
+kept as they are.
+
+--key, --algorithm, --header, --header-file, --set-header and
+--unprotected-header work as for jws sign. Every new signature names its key
+in "kid", the RFC 7638 thumbprint when the key has no kid. A message signed
+with --unencoded-payload gets unencoded signatures too, as RFC 7797 requires.
+
+--verify-key FILE checks the existing signatures first: every one of them
+must verify with a key of FILE and --verify-algorithm (or from-key), as with
+jws verify --require all. Nothing is written when one does not.
+
+A message with a detached payload cannot be countersigned.
+`,
+		RunE: runJWSCountersign,
+	}
+
+	cmd.Flags().StringArrayP("algorithm", "a", nil, "signature algorithm of the new signature (e.g. ES256, RS256, HS256, EdDSA, or from-key); repeat once per --key")
+	cmd.Flags().StringArrayP("key", "k", nil, "file name that contains the key to sign with. single JWK or JWK set, or keystore:<name>; repeatable")
+	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem/p12/jks)")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
+	cmd.Flags().StringP("header", "H", "", "header object to inject into the protected header of every new signature")
+	cmd.Flags().String("header-file", "", "file that holds a header object to inject into the protected header")
+	cmd.Flags().StringArray("set-header", nil, "set NAME=VALUE in the protected header (VALUE is JSON or a string); repeatable")
+	cmd.Flags().String("unprotected-header", "", "header object to add, unprotected, to every new signature")
+	cmd.Flags().String("verify-key", "", "JWK or JWK set that every existing signature must verify with")
+	cmd.Flags().String("verify-algorithm", "", "algorithm of the existing signatures (or from-key), required with --verify-key")
+	cmd.Flags().StringP("output", "o", "-", "output to file")
+
+	return cmd
+}
+
+// jwsCountersigner adds signatures to an existing message. The embedded
+// jwsSigner describes the new signatures.
+type jwsCountersigner struct {
+	jwsSigner
+	VerifyKey       string `validate:"-"`
+	VerifyAlgorithm string `validate:"required_with=VerifyKey,omitempty,oneof=ES256 ES256K ES384 ES512 EdDSA HS256 HS384 HS512 PS256 PS384 PS512 RS256 RS384 RS512 from-key"`
+}
+
+func newJWSCountersigner(cmd *cobra.Command, args []string) (*jwsCountersigner, error) {
+	algorithms, err := cmd.Flags().GetStringArray("algorithm")
+	if err != nil {
+		return nil, err
+	}
+	keys, err := cmd.Flags().GetStringArray("key")
+	if err != nil {
+		return nil, err
+	}
+	keyFormat, err := cmd.Flags().GetString("key-format")
+	if err != nil {
+		return nil, err
+	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return nil, err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return nil, err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return nil, err
+	}
+	header, err := cmd.Flags().GetString("header")
+	if err != nil {
+		return nil, err
+	}
+	headerFile, err := cmd.Flags().GetString("header-file")
+	if err != nil {
+		return nil, err
+	}
+	setHeaders, err := cmd.Flags().GetStringArray("set-header")
+	if err != nil {
+		return nil, err
+	}
+	unprotectedHeader, err := cmd.Flags().GetString("unprotected-header")
+	if err != nil {
+		return nil, err
+	}
+	verifyKey, err := cmd.Flags().GetString("verify-key")
+	if err != nil {
+		return nil, err
+	}
+	verifyAlgorithm, err := cmd.Flags().GetString("verify-algorithm")
+	if err != nil {
+		return nil, err
+	}
+
+	inputFilePath := ""
+	if len(args) != 0 {
+		inputFilePath = args[0]
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwsCountersigner{
+		jwsSigner: jwsSigner{
+			Algorithms:        algorithms,
+			Keys:              keys,
+			KeyFormat:         keyFormat,
+			KeyPasswordFile:   keyPasswordFile,
+			Alias:             alias,
+			EntryPasswordFile: entryPasswordFile,
+			Header:            header,
+			HeaderFile:        headerFile,
+			SetHeaders:        setHeaders,
+			UnprotectedHeader: unprotectedHeader,
+			// The result always holds several signatures.
+			Serialization: "json",
+			InputFilePath: inputFilePath,
+			Output:        output,
+		},
+		VerifyKey:       verifyKey,
+		VerifyAlgorithm: verifyAlgorithm,
+	}, nil
+}
+
+func (j *jwsCountersigner) valid() error {
+	if err := j.jwsSigner.valid(); err != nil {
+		return err
+	}
+	validate := validator.New()
+	if err := validate.StructPartial(j, "VerifyAlgorithm"); err != nil {
+		return wrap(ErrInvalidAlgorithm, "--verify-algorithm")
+	}
+	return nil
+}
+
+func runJWSCountersign(cmd *cobra.Command, args []string) error {
+	countersigner, err := newJWSCountersigner(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	if err = countersigner.valid(); err != nil {
+		return err
+	}
+	return countersigner.countersign()
+}
+
+func (j *jwsCountersigner) countersign() (err error) {
+	buf, err := readJWSMessage(j.InputFilePath)
+	if err != nil {
+		return err
+	}
+	if hasDetachedPayload(buf) {
+		return ErrCountersignDetached
+	}
+	if err := j.verifyExisting(buf); err != nil {
+		return err
+	}
+
+	signed, err := j.countersignMessage(buf)
+	if err != nil {
+		return err
+	}
+
+	output, err := openOutputFile(j.Output)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := output.Close(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}()
+
+	fmt.Fprintf(output, "%s", signed)
+	return nil
+}
+
+// verifyExisting checks that every signature of jwsMessage verifies with a
+// key of --verify-key, when it is given.
+func (j *jwsCountersigner) verifyExisting(jwsMessage []byte) error {
+	if j.VerifyKey == "" {
+		return nil
+	}
+	v := &jwsVerifier{Algorithm: j.VerifyAlgorithm, Key: j.VerifyKey, KeyFormat: "json", Require: requireAll}
+	keyset, err := v.keySource().load()
+	if err != nil {
+		return err
+	}
+	if err := v.resolveAlgorithm(keyset); err != nil {
+		return err
+	}
+	if err := v.checkKeys(keyset); err != nil {
+		return err
+	}
+	if err := v.checkHeaders(jwsMessage); err != nil {
+		return err
+	}
+	return v.writePolicyResult(io.Discard, jwsMessage, keyset)
+}
+
+// countersignMessage returns jwsMessage in the general JSON serialization
+// with a new signature for every --key after the signatures it has.
+func (j *jwsCountersigner) countersignMessage(jwsMessage []byte) ([]byte, error) {
+	msg, err := jws.Parse(jwsMessage)
+	if err != nil {
+		return nil, wrap(ErrParseMessage, err.Error())
+	}
+	members, signatures, err := generalJWS(jwsMessage)
+	if err != nil {
+		return nil, wrap(ErrParseMessage, err.Error())
+	}
+	// RFC 7797 3: every signature of a message agrees on "b64".
+	for _, sig := range msg.Signatures() {
+		if b64, ok := sig.ProtectedHeaders().Field(jws.B64Key); ok && b64 == false {
+			j.UnencodedPayload = true
+		}
+	}
+
+	signers, err := j.signingKeys()
+	if err != nil {
+		return nil, err
+	}
+	var opts []jws.SignOption
+	for _, s := range signers {
+		if err := checkSignatureKey(s.alg.String(), s.key); err != nil {
+			return nil, err
+		}
+		if err := setThumbprintKeyID(s.key); err != nil {
+			return nil, err
+		}
+		o, err := j.signOptions(s.alg, s.key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, o...)
+	}
+	signed, err := jws.Sign(msg.Payload(), append(opts, jws.WithJSON())...)
+	if err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+	if signed, err = j.jsonJWS(signed); err != nil {
+		return nil, err
+	}
+
+	added, newSignatures, err := generalJWS(signed)
+	if err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+	if !samePayload(added["payload"], members["payload"]) {
+		return nil, wrap(ErrSignPayload, "the new signature encodes the payload differently from the message")
+	}
+
+	raw, err := json.Marshal(append(signatures, newSignatures...))
+	if err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+	members["signatures"] = raw
+	out, err := json.Marshal(members)
+	if err != nil {
+		return nil, wrap(ErrSignPayload, err.Error())
+	}
+	return out, nil
+}
+
+// generalJWS splits a compact, flattened or general JSON message into the
+// members of its general JSON serialization, without "signatures", and its
+// signature objects. Every encoded part is kept byte for byte.
+func generalJWS(data []byte) (map[string]json.RawMessage, []map[string]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) != 0 && trimmed[0] == '{' {
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &members); err != nil {
+			return nil, nil, err
+		}
+		var signatures []map[string]json.RawMessage
+		if raw, ok := members["signatures"]; ok {
+			if err := json.Unmarshal(raw, &signatures); err != nil {
+				return nil, nil, err
+			}
+			delete(members, "signatures")
+			return members, signatures, nil
+		}
+		signature := make(map[string]json.RawMessage, 3)
+		for _, name := range []string{"protected", "header", "signature"} {
+			if v, ok := members[name]; ok {
+				signature[name] = v
+				delete(members, name)
+			}
+		}
+		return members, append(signatures, signature), nil
+	}
+
+	parts := strings.Split(string(trimmed), ".")
+	if len(parts) != 3 {
+		return nil, nil, fmt.Errorf("a compact message has 3 parts, not %d", len(parts))
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(parts[0]); err != nil {
+		return nil, nil, fmt.Errorf("protected header: %w", err)
+	}
+	str := func(s string) json.RawMessage {
+		raw, _ := json.Marshal(s)
+		return raw
+	}
+	members := map[string]json.RawMessage{"payload": str(parts[1])}
+	signature := map[string]json.RawMessage{"protected": str(parts[0]), "signature": str(parts[2])}
+	return members, []map[string]json.RawMessage{signature}, nil
+}
+
+// samePayload reports whether two "payload" members hold the same string.
+func samePayload(a, b json.RawMessage) bool {
+	var x, y string
+	return json.Unmarshal(a, &x) == nil && json.Unmarshal(b, &y) == nil && x == y
+}
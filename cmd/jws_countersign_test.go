@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// countersignWith runs c on the message in messagePath and returns the
+// result.
+func countersignWith(t *testing.T, c *jwsCountersigner, messagePath string) (string, error) {
+	t.Helper()
+	c.KeyFormat, c.Serialization = "json", "json"
+	c.InputFilePath = messagePath
+	c.Output = filepath.Join(t.TempDir(), "out.json")
+	if err := c.valid(); err != nil {
+		return "", err
+	}
+	if err := c.countersign(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(c.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+// flattenedOf signs payloadPath with ES256 and keyPath in the flattened JSON
+// serialization.
+func flattenedOf(t *testing.T, keyPath, payloadPath string) string {
+	t.Helper()
+	s := &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{keyPath}, KeyFormat: "json", Serialization: "flattened", InputFilePath: payloadPath, Output: filepath.Join(t.TempDir(), "out.json")}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestJWSCountersign(t *testing.T) {
+	t.Parallel()
+
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	octPath := genKey(t, "oct", "", 256, "json", false)
+	payload := writeFile(t, "payload.txt", `{"sub":"alice"}`)
+	compact := signWith(t, ecPath, "ES256", payload, `{"kid":"build"}`)
+
+	for name, message := range map[string]string{
+		"compact":   compact,
+		"flattened": flattenedOf(t, ecPath, payload),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			c := &jwsCountersigner{
+				jwsSigner:       jwsSigner{Algorithms: []string{"HS256"}, Keys: []string{octPath}},
+				VerifyKey:       ecPath,
+				VerifyAlgorithm: "ES256",
+			}
+			out, err := countersignWith(t, c, writeFile(t, "token.jws", message))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var general struct {
+				Payload    string            `json:"payload"`
+				Signatures []json.RawMessage `json:"signatures"`
+			}
+			if err := json.Unmarshal([]byte(out), &general); err != nil {
+				t.Fatal(err)
+			}
+			if general.Payload != "eyJzdWIiOiJhbGljZSJ9" || len(general.Signatures) != 2 {
+				t.Fatalf("want the payload with 2 signatures, got %s", out)
+			}
+			for _, tt := range []struct{ alg, key string }{{"ES256", ecPath}, {"HS256", octPath}} {
+				v := &jwsVerifier{Algorithm: tt.alg}
+				if err := v.writeVerifyResult(io.Discard, []byte(out), keysOf(t, tt.key)); err != nil {
+					t.Errorf("%s signature: %v", tt.alg, err)
+				}
+			}
+		})
+	}
+}
+
+func TestJWSCountersignUnencodedPayload(t *testing.T) {
+	t.Parallel()
+
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	octPath := genKey(t, "oct", "", 256, "json", false)
+	payload := writeFile(t, "payload.txt", "hi")
+	s := &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{ecPath}, KeyFormat: "json", UnencodedPayload: true, InputFilePath: payload, Output: filepath.Join(t.TempDir(), "out.jws")}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &jwsCountersigner{jwsSigner: jwsSigner{Algorithms: []string{"HS256"}, Keys: []string{octPath}}}
+	out, err := countersignWith(t, c, s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &jwsVerifier{Algorithm: "HS256"}
+	var buf bytes.Buffer
+	if err := v.writeVerifyResult(&buf, []byte(out), keysOf(t, octPath)); err != nil || buf.String() != "hi" {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
+
+func TestJWSCountersignRejects(t *testing.T) {
+	t.Parallel()
+
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	octPath := genKey(t, "oct", "", 256, "json", false)
+	payload := writeFile(t, "payload.txt", "hi")
+	compact := writeFile(t, "token.jws", signWith(t, ecPath, "ES256", payload, ""))
+
+	tests := []struct {
+		name    string
+		c       jwsCountersigner
+		message string
+		want    error
+	}{
+		{
+			name:    "existing signature does not verify",
+			c:       jwsCountersigner{VerifyKey: genKey(t, "EC", "P-256", 0, "json", false), VerifyAlgorithm: "ES256"},
+			message: compact,
+			want:    ErrVerifyPolicy,
+		},
+		{
+			name:    "verify key without algorithm",
+			c:       jwsCountersigner{VerifyKey: ecPath},
+			message: compact,
+			want:    ErrInvalidAlgorithm,
+		},
+		{
+			name:    "detached payload",
+			message: writeFile(t, "detached.jws", "eyJhbGciOiJFUzI1NiJ9..c2ln"),
+			want:    ErrCountersignDetached,
+		},
+		{
+			name:    "key that does not fit",
+			c:       jwsCountersigner{jwsSigner: jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{octPath}}},
+			message: compact,
+			want:    ErrKeyAlgorithmMismatch,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c := tt.c
+			if c.Algorithms == nil {
+				c.Algorithms, c.Keys = []string{"HS256"}, []string{octPath}
+			}
+			if _, err := countersignWith(t, &c, tt.message); !errors.Is(err, tt.want) {
+				t.Errorf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// registeredHeaderNames are the header parameters RFC 7515 and RFC 7516
+// define. RFC 7515 4.1.11 forbids listing them in "crit".
+var registeredHeaderNames = []string{
+	"alg", "jku", "jwk", "kid", "x5u", "x5c", "x5t", "x5t#S256", "typ", "cty", "crit", "enc", "zip",
+}
+
+// understoodCriticalOf returns the "crit" extensions the verifier accepts:
+// those jose processes itself and those of --understood-crit.
+func (j *jwsVerifier) understoodCriticalOf() []string {
+	return append(slices.Clone(understoodCritical), j.UnderstoodCrit...)
+}
+
+// checkCritical enforces RFC 7515 4.1.11 on every signature of jwsMessage:
+// "crit" is a non-empty list in the protected header of distinct extension
+// names that the header holds, none of them registered, and every one
+// understood. A message that cannot be broken down is left for the
+// verification to report.
+func (j *jwsVerifier) checkCritical(jwsMessage []byte) error {
+	inspection, err := inspectJWS(jwsMessage)
+	if err != nil {
+		// jws.Verify reports the malformed message.
+		return nil
+	}
+	understood := j.understoodCriticalOf()
+	for _, s := range inspection.Signatures {
+		if reason := criticalViolation(s, understood); reason != "" {
+			return wrap(ErrCriticalHeader, fmt.Sprintf("signature %d: %s", s.Index, reason))
+		}
+	}
+	return nil
+}
+
+// criticalViolation describes how the "crit" header of s breaks the rules of
+// checkCritical, or returns "" when it does not.
+func criticalViolation(s inspectedSignature, understood []string) string {
+	var unprotected map[string]json.RawMessage
+	if json.Unmarshal(s.Header, &unprotected) == nil {
+		if _, ok := unprotected["crit"]; ok {
+			return `"crit" must be in the protected header`
+		}
+	}
+
+	var protected map[string]json.RawMessage
+	if err := json.Unmarshal(s.Protected.Decoded, &protected); err != nil {
+		return ""
+	}
+	raw, ok := protected["crit"]
+	if !ok {
+		return ""
+	}
+	var names []string
+	if err := json.Unmarshal(raw, &names); err != nil {
+		return `"crit" must be an array of header parameter names`
+	}
+	if len(names) == 0 {
+		return `"crit" must not be empty`
+	}
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		if _, dup := seen[name]; dup {
+			return fmt.Sprintf(`"crit" lists %q twice`, name)
+		}
+		seen[name] = struct{}{}
+		switch {
+		case contains(registeredHeaderNames, name):
+			return fmt.Sprintf(`"crit" lists %q, which RFC 7515 or RFC 7516 defines`, name)
+		case protected[name] == nil:
+			return fmt.Sprintf(`"crit" lists %q, which is not in the protected header`, name)
+		case !contains(understood, name):
+			return fmt.Sprintf(`"crit" lists %q, which is not understood (see --understood-crit)`, name)
+		}
+	}
+	return ""
+}
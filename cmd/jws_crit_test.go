@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJWSVerifyUnderstoodCrit(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	payload := writeFile(t, "payload.txt", "crit")
+
+	tests := []struct {
+		name       string
+		header     string
+		understood []string
+		wantErr    error
+	}{
+		{name: "no crit", header: `{"typ":"JWT"}`},
+		{name: "understood", header: `{"crit":["x-proto"],"x-proto":"v1"}`, understood: []string{"x-proto"}},
+		{name: "not understood", header: `{"crit":["x-proto"],"x-proto":"v1"}`, wantErr: ErrCriticalHeader},
+		{name: "one of two understood", header: `{"crit":["x-proto","x-tenant"],"x-proto":"v1","x-tenant":"a"}`, understood: []string{"x-proto"}, wantErr: ErrCriticalHeader},
+		{name: "registered name", header: `{"crit":["typ"],"typ":"JWT"}`, understood: []string{"typ"}, wantErr: ErrCriticalHeader},
+		{name: "missing from the header", header: `{"crit":["x-proto"]}`, understood: []string{"x-proto"}, wantErr: ErrCriticalHeader},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			message := []byte(signWith(t, keyPath, "ES256", payload, tt.header))
+			var buf bytes.Buffer
+			err := (&jwsVerifier{Algorithm: "ES256", UnderstoodCrit: tt.understood}).writeVerifyResult(&buf, message, keysOf(t, keyPath))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && buf.String() != "crit" {
+				t.Errorf("payload = %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestCriticalViolation(t *testing.T) {
+	t.Parallel()
+
+	understood := []string{"b64", "x-proto"}
+	tests := []struct {
+		name        string
+		protected   string
+		unprotected string
+		want        bool
+	}{
+		{name: "valid", protected: `{"alg":"ES256","crit":["x-proto"],"x-proto":1}`},
+		{name: "not a list", protected: `{"alg":"ES256","crit":"x-proto","x-proto":1}`, want: true},
+		{name: "empty", protected: `{"alg":"ES256","crit":[]}`, want: true},
+		{name: "duplicate", protected: `{"alg":"ES256","crit":["x-proto","x-proto"],"x-proto":1}`, want: true},
+		{name: "unprotected", protected: `{"alg":"ES256","x-proto":1}`, unprotected: `{"crit":["x-proto"]}`, want: true},
+	}
+	for _, tt := range tests {
+		s := inspectedSignature{Protected: inspectedHeader{Decoded: json.RawMessage(tt.protected)}}
+		if tt.unprotected != "" {
+			s.Header = json.RawMessage(tt.unprotected)
+		}
+		if got := criticalViolation(s, understood); (got != "") != tt.want {
+			t.Errorf("%s: violation %q, want one: %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJWSVerifyResultJSONShowsCrit(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	message := []byte(signWith(t, keyPath, "ES256", writeFile(t, "payload.txt", "x"), `{"crit":["x-proto"],"x-proto":"v1"}`))
+
+	var buf bytes.Buffer
+	v := &jwsVerifier{Algorithm: "ES256", ResultJSON: true, UnderstoodCrit: []string{"x-proto"}}
+	if err := v.writeVerifyResult(&buf, message, keysOf(t, keyPath)); err != nil {
+		t.Fatal(err)
+	}
+	var doc verifyResult
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Critical) != 1 || doc.Critical[0] != "x-proto" || len(doc.Signatures[0].Critical) != 1 {
+		t.Errorf("crit not reported:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	err := (&jwsVerifier{Algorithm: "ES256", ResultJSON: true}).writeVerifyResult(&buf, message, keysOf(t, keyPath))
+	if !errors.Is(err, ErrCriticalHeader) || !bytes.Contains(buf.Bytes(), []byte(`"verified": false`)) {
+		t.Errorf("want ErrCriticalHeader and a failed result, got %v:\n%s", err, buf.String())
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"io"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// detachedPayload is the jws.Sign option that carries a detached payload,
+// and the input to close once the message is signed.
+type detachedPayload struct {
+	option jws.SignOption
+	io.Closer
+}
+
+// detachedPayload prepares the detached payload for signers. When every
+// algorithm signs a digest, the payload is streamed through the hash so an
+// artifact of any size can be signed in constant memory; EdDSA signs the
+// whole message (RFC 8032), so then the payload is read into memory.
+func (j *jwsSigner) detachedPayload(signers []signingKey) (*detachedPayload, error) {
+	if streamsPayload(signers) {
+		src, err := openInputFile(j.InputFilePath)
+		if err != nil {
+			return nil, err
+		}
+		return &detachedPayload{option: jws.WithDetachedPayloadReader(src), Closer: src}, nil
+	}
+	buf, err := readInput(j.InputFilePath)
+	if err != nil {
+		return nil, err
+	}
+	return &detachedPayload{option: jws.WithDetachedPayload(buf), Closer: io.NopCloser(nil)}, nil
+}
+
+// streamsPayload reports whether every signature of signers can be computed
+// from a digest of the payload.
+func streamsPayload(signers []signingKey) bool {
+	for _, s := range signers {
+		if s.alg == jwa.EdDSA() {
+			return false
+		}
+	}
+	return true
+}
+
+// openPayload supplies the --payload of a verification. A single signature
+// checked with a single key is streamed through the hash, as jws sign
+// --detached does; everything else (EdDSA, key sets, --require, --explain,
+// --result-json, --match-kid, --allow-alg) reads the payload into memory.
+func (j *jwsVerifier) openPayload(jwsMessage []byte, keyset jwk.Set) (io.Closer, error) {
+	if j.streamsPayload(jwsMessage, keyset) {
+		src, err := openInputFile(j.Payload)
+		if err != nil {
+			return nil, err
+		}
+		j.payload = src
+		return src, nil
+	}
+	buf, err := readInput(j.Payload)
+	if err != nil {
+		return nil, err
+	}
+	j.detached = buf
+	return io.NopCloser(nil), nil
+}
+
+// streamsPayload reports whether jws.Verify can check jwsMessage against a
+// streamed payload: jwx streams exactly one signature with exactly one key.
+func (j *jwsVerifier) streamsPayload(jwsMessage []byte, keyset jwk.Set) bool {
+	if j.Explain || j.ResultJSON || j.Require != "" || j.selectsKeyByKid() ||
+		keyset.Len() != 1 || j.Algorithm == jwa.EdDSA().String() {
+		return false
+	}
+	msg, err := jws.Parse(jwsMessage)
+	return err == nil && len(msg.Signatures()) == 1
+}
+
+// suppliesPayload reports whether the payload comes from --payload rather than
+// from the message.
+func (j *jwsVerifier) suppliesPayload() bool {
+	return j.detached != nil || j.payload != nil
+}
@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/charmbracelet/log"
+	"github.com/lestrrat-go/jwx/v4/cert"
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// embedsKey reports whether the signer puts a key, or where to find one, into
+// the protected header.
+func (j *jwsSigner) embedsKey() bool {
+	return j.EmbedJWK || j.JKU != "" || j.X5U != "" || j.X5C != ""
+}
+
+// embedKey sets the "jwk", "jku", "x5u" and "x5c" members of h for the
+// signature made with key.
+func (j *jwsSigner) embedKey(h jws.Headers, key interface{}) error {
+	k, ok := key.(jwk.Key)
+	if !ok {
+		return wrap(ErrParseKey, fmt.Sprintf("%T is not a JWK", key))
+	}
+
+	if j.EmbedJWK {
+		if k.KeyType() == jwa.OctetSeq() {
+			return ErrEmbedSymmetricKey
+		}
+		pub, err := jwk.PublicKeyOf(k)
+		if err != nil {
+			return wrap(ErrParseKey, err.Error())
+		}
+		if err := h.Set(jws.JWKKey, pub); err != nil {
+			return wrap(ErrParseHeader, err.Error())
+		}
+	}
+	if j.JKU != "" {
+		if err := h.Set(jws.JWKSetURLKey, j.JKU); err != nil {
+			return wrap(ErrParseHeader, err.Error())
+		}
+	}
+	if j.X5U != "" {
+		if err := h.Set(jws.X509URLKey, j.X5U); err != nil {
+			return wrap(ErrParseHeader, err.Error())
+		}
+	}
+	if len(j.chain) != 0 {
+		// RFC 7515 4.1.6: the certificate holding the signing key comes first.
+		if !certificateBelongsTo(j.chain[0], k) {
+			return ErrCertificateKeyMismatch
+		}
+		var chain cert.Chain
+		for _, c := range j.chain {
+			if err := chain.AddString(base64.StdEncoding.EncodeToString(c.Raw)); err != nil {
+				return wrap(ErrParseCertificate, err.Error())
+			}
+		}
+		if err := h.Set(jws.X509CertChainKey, &chain); err != nil {
+			return wrap(ErrParseHeader, err.Error())
+		}
+	}
+	return nil
+}
+
+// certificateBelongsTo reports whether c certifies the public part of key.
+func certificateBelongsTo(c *x509.Certificate, key jwk.Key) bool {
+	pub, err := jwk.PublicRawKeyOf(key)
+	if err != nil {
+		return false
+	}
+	p, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && p.Equal(c.PublicKey)
+}
+
+// validPin reports whether pin is the base64url form of a SHA-256 thumbprint.
+func validPin(pin string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(pin)
+	return err == nil && len(raw) == crypto.SHA256.Size()
+}
+
+// embeddedKeys returns the keys in the protected headers of jwsMessage that
+// are trusted: a "jwk" whose thumbprint is pinned with --pin, and the end
+// entity of an "x5c" chain that validates against --ca-bundle. Every other
+// embedded key, and every "jku" or "x5u" (jose never fetches keys), is
+// reported as ignored.
+func (j *jwsVerifier) embeddedKeys(jwsMessage []byte) (jwk.Set, error) {
+	trusted := jwk.NewSet()
+	msg, err := jws.Parse(jwsMessage)
+	if err != nil {
+		// The verification that follows reports the malformed message.
+		return trusted, nil
+	}
+
+	var roots *x509.CertPool
+	if j.CABundle != "" {
+		certs, err := readCertificates(j.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		roots = x509.NewCertPool()
+		for _, c := range certs {
+			roots.AddCert(c)
+		}
+	}
+
+	for i, sig := range msg.Signatures() {
+		if public := sig.PublicHeaders(); public != nil {
+			for _, name := range []string{jws.JWKKey, jws.X509CertChainKey, jws.JWKSetURLKey, jws.X509URLKey} {
+				if public.Has(name) {
+					log.Warn("embedded key ignored: not in the protected header", "signature", i, "header", name)
+				}
+			}
+		}
+
+		h := sig.ProtectedHeaders()
+		if key, ok := h.JWK(); ok {
+			if err := j.trustJWK(trusted, i, key); err != nil {
+				return nil, err
+			}
+		}
+		if chain, ok := h.X509CertChain(); ok {
+			if err := j.trustX5C(trusted, i, chain, roots); err != nil {
+				return nil, err
+			}
+		}
+		if u, ok := h.JWKSetURL(); ok {
+			log.Warn("jku ignored: jose does not fetch keys", "signature", i, "jku", u)
+		}
+		if u, ok := h.X509URL(); ok {
+			log.Warn("x5u ignored: jose does not fetch certificates", "signature", i, "x5u", u)
+		}
+	}
+	return trusted, nil
+}
+
+// trustJWK adds the embedded jwk of signature i to trusted when --pin names
+// its thumbprint.
+func (j *jwsVerifier) trustJWK(trusted jwk.Set, i int, key jwk.Key) error {
+	thumbprint, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(thumbprint)
+	switch {
+	case len(j.Pins) == 0:
+		log.Warn("embedded jwk ignored: trust it with --pin", "signature", i, "thumbprint", encoded)
+		return nil
+	case !contains(j.Pins, encoded):
+		log.Warn("embedded jwk ignored: thumbprint not pinned", "signature", i, "thumbprint", encoded)
+		return nil
+	}
+	if private, err := jwk.IsPrivateKey(key); (err == nil && private) || key.KeyType() == jwa.OctetSeq() {
+		log.Warn("embedded jwk ignored: not a public key", "signature", i, "thumbprint", encoded)
+		return nil
+	}
+	if err := trusted.AddKey(key); err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	j.explainf("signature %d: embedded jwk trusted, thumbprint %s", i, encoded)
+	return nil
+}
+
+// trustX5C adds the public key of the end-entity certificate of the x5c
+// chain of signature i to trusted when the chain validates against roots.
+func (j *jwsVerifier) trustX5C(trusted jwk.Set, i int, chain *cert.Chain, roots *x509.CertPool) error {
+	if roots == nil {
+		log.Warn("embedded x5c ignored: trust it with --ca-bundle", "signature", i)
+		return nil
+	}
+	certs, err := parseCertificateChain(chain)
+	if err != nil || len(certs) == 0 {
+		log.Warn("embedded x5c ignored: no certificate", "signature", i, "error", err)
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		log.Warn("embedded x5c ignored: chain does not validate", "signature", i, "error", err)
+		return nil
+	}
+	key, err := jwk.Import[jwk.Key](certs[0].PublicKey)
+	if err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	if err := trusted.AddKey(key); err != nil {
+		return wrap(ErrParseKey, err.Error())
+	}
+	j.explainf("signature %d: embedded x5c trusted, subject %s", i, certs[0].Subject.String())
+	return nil
+}
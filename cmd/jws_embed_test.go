@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// signEmbedded signs a fixed payload with s and returns the message file.
+func signEmbedded(t *testing.T, s *jwsSigner) (string, error) {
+	t.Helper()
+	s.Algorithms = []string{"ES256"}
+	s.KeyFormat = "json"
+	s.InputFilePath = writeFile(t, "payload.txt", "embedded")
+	s.Output = filepath.Join(t.TempDir(), "out.jws")
+	if err := s.valid(); err != nil {
+		return "", err
+	}
+	return s.Output, s.signer()
+}
+
+// verifyEmbedded verifies the message file and returns what was printed.
+func verifyEmbedded(t *testing.T, v *jwsVerifier, message string) (string, error) {
+	t.Helper()
+	v.Algorithm = "ES256"
+	v.KeyFormat = "json"
+	v.InputFilePath = message
+	v.Output = filepath.Join(t.TempDir(), "payload")
+	if err := v.valid(); err != nil {
+		return "", err
+	}
+	if err := v.verify(); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(v.Output)
+	return string(data), err
+}
+
+func TestJWSEmbeddedJWKNeedsPin(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	message, err := signEmbedded(t, &jwsSigner{Keys: []string{keyPath}, EmbedJWK: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumbprint, err := keyOf(t, keyPath).Thumbprint(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pin := base64.RawURLEncoding.EncodeToString(thumbprint)
+
+	var stderr bytes.Buffer
+	if got, err := verifyEmbedded(t, &jwsVerifier{Pins: []string{pin}, stderr: &stderr}, message); err != nil || got != "embedded" {
+		t.Errorf("pinned key: %q, %v", got, err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("trusted key reported without --explain: %q", stderr.String())
+	}
+	if _, err := verifyEmbedded(t, &jwsVerifier{Pins: []string{pin}, Explain: true, stderr: &stderr}, message); err != nil {
+		t.Fatal(err)
+	}
+	if want := "signature 0: embedded jwk trusted, thumbprint " + pin; !strings.Contains(stderr.String(), want) {
+		t.Errorf("report lacks %q:\n%s", want, stderr.String())
+	}
+	other := base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+	if _, err := verifyEmbedded(t, &jwsVerifier{Pins: []string{other}}, message); !errors.Is(err, ErrVerifyJWSMessage) {
+		t.Errorf("unpinned key: want ErrVerifyJWSMessage, got %v", err)
+	}
+	// Without --pin the embedded key is ignored and only --key counts.
+	stranger := genKey(t, "EC", "P-256", 0, "json", false)
+	if _, err := verifyEmbedded(t, &jwsVerifier{Key: stranger}, message); !errors.Is(err, ErrVerifyJWSMessage) {
+		t.Errorf("embedded key used without --pin: %v", err)
+	}
+
+	if _, err := verifyEmbedded(t, &jwsVerifier{}, message); !errors.Is(err, ErrRequireKeyFile) {
+		t.Errorf("want ErrRequireKeyFile, got %v", err)
+	}
+	if _, err := verifyEmbedded(t, &jwsVerifier{Pins: []string{"short"}}, message); !errors.Is(err, ErrInvalidPin) {
+		t.Errorf("want ErrInvalidPin, got %v", err)
+	}
+}
+
+func TestJWSSignEmbedsHeaders(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	message, err := signEmbedded(t, &jwsSigner{
+		Keys:     []string{keyPath},
+		EmbedJWK: true,
+		JKU:      "https://example.com/jwks.json",
+		X5U:      "https://example.com/chain.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inspection, err := inspectJWS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(inspection.Signatures[0].Protected.Decoded, &header); err != nil {
+		t.Fatal(err)
+	}
+	if header["jku"] != "https://example.com/jwks.json" || header["x5u"] != "https://example.com/chain.pem" {
+		t.Errorf("header = %v", header)
+	}
+	if embedded, ok := header["jwk"].(map[string]any); !ok || embedded["d"] != nil {
+		t.Errorf("jwk = %v, want the public key", header["jwk"])
+	}
+
+	for name, s := range map[string]struct {
+		signer *jwsSigner
+		want   error
+	}{
+		"plain http jku": {&jwsSigner{Keys: []string{keyPath}, JKU: "http://example.com/jwks.json"}, ErrInvalidHeaderURL},
+		"relative x5u":   {&jwsSigner{Keys: []string{keyPath}, X5U: "chain.pem"}, ErrInvalidHeaderURL},
+		"symmetric key":  {&jwsSigner{Keys: []string{genKey(t, "oct", "", 256, "json", false)}, EmbedJWK: true}, ErrEmbedSymmetricKey},
+	} {
+		s.signer.Algorithms = []string{"HS256"}
+		s.signer.KeyFormat = "json"
+		s.signer.InputFilePath = writeFile(t, "payload.txt", "x")
+		s.signer.Output = filepath.Join(t.TempDir(), "out.jws")
+		err := s.signer.valid()
+		if err == nil {
+			err = s.signer.signer()
+		}
+		if !errors.Is(err, s.want) {
+			t.Errorf("%s: want %v, got %v", name, s.want, err)
+		}
+	}
+}
+
+// issueCertificate issues a certificate for pub signed by parent and
+// parentKey, or a self-signed CA certificate when parent is nil.
+func issueCertificate(t *testing.T, pub crypto.PublicKey, parent *x509.Certificate, parentKey crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "jose leaf"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		tmpl.Subject.CommonName = "jose test CA"
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+		parent = tmpl
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// pemFile writes certificates as PEM CERTIFICATE blocks.
+func pemFile(t *testing.T, certs ...*x509.Certificate) string {
+	t.Helper()
+	var data []byte
+	for _, c := range certs {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	return writeFile(t, "certs.pem", string(data))
+}
+
+// newCA returns a CA certificate and its key.
+func newCA(t *testing.T) (*x509.Certificate, crypto.Signer) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issueCertificate(t, key.Public(), nil, key), key
+}
+
+func TestJWSEmbeddedX5CNeedsCABundle(t *testing.T) {
+	t.Parallel()
+
+	ca, caKey := newCA(t)
+	otherCA, _ := newCA(t)
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	priv, err := jwk.Export[*ecdsa.PrivateKey](keyOf(t, keyPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := issueCertificate(t, priv.Public(), ca, caKey)
+
+	message, err := signEmbedded(t, &jwsSigner{Keys: []string{keyPath}, X5C: pemFile(t, leaf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if got, err := verifyEmbedded(t, &jwsVerifier{CABundle: pemFile(t, ca), Explain: true, stderr: &stderr}, message); err != nil || got != "embedded" {
+		t.Errorf("trusted chain: %q, %v", got, err)
+	}
+	if !strings.Contains(stderr.String(), "signature 0: embedded x5c trusted") {
+		t.Errorf("report lacks the trusted chain:\n%s", stderr.String())
+	}
+	if _, err := verifyEmbedded(t, &jwsVerifier{CABundle: pemFile(t, otherCA)}, message); !errors.Is(err, ErrVerifyJWSMessage) {
+		t.Errorf("untrusted chain: want ErrVerifyJWSMessage, got %v", err)
+	}
+
+	// The first certificate must certify the signing key.
+	stranger := genKey(t, "EC", "P-256", 0, "json", false)
+	if _, err := signEmbedded(t, &jwsSigner{Keys: []string{stranger}, X5C: pemFile(t, leaf)}); !errors.Is(err, ErrCertificateKeyMismatch) {
+		t.Errorf("want ErrCertificateKeyMismatch, got %v", err)
+	}
+}
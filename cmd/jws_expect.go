@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// checkHeaders runs the checks on the protected headers of jwsMessage that
+// come before the signatures: crit, then the --expect-* flags.
+func (j *jwsVerifier) checkHeaders(jwsMessage []byte) error {
+	if err := j.checkCritical(jwsMessage); err != nil {
+		return err
+	}
+	return j.checkExpectations(jwsMessage)
+}
+
+// checkExpectations reports every way in which the protected header of a
+// signature of jwsMessage differs from --expect-typ, --expect-cty,
+// --expect-kid and --expect-header.
+func (j *jwsVerifier) checkExpectations(jwsMessage []byte) error {
+	if j.ExpectTyp == "" && j.ExpectCty == "" && len(j.ExpectKid) == 0 && len(j.ExpectHeaders) == 0 {
+		return nil
+	}
+	inspection, err := inspectJWS(jwsMessage)
+	if err != nil {
+		// jws.Verify reports the malformed message.
+		return nil
+	}
+
+	var errs []error
+	for _, s := range inspection.Signatures {
+		var header map[string]json.RawMessage
+		if err := json.Unmarshal(s.Protected.Decoded, &header); err != nil {
+			header = nil
+		}
+		for _, reason := range j.headerMismatches(header) {
+			errs = append(errs, wrap(ErrHeaderExpectation, fmt.Sprintf("signature %d: %s", s.Index, reason)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// headerMismatches describes each expectation that header does not meet.
+func (j *jwsVerifier) headerMismatches(header map[string]json.RawMessage) []string {
+	var reasons []string
+	str := func(name string) (string, bool) {
+		var v string
+		raw, ok := header[name]
+		if !ok || json.Unmarshal(raw, &v) != nil {
+			return "", false
+		}
+		return v, true
+	}
+
+	for _, media := range []struct{ name, want string }{{"typ", j.ExpectTyp}, {"cty", j.ExpectCty}} {
+		if media.want == "" {
+			continue
+		}
+		got, ok := str(media.name)
+		switch {
+		case !ok:
+			reasons = append(reasons, fmt.Sprintf("no %s, want %q", media.name, media.want))
+		case !sameMediaType(got, media.want):
+			reasons = append(reasons, fmt.Sprintf("%s is %q, want %q", media.name, got, media.want))
+		}
+	}
+
+	if len(j.ExpectKid) != 0 {
+		got, ok := str("kid")
+		switch {
+		case !ok:
+			reasons = append(reasons, fmt.Sprintf("no kid, want one of %s", strings.Join(j.ExpectKid, ", ")))
+		case !contains(j.ExpectKid, got):
+			reasons = append(reasons, fmt.Sprintf("kid %q is not one of %s", got, strings.Join(j.ExpectKid, ", ")))
+		}
+	}
+
+	for _, expected := range j.ExpectHeaders {
+		name, value, _ := strings.Cut(expected, "=")
+		want := parseHeaderValue(value)
+		raw, ok := header[name]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("no %q, want %s", name, value))
+			continue
+		}
+		var got any
+		if err := json.Unmarshal(raw, &got); err != nil || !reflect.DeepEqual(got, want) {
+			reasons = append(reasons, fmt.Sprintf("%q is %s, want %s", name, raw, value))
+		}
+	}
+	return reasons
+}
+
+// sameMediaType compares two "typ" or "cty" values as RFC 7515 4.1.9 asks:
+// case-insensitively, with "application/" implied when there is no "/".
+func sameMediaType(a, b string) bool {
+	return strings.EqualFold(fullMediaType(a), fullMediaType(b))
+}
+
+func fullMediaType(v string) string {
+	if strings.Contains(v, "/") {
+		return v
+	}
+	return "application/" + v
+}
+
+// parseHeaderValue reads the value of a name=value header flag: JSON when it
+// parses as JSON (a number, true, "quoted", an object), otherwise a string.
+func parseHeaderValue(value string) any {
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	return v
+}
+
+// validHeaderAssignment reports whether s has the form name=value with a
+// non-empty name.
+func validHeaderAssignment(s string) bool {
+	name, _, found := strings.Cut(s, "=")
+	return found && name != ""
+}
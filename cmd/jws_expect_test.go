@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJWSVerifyExpectations(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	payload := writeFile(t, "payload.txt", "expect")
+	message := []byte(signWith(t, keyPath, "ES256", payload, `{"typ":"at+jwt","cty":"application/json","kid":"k1","ver":2,"iss":"me"}`))
+
+	tests := []struct {
+		name     string
+		verifier jwsVerifier
+		want     []string
+	}{
+		{name: "none"},
+		{name: "typ ignores case", verifier: jwsVerifier{ExpectTyp: "AT+JWT"}},
+		{name: "typ implies application/", verifier: jwsVerifier{ExpectTyp: "application/at+jwt", ExpectCty: "JSON"}},
+		{name: "kid allowed", verifier: jwsVerifier{ExpectKid: []string{"k0", "k1"}}},
+		{name: "members", verifier: jwsVerifier{ExpectHeaders: []string{"ver=2", "iss=me", `iss="me"`}}},
+		{name: "typ", verifier: jwsVerifier{ExpectTyp: "JWT"}, want: []string{`typ is "at+jwt", want "JWT"`}},
+		{name: "kid", verifier: jwsVerifier{ExpectKid: []string{"k2"}}, want: []string{`kid "k1" is not one of k2`}},
+		{name: "typed member", verifier: jwsVerifier{ExpectHeaders: []string{`ver="2"`}}, want: []string{`"ver" is 2, want "2"`}},
+		{name: "missing member", verifier: jwsVerifier{ExpectHeaders: []string{"aud=you"}}, want: []string{`no "aud", want you`}},
+		{
+			name:     "every mismatch",
+			verifier: jwsVerifier{ExpectTyp: "JWT", ExpectCty: "text/plain", ExpectHeaders: []string{"iss=you"}},
+			want:     []string{`typ is "at+jwt"`, `cty is "application/json"`, `"iss" is "me"`},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			v := tt.verifier
+			v.Algorithm = "ES256"
+			var buf bytes.Buffer
+			err := v.writeVerifyResult(&buf, message, keysOf(t, keyPath))
+			if len(tt.want) == 0 {
+				if err != nil || buf.String() != "expect" {
+					t.Fatalf("got %q, %v", buf.String(), err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrHeaderExpectation) {
+				t.Fatalf("want ErrHeaderExpectation, got %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%q does not mention %q", err, want)
+				}
+			}
+			if buf.Len() != 0 {
+				t.Errorf("payload written despite the mismatch: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestSameMediaType(t *testing.T) {
+	t.Parallel()
+
+	for _, tt := range []struct {
+		a, b string
+		want bool
+	}{
+		{"JWT", "jwt", true},
+		{"JWT", "application/jwt", true},
+		{"at+jwt", "application/AT+JWT", true},
+		{"JWT", "text/jwt", false},
+		{"JOSE", "JWT", false},
+	} {
+		if got := sameMediaType(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameMediaType(%q, %q) = %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestJWSVerifyInvalidExpectations(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	for _, tt := range []struct {
+		verifier jwsVerifier
+		want     error
+	}{
+		{jwsVerifier{ExpectHeaders: []string{"iss"}}, ErrInvalidExpectHeader},
+		{jwsVerifier{ExpectHeaders: []string{"=me"}}, ErrInvalidExpectHeader},
+		{jwsVerifier{ExpectKid: []string{""}}, ErrInvalidExpectKid},
+	} {
+		v := tt.verifier
+		v.Algorithm, v.Key, v.KeyFormat = "ES256", keyPath, "json"
+		v.InputFilePath = writeFile(t, "token.jws", "x")
+		if err := v.valid(); !errors.Is(err, tt.want) {
+			t.Errorf("%+v: want %v, got %v", tt.verifier, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// keyCheck is what "jws verify --explain" found out about one key for one
+// signature.
+type keyCheck struct {
+	Key       int
+	KeyID     string
+	KeyType   string
+	Curve     string
+	Private   string
+	Algorithm string // algorithm the key is tried with
+	AlgMatch  string
+	KidMatch  string
+	Fits      string
+	Signature string
+	Verified  bool
+}
+
+// explainOutput is where --explain writes its report.
+func (j *jwsVerifier) explainOutput() io.Writer {
+	if j.stderr != nil {
+		return j.stderr
+	}
+	return os.Stderr
+}
+
+// explainf adds one line to the --explain report. Without --explain a
+// verification that succeeds writes nothing to standard error.
+func (j *jwsVerifier) explainf(format string, args ...any) {
+	if j.Explain {
+		fmt.Fprintf(j.explainOutput(), format+"\n", args...)
+	}
+}
+
+// explain writes, for every signature of jwsMessage and every key of keyset,
+// which of the conditions for a successful verification hold.
+func (j *jwsVerifier) explain(w io.Writer, jwsMessage []byte, keyset jwk.Set) error {
+	msg, err := jws.Parse(jwsMessage)
+	if err != nil {
+		return wrap(ErrParseMessage, err.Error())
+	}
+	parts, err := splitJWSSignatures(jwsMessage)
+	if err != nil || len(parts) != len(msg.Signatures()) {
+		return wrap(ErrParseMessage, "signatures do not match the message")
+	}
+
+	for i, sig := range msg.Signatures() {
+		h := sig.ProtectedHeaders()
+		alg, kid := "", ""
+		if v, ok := h.Algorithm(); ok {
+			alg = v.String()
+		}
+		if v, ok := h.KeyID(); ok {
+			kid = v
+		}
+		fmt.Fprintf(w, "signature %d: alg %s, kid %s\n", i, orNone(alg), orNone(kid))
+		if keyset.Len() == 0 {
+			fmt.Fprintln(w, "  no keys to try")
+		}
+		for k, key := range keyset.All() {
+			c := j.checkKey(parts[i], alg, kid, k, key)
+			fmt.Fprintf(w, "  key %d: kid %s, %s, %s\n", c.Key, orNone(c.KeyID), strings.TrimSpace(c.KeyType+" "+c.Curve), c.Private)
+			fmt.Fprintf(w, "    alg:       %s\n", c.AlgMatch)
+			fmt.Fprintf(w, "    kid:       %s\n", c.KidMatch)
+			fmt.Fprintf(w, "    key type:  %s\n", c.Fits)
+			fmt.Fprintf(w, "    signature: %s\n", c.Signature)
+		}
+	}
+	return nil
+}
+
+// checkKey runs the checks of explain for key against one signature whose
+// header names alg and kid.
+func (j *jwsVerifier) checkKey(message []byte, alg, kid string, index int, key jwk.Key) keyCheck {
+	c := keyCheck{Key: index, KeyType: key.KeyType().String()}
+	c.KeyID, _ = key.KeyID()
+	c.Curve, _ = curveOf(key)
+	c.Private = keyVisibility(key)
+
+	// The algorithm the key is tried with: --algorithm, or for --match-kid
+	// and --allow-alg the "alg" of the key.
+	keyAlg := ""
+	if v, ok := key.Algorithm(); ok {
+		keyAlg = v.String()
+	}
+	source := "--algorithm"
+	c.Algorithm = j.Algorithm
+	if j.selectsKeyByKid() {
+		source = "the key's alg"
+		c.Algorithm = keyAlg
+	}
+	disallowed := len(j.AllowAlgs) != 0 && !contains(j.AllowAlgs, alg)
+	switch {
+	case disallowed:
+		c.AlgMatch = fmt.Sprintf("header %s is not one of --allow-alg %s", orNone(alg), strings.Join(j.AllowAlgs, ", "))
+	case c.Algorithm == "":
+		c.AlgMatch = "no algorithm: " + source + " is not set"
+	case c.Algorithm == alg:
+		c.AlgMatch = fmt.Sprintf("header %s matches %s", alg, source)
+	default:
+		c.AlgMatch = fmt.Sprintf("header %s does not match %s %s", orNone(alg), source, c.Algorithm)
+	}
+
+	switch {
+	case kid == "" && c.KeyID == "":
+		c.KidMatch = "neither the header nor the key has a kid"
+	case kid == "":
+		c.KidMatch = "the header has no kid"
+	case c.KeyID == "":
+		c.KidMatch = "the key has no kid"
+	case kid == c.KeyID:
+		c.KidMatch = "matches"
+	default:
+		c.KidMatch = fmt.Sprintf("header %q differs from key %q", kid, c.KeyID)
+	}
+	if !j.selectsKeyByKid() && c.KidMatch != "matches" {
+		c.KidMatch += " (not required without --match-kid)"
+	}
+
+	name := strings.TrimSpace(c.KeyType + " " + c.Curve)
+	fits := alg != "" && contains(signatureAlgorithmsFor(c.KeyType, c.Curve), alg)
+	var weak error // too short a key, or public key material as a secret
+	if fits {
+		c.Fits = fmt.Sprintf("%s keys sign %s", name, alg)
+		weak = checkSignatureKey(alg, key)
+	} else {
+		c.Fits = fmt.Sprintf("%s keys do not sign %s", name, orNone(alg))
+	}
+
+	switch {
+	case disallowed:
+		c.Signature = "not checked, the header alg is not allowed"
+	case c.Algorithm == "":
+		c.Signature = "not checked, no algorithm"
+	case c.Algorithm != alg:
+		c.Signature = "not checked, the header names another algorithm"
+	case !fits:
+		c.Signature = "not checked, the key cannot make this signature"
+	case weak != nil:
+		c.Signature = "not checked, " + strings.TrimPrefix(weak.Error(), ErrKeyAlgorithmMismatch.Error()+": ")
+	case j.selectsKeyByKid() && c.KidMatch != "matches":
+		// The verification itself never tries a key the kid does not name.
+		c.Signature = "not checked, the kid does not select this key"
+	default:
+		c.Signature = j.checkSignature(message, c.Algorithm, key)
+	}
+	c.Verified = c.Signature == "verified"
+	return c
+}
+
+// checkSignature verifies message with key alone and describes the outcome.
+func (j *jwsVerifier) checkSignature(message []byte, alg string, key jwk.Key) string {
+	sigAlg, ok := jwa.LookupSignatureAlgorithm(alg)
+	if !ok {
+		return "not checked, unknown algorithm " + alg
+	}
+	pub, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return "not checked, no public key: " + err.Error()
+	}
+	if _, err := jws.Verify(message, j.verifyOptions(jws.WithKey(sigAlg, pub))...); err != nil {
+		// jws.Verify reports the cause on its last line; with a single key
+		// that is only "could not be verified with any of the keys".
+		lines := strings.Split(strings.TrimSpace(err.Error()), "\n")
+		cause := lines[len(lines)-1]
+		if strings.Contains(cause, "could not be verified with any of the keys") {
+			cause = "the signature was not made with this key, or the message was altered"
+		}
+		return "failed, " + cause
+	}
+	return "verified"
+}
+
+// curveOf returns the "crv" of an EC or OKP key.
+func curveOf(key jwk.Key) (string, bool) {
+	c, ok := key.(interface {
+		Crv() (jwa.EllipticCurveAlgorithm, bool)
+	})
+	if !ok {
+		return "", false
+	}
+	crv, ok := c.Crv()
+	return crv.String(), ok
+}
+
+// keyVisibility describes whether key is a private, public or symmetric key.
+func keyVisibility(key jwk.Key) string {
+	if key.KeyType() == jwa.OctetSeq() {
+		return "symmetric key"
+	}
+	if private, err := jwk.IsPrivateKey(key); err == nil && private {
+		return "private key (its public key is used)"
+	}
+	return "public key"
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+func TestJWSVerifyExplain(t *testing.T) {
+	t.Parallel()
+
+	signer := genKey(t, "EC", "P-256", 0, "json", false)
+	message := []byte(signWith(t, signer, "ES256", writeFile(t, "payload.txt", "explained"), `{"kid":"signer"}`))
+
+	keyset := keysOf(t,
+		genKey(t, "RSA", "", 2048, "json", false),
+		genKey(t, "EC", "P-256", 0, "json", false),
+		genKeyPublicOf(t, signer),
+	)
+	last, _ := keyset.Key(2)
+	if err := last.Set(jwk.KeyIDKey, "signer"); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &jwsVerifier{Algorithm: "ES256"}
+	wants := []struct {
+		fits, verified bool
+		signature      string
+		private        string
+		kid            string
+	}{
+		{fits: false, signature: "not checked, the key cannot make this signature", private: "private key", kid: "the key has no kid"},
+		{fits: true, signature: "failed, the signature was not made with this key", private: "private key", kid: "the key has no kid"},
+		{fits: true, verified: true, signature: "verified", private: "public key", kid: "matches"},
+	}
+	for i, key := range keyset.All() {
+		c := v.checkKey(message, "ES256", "signer", i, key)
+		w := wants[i]
+		if c.Verified != w.verified || !strings.HasPrefix(c.Signature, w.signature) {
+			t.Errorf("key %d: signature %q, verified %v", i, c.Signature, c.Verified)
+		}
+		if strings.Contains(c.Fits, "do not sign") == w.fits {
+			t.Errorf("key %d: key type %q", i, c.Fits)
+		}
+		if !strings.HasPrefix(c.Private, w.private) || !strings.HasPrefix(c.KidMatch, w.kid) {
+			t.Errorf("key %d: %q, kid %q", i, c.Private, c.KidMatch)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := (&jwsVerifier{Algorithm: "RS256"}).explain(&buf, message, keyset); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"signature 0: alg ES256, kid signer",
+		"key 2: kid signer, EC P-256, public key",
+		"header ES256 does not match --algorithm RS256",
+		"not checked, the header names another algorithm",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	// With --match-kid the algorithm comes from the key.
+	buf.Reset()
+	if err := (&jwsVerifier{MatchKeyID: true}).explain(&buf, message, keyset); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "no algorithm: the key's alg is not set") {
+		t.Errorf("match-kid report:\n%s", buf.String())
+	}
+
+	// The signer's own key under another kid is never tried by --match-kid
+	// or --allow-alg, so it is not reported as verifying.
+	other := keyWithKid(t, genKeyPublicOf(t, signer), "ES256", "other")
+	for _, v := range []*jwsVerifier{{MatchKeyID: true}, {AllowAlgs: []string{"ES256"}}} {
+		c := v.checkKey(message, "ES256", "signer", 0, keyOf(t, other))
+		if c.Verified || c.Signature != "not checked, the kid does not select this key" {
+			t.Errorf("%+v: kid %q, signature %q", v, c.KidMatch, c.Signature)
+		}
+	}
+}
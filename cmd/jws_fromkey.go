@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// algorithmFromKey is the --algorithm value that takes the algorithm from the
+// "alg" member of the key. The header of the message is never consulted: an
+// attacker chooses it (RFC 8725 3.1).
+const algorithmFromKey = "from-key"
+
+// algorithmOfKeys returns the "alg" that every key of keyset declares. It
+// fails when a key has none, when keys disagree, or when jose cannot sign or
+// verify with it.
+func algorithmOfKeys(keyset jwk.Set) (string, error) {
+	if keyset.Len() == 0 {
+		return "", wrap(ErrAlgorithmFromKey, "no key to take alg from")
+	}
+	name := ""
+	for i, key := range keyset.All() {
+		alg, ok := key.Algorithm()
+		switch {
+		case !ok || alg.String() == "":
+			return "", wrap(ErrAlgorithmFromKey, fmt.Sprintf("key %d has no alg", i))
+		case name == "":
+			name = alg.String()
+		case alg.String() != name:
+			return "", wrap(ErrAlgorithmFromKey, fmt.Sprintf("key %d has alg %s, key 0 has %s", i, alg, name))
+		}
+	}
+	if !contains(supportedSignatureAlgorithms(), name) {
+		return "", wrap(ErrInvalidAlgorithm, fmt.Sprintf("the keys have alg %q", name))
+	}
+	return name, nil
+}
+
+// resolveAlgorithm replaces --algorithm from-key with the algorithm the keys
+// of --key declare. Keys embedded in the message are left out: their "alg" is
+// not covered by a pinned thumbprint.
+func (j *jwsVerifier) resolveAlgorithm(keyset jwk.Set) error {
+	if j.Algorithm != algorithmFromKey {
+		return nil
+	}
+	if j.Key == "" {
+		return wrap(ErrAlgorithmFromKey, "--algorithm from-key needs --key")
+	}
+	name, err := algorithmOfKeys(keyset)
+	if err != nil {
+		return err
+	}
+	j.Algorithm = name
+	return nil
+}
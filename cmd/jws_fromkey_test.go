@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// keyWithAlg writes the keys as a JWK set whose keys declare the given algs,
+// in order; "" leaves a key without alg.
+func keyWithAlg(t *testing.T, paths []string, algs ...string) string {
+	t.Helper()
+	set := jwk.NewSet()
+	for i, path := range paths {
+		key := keyOf(t, path)
+		if algs[i] != "" {
+			if err := key.Set(jwk.AlgorithmKey, algs[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := set.AddKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "keys.jwks", string(data))
+}
+
+func TestAlgorithmOfKeys(t *testing.T) {
+	t.Parallel()
+
+	ec := genKey(t, "EC", "P-256", 0, "json", false)
+	ec2 := genKey(t, "EC", "P-256", 0, "json", false)
+	tests := []struct {
+		name string
+		path string
+		want string
+		err  error
+	}{
+		{name: "one key", path: keyWithAlg(t, []string{ec}, "ES256"), want: "ES256"},
+		{name: "keys agree", path: keyWithAlg(t, []string{ec, ec2}, "ES256", "ES256"), want: "ES256"},
+		{name: "no alg", path: keyWithAlg(t, []string{ec}, ""), err: ErrAlgorithmFromKey},
+		{name: "one key without alg", path: keyWithAlg(t, []string{ec, ec2}, "ES256", ""), err: ErrAlgorithmFromKey},
+		{name: "keys disagree", path: keyWithAlg(t, []string{ec, ec2}, "ES256", "ES384"), err: ErrAlgorithmFromKey},
+		{name: "not a signature algorithm", path: keyWithAlg(t, []string{ec}, "ECDH-ES"), err: ErrInvalidAlgorithm},
+	}
+	for _, tt := range tests {
+		keyset, err := getKeyFile(tt.path, "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := algorithmOfKeys(keyset)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+	if _, err := algorithmOfKeys(jwk.NewSet()); !errors.Is(err, ErrAlgorithmFromKey) {
+		t.Errorf("empty set: want ErrAlgorithmFromKey, got %v", err)
+	}
+}
+
+func TestJWSAlgorithmFromKey(t *testing.T) {
+	t.Parallel()
+
+	keyPath := keyWithAlg(t, []string{genKey(t, "EC", "P-384", 0, "json", false)}, "ES384")
+	s := &jwsSigner{
+		Algorithms:    []string{algorithmFromKey},
+		Keys:          []string{keyPath},
+		KeyFormat:     "json",
+		InputFilePath: writeFile(t, "payload.txt", "from key"),
+		Output:        filepath.Join(t.TempDir(), "out.jws"),
+	}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+	message, err := os.ReadFile(s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := protectedOf(t, string(message)); header["alg"] != "ES384" {
+		t.Errorf("alg = %v, want ES384", header["alg"])
+	}
+
+	v := &jwsVerifier{Algorithm: algorithmFromKey, Key: keyPath, KeyFormat: "json", InputFilePath: s.Output, Output: filepath.Join(t.TempDir(), "payload")}
+	if err := v.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.verify(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(v.Output); string(got) != "from key" {
+		t.Errorf("payload = %q", got)
+	}
+
+	// The key, not the message, decides: a P-384 key that declares ES256 is
+	// rejected before the ES384 message is looked at.
+	wrong := keyWithAlg(t, []string{keyPath}, "ES256")
+	v = &jwsVerifier{Algorithm: algorithmFromKey, Key: wrong, KeyFormat: "json", InputFilePath: s.Output, Output: filepath.Join(t.TempDir(), "payload")}
+	if err := v.verify(); !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("want ErrKeyAlgorithmMismatch, got %v", err)
+	}
+
+	bare := genKey(t, "EC", "P-256", 0, "json", false)
+	s.Keys = []string{bare}
+	if err := s.signer(); !errors.Is(err, ErrAlgorithmFromKey) || !strings.Contains(err.Error(), bare) {
+		t.Errorf("sign with a key without alg: %v", err)
+	}
+	v = &jwsVerifier{Algorithm: algorithmFromKey, Pins: []string{strings.Repeat("A", 43)}, KeyFormat: "json", InputFilePath: s.Output, Output: "-"}
+	if err := v.verify(); !errors.Is(err, ErrAlgorithmFromKey) {
+		t.Errorf("from-key without --key: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// headerMembers merges the protected header members given by --header-file,
+// --header and --set-header, in that order, so a later source overrides an
+// earlier one member by member.
+func (j *jwsSigner) headerMembers() (map[string]json.RawMessage, error) {
+	members := map[string]json.RawMessage{}
+	merge := func(source string, data []byte) error {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(data, &m); err != nil {
+			return wrap(ErrParseHeader, fmt.Sprintf("%s: %s", source, err))
+		}
+		for name, v := range m {
+			members[name] = v
+		}
+		return nil
+	}
+
+	if j.HeaderFile != "" {
+		data, err := os.ReadFile(j.HeaderFile) //nolint:gosec // header path is supplied by the user on purpose
+		if err != nil {
+			return nil, wrap(ErrReadFile, err.Error())
+		}
+		if err := merge("--header-file", data); err != nil {
+			return nil, err
+		}
+	}
+	if j.Header != "" {
+		if err := merge("--header", []byte(j.Header)); err != nil {
+			return nil, err
+		}
+	}
+	for _, assignment := range j.SetHeaders {
+		name, value, _ := strings.Cut(assignment, "=")
+		raw, err := json.Marshal(parseHeaderValue(value))
+		if err != nil {
+			return nil, wrap(ErrParseHeader, fmt.Sprintf("--set-header %s: %s", name, err))
+		}
+		members[name] = raw
+	}
+	return members, nil
+}
+
+// protectedHeaders builds the protected header of a signature made with alg
+// from members. An "alg" member must name alg: jws.Sign would otherwise
+// replace it without a word.
+func protectedHeaders(members map[string]json.RawMessage, alg jwa.KeyAlgorithm) (jws.Headers, error) {
+	if raw, ok := members[jws.AlgorithmKey]; ok {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil || name != alg.String() {
+			return nil, wrap(ErrHeaderAlgorithm, fmt.Sprintf("the header sets alg %s, the key signs with %s", raw, alg))
+		}
+	}
+	h := jws.NewHeaders()
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, wrap(ErrParseHeader, err.Error())
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, wrap(ErrParseHeader, err.Error())
+	}
+	return h, nil
+}
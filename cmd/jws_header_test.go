@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// protectedOf returns the protected header of the first signature of message.
+func protectedOf(t *testing.T, message string) map[string]any {
+	t.Helper()
+	inspection, err := inspectJWS([]byte(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]any
+	if err := json.Unmarshal(inspection.Signatures[0].Protected.Decoded, &header); err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+func TestJWSSignHeaderSources(t *testing.T) {
+	t.Parallel()
+
+	s := &jwsSigner{
+		HeaderFile: writeFile(t, "header.json", `{"typ":"file","iss":"file","cty":"file"}`),
+		Header:     `{"typ":"flag","cty":"flag"}`,
+		SetHeaders: []string{"cty=set", "ver=2", "ok=true", `s="2"`, `o={"a":[1]}`, "url=https://example.com/a=b", "empty="},
+	}
+	members, err := s.headerMembers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"cty":"set","empty":"","iss":"file","o":{"a":[1]},"ok":true,"s":"2","typ":"flag","url":"https://example.com/a=b","ver":2}`
+	if string(got) != want {
+		t.Errorf("members = %s, want %s", got, want)
+	}
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	s.Algorithms, s.Keys, s.KeyFormat = []string{"ES256"}, []string{keyPath}, "json"
+	s.InputFilePath = writeFile(t, "payload.txt", "x")
+	s.Output = writeFile(t, "out.jws", "")
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+	message, err := os.ReadFile(s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := protectedOf(t, string(message)); header["ver"] != 2.0 || header["cty"] != "set" || header["alg"] != "ES256" {
+		t.Errorf("protected header = %v", header)
+	}
+}
+
+func TestJWSSignHeaderErrors(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	tests := []struct {
+		name   string
+		signer jwsSigner
+		want   error
+	}{
+		{name: "alg from --header", signer: jwsSigner{Header: `{"alg":"HS256"}`}, want: ErrHeaderAlgorithm},
+		{name: "alg from --set-header", signer: jwsSigner{SetHeaders: []string{"alg=none"}}, want: ErrHeaderAlgorithm},
+		{name: "alg that is not a string", signer: jwsSigner{SetHeaders: []string{"alg=1"}}, want: ErrHeaderAlgorithm},
+		{name: "same alg", signer: jwsSigner{SetHeaders: []string{"alg=ES256"}}},
+		{name: "bad header file", signer: jwsSigner{HeaderFile: writeFile(t, "header.json", `["typ"]`)}, want: ErrParseHeader},
+		{name: "missing header file", signer: jwsSigner{HeaderFile: "does-not-exist.json"}, want: ErrReadFile},
+		{name: "no value", signer: jwsSigner{SetHeaders: []string{"typ"}}, want: ErrInvalidSetHeader},
+		{name: "no name", signer: jwsSigner{SetHeaders: []string{"=JWT"}}, want: ErrInvalidSetHeader},
+	}
+	for _, tt := range tests {
+		s := tt.signer
+		s.Algorithms, s.Keys, s.KeyFormat = []string{"ES256"}, []string{keyPath}, "json"
+		s.InputFilePath = writeFile(t, "payload.txt", "x")
+		s.Output = writeFile(t, "out.jws", "")
+		err := s.valid()
+		if err == nil {
+			err = s.signer()
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
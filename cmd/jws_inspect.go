@@ -0,0 +1,545 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/nao1215/gorky/file"
+	"github.com/spf13/cobra"
+)
+
+// understoodCritical lists the "crit" extensions jose processes.
+var understoodCritical = []string{"b64"}
+
+func newJWSInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect",
+		Short: "Show every part of a JWS message and flag anomalies",
+		Long: `Inspect breaks a JWS message in FILE down without verifying it.
+Use "-" as FILE to read from STDIN, or pass the token itself.
+
+For the payload and every signature it shows the raw base64url segment next to
+its decoded form, pretty-prints JSON, and decodes the known header parameters
+(alg, kid, typ, cty, crit, b64, the certificates of x5c and the thumbprint of
+jwk). It then lists anomalies such as "alg": "none", a "crit" extension jose
+does not understand, base64 padding, and trailing data after the message.
+
+Inspect tolerates malformed messages as far as it can; anomalies do not change
+the exit status. --json writes the same breakdown as a JSON document.`,
+		RunE: runJWSInspect,
+	}
+	cmd.Flags().Bool("json", false, "write the breakdown as JSON")
+	return cmd
+}
+
+type jwsInspector struct {
+	jws  []byte `validate:"-"`
+	json bool   `validate:"-"`
+}
+
+func newJWSInspector(cmd *cobra.Command, args []string) (*jwsInspector, error) {
+	asJSON, err := cmd.Flags().GetBool("json")
+	if err != nil {
+		return nil, err
+	}
+
+	arg := ""
+	if len(args) != 0 {
+		arg = args[0]
+	}
+	if arg == "" && !stdinIsPipe() {
+		return nil, errors.New("you must specify file or jws token")
+	}
+
+	// A malformed token, say one with padding, does not pass as a token with
+	// readJWSMessage, but it is exactly what inspect is for.
+	message := []byte(arg)
+	if arg == "" || arg == "-" || file.IsFile(arg) || !looksLikeCompactHeader(arg) {
+		if message, err = readJWSMessage(arg); err != nil {
+			return nil, err
+		}
+	}
+	return &jwsInspector{jws: message, json: asJSON}, nil
+}
+
+func runJWSInspect(cmd *cobra.Command, args []string) error {
+	inspector, err := newJWSInspector(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	inspection, err := inspectJWS(inspector.jws)
+	if err != nil {
+		return err
+	}
+	if inspector.json {
+		return writeJSON(os.Stdout, inspection)
+	}
+	return inspection.writeText(os.Stdout)
+}
+
+// looksLikeCompactHeader reports whether s starts with a segment that decodes,
+// padded or not, to a JSON header followed by a ".".
+func looksLikeCompactHeader(s string) bool {
+	head, _, found := strings.Cut(s, ".")
+	if !found {
+		return false
+	}
+	header, _, err := decodeSegment(head)
+	return err == nil && json.Valid(header)
+}
+
+// jwsInspection is the breakdown "jws inspect" writes.
+type jwsInspection struct {
+	Serialization string               `json:"serialization"`
+	Payload       inspectedPayload     `json:"payload"`
+	Signatures    []inspectedSignature `json:"signatures"`
+	Anomalies     []string             `json:"anomalies"`
+}
+
+// inspectedPayload is the payload segment and what it decodes to: JSON, text,
+// or neither for binary data.
+type inspectedPayload struct {
+	Raw       string          `json:"raw"`
+	Detached  bool            `json:"detached,omitempty"`
+	Unencoded bool            `json:"unencoded,omitempty"`
+	Size      int             `json:"size"`
+	JSON      json.RawMessage `json:"json,omitempty"`
+	Text      string          `json:"text,omitempty"`
+}
+
+// inspectedSignature is one signature with its headers.
+type inspectedSignature struct {
+	Index     int             `json:"index"`
+	Protected inspectedHeader `json:"protected"`
+	// Header is the unprotected header of the JSON serializations.
+	Header    json.RawMessage `json:"header,omitempty"`
+	Params    headerParams    `json:"params"`
+	Signature inspectedBytes  `json:"signature"`
+}
+
+type inspectedHeader struct {
+	Raw     string          `json:"raw"`
+	Decoded json.RawMessage `json:"decoded,omitempty"`
+}
+
+type inspectedBytes struct {
+	Raw  string `json:"raw"`
+	Size int    `json:"size"`
+}
+
+// headerParams are the known parameters of the protected and unprotected
+// header together.
+type headerParams struct {
+	Algorithm     string               `json:"alg,omitempty"`
+	KeyID         string               `json:"kid,omitempty"`
+	Type          string               `json:"typ,omitempty"`
+	ContentType   string               `json:"cty,omitempty"`
+	Critical      []string             `json:"crit,omitempty"`
+	B64           *bool                `json:"b64,omitempty"`
+	X5C           []certificateSummary `json:"x5c,omitempty"`
+	JWKThumbprint string               `json:"jwk_thumbprint,omitempty"`
+}
+
+type certificateSummary struct {
+	Subject   string    `json:"subject,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	NotBefore time.Time `json:"not_before,omitzero"`
+	NotAfter  time.Time `json:"not_after,omitzero"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// jsonJWSMessage holds the members of both JWS JSON serializations.
+type jsonJWSMessage struct {
+	Payload    *string         `json:"payload"`
+	Protected  string          `json:"protected"`
+	Header     json.RawMessage `json:"header"`
+	Signature  *string         `json:"signature"`
+	Signatures []struct {
+		Protected string          `json:"protected"`
+		Header    json.RawMessage `json:"header"`
+		Signature string          `json:"signature"`
+	} `json:"signatures"`
+}
+
+func (i *jwsInspection) flag(format string, args ...any) {
+	i.Anomalies = append(i.Anomalies, fmt.Sprintf(format, args...))
+}
+
+// flagSignature records an anomaly of signature n.
+func (i *jwsInspection) flagSignature(n int, format string, args ...any) {
+	i.flag("signature %d: %s", n, fmt.Sprintf(format, args...))
+}
+
+// inspectJWS breaks message down. It only fails when message is not shaped
+// like a JWS at all; everything else that is wrong becomes an anomaly.
+func inspectJWS(message []byte) (*jwsInspection, error) {
+	i := &jwsInspection{Anomalies: []string{}}
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) != 0 && trimmed[0] == '{' {
+		if err := i.inspectJSON(trimmed); err != nil {
+			return nil, err
+		}
+		return i, nil
+	}
+
+	text := string(trimmed)
+	if end := strings.IndexAny(text, " \t\r\n"); end >= 0 {
+		i.flag("trailing data after the token: %q", shorten(text[end:]))
+		text = text[:end]
+	}
+	parts := strings.Split(text, ".")
+	if len(parts) < 3 {
+		return nil, wrap(ErrParseMessage, fmt.Sprintf("a compact JWS has 3 dot-separated segments, this has %d", len(parts)))
+	}
+	if len(parts) > 3 {
+		i.flag("trailing data after the signature: %d more segments", len(parts)-3)
+	}
+	i.Serialization = "compact"
+	i.Signatures = []inspectedSignature{i.inspectSignature(0, parts[0], nil, parts[2])}
+	i.inspectPayload(&parts[1])
+	return i, nil
+}
+
+func (i *jwsInspection) inspectJSON(data []byte) error {
+	var msg jsonJWSMessage
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&msg); err != nil {
+		return wrap(ErrParseMessage, err.Error())
+	}
+	if rest := bytes.TrimSpace(data[dec.InputOffset():]); len(rest) != 0 {
+		i.flag("trailing data after the JSON object: %q", shorten(string(rest)))
+	}
+
+	switch {
+	case msg.Signatures != nil:
+		i.Serialization = "json"
+		if msg.Signature != nil {
+			i.flag(`both "signatures" and "signature": the flattened members are ignored`)
+		}
+		for n, s := range msg.Signatures {
+			i.Signatures = append(i.Signatures, i.inspectSignature(n, s.Protected, s.Header, s.Signature))
+		}
+		if len(msg.Signatures) == 0 {
+			i.flag(`"signatures" is empty`)
+		}
+	case msg.Signature != nil:
+		i.Serialization = "flattened"
+		i.Signatures = []inspectedSignature{i.inspectSignature(0, msg.Protected, msg.Header, *msg.Signature)}
+	default:
+		return wrap(ErrParseMessage, `no "signatures" or "signature" member`)
+	}
+	i.inspectPayload(msg.Payload)
+	return nil
+}
+
+// inspectPayload decodes raw, nil for a detached payload, as the b64 header
+// of the first signature says.
+func (i *jwsInspection) inspectPayload(raw *string) {
+	if raw == nil || *raw == "" {
+		i.Payload.Detached = true
+		return
+	}
+	i.Payload.Raw = *raw
+
+	b64 := true
+	for n, s := range i.Signatures {
+		v := s.Params.B64 == nil || *s.Params.B64
+		if n == 0 {
+			b64 = v
+		} else if v != b64 {
+			i.flagSignature(n, `"b64" differs from signature 0`)
+		}
+	}
+
+	payload := []byte(*raw)
+	if b64 {
+		decoded, padded, err := decodeSegment(*raw)
+		if padded {
+			i.flag("payload: base64 padding (=) in the segment")
+		}
+		if err != nil {
+			i.flag("payload: not base64url: %v", err)
+			return
+		}
+		payload = decoded
+	} else {
+		i.Payload.Unencoded = true
+	}
+
+	i.Payload.Size = len(payload)
+	switch {
+	case json.Valid(payload):
+		i.Payload.JSON = json.RawMessage(payload)
+	case utf8.Valid(payload):
+		i.Payload.Text = string(payload)
+	}
+}
+
+// inspectSignature decodes the headers and signature of signature n.
+func (i *jwsInspection) inspectSignature(n int, protected string, unprotected json.RawMessage, signature string) inspectedSignature {
+	s := inspectedSignature{Index: n, Protected: inspectedHeader{Raw: protected}, Header: unprotected}
+
+	members := map[string]json.RawMessage{}
+	decoded, padded, err := decodeSegment(protected)
+	switch {
+	case protected == "":
+		i.flagSignature(n, "no protected header")
+	case err != nil:
+		i.flagSignature(n, "protected header is not base64url: %v", err)
+	case json.Unmarshal(decoded, &members) != nil:
+		i.flagSignature(n, "protected header is not a JSON object")
+	default:
+		s.Protected.Decoded = json.RawMessage(decoded)
+	}
+	if padded {
+		i.flagSignature(n, "base64 padding (=) in the protected header")
+	}
+
+	if len(unprotected) != 0 {
+		var public map[string]json.RawMessage
+		if err := json.Unmarshal(unprotected, &public); err != nil {
+			i.flagSignature(n, "unprotected header is not a JSON object")
+		}
+		for name, v := range public {
+			if _, ok := members[name]; ok {
+				i.flagSignature(n, "%q is in both the protected and the unprotected header", name)
+				continue
+			}
+			if name == "crit" {
+				i.flagSignature(n, `"crit" must be in the protected header`)
+			}
+			members[name] = v
+		}
+	}
+	s.Params = i.inspectParams(n, members)
+
+	sig, padded, err := decodeSegment(signature)
+	if padded {
+		i.flagSignature(n, "base64 padding (=) in the signature")
+	}
+	if err != nil {
+		i.flagSignature(n, "signature is not base64url: %v", err)
+	}
+	s.Signature = inspectedBytes{Raw: signature, Size: len(sig)}
+	if len(sig) == 0 && !strings.EqualFold(s.Params.Algorithm, "none") {
+		i.flagSignature(n, "empty signature")
+	}
+	return s
+}
+
+// inspectParams decodes the known parameters of a JOSE header.
+func (i *jwsInspection) inspectParams(n int, members map[string]json.RawMessage) headerParams {
+	var p headerParams
+	str := func(name string, dst *string) {
+		if v, ok := members[name]; ok && json.Unmarshal(v, dst) != nil {
+			i.flagSignature(n, "%q is not a string", name)
+		}
+	}
+	str("alg", &p.Algorithm)
+	str("kid", &p.KeyID)
+	str("typ", &p.Type)
+	str("cty", &p.ContentType)
+
+	_, hasAlg := members["alg"]
+	switch {
+	case !hasAlg:
+		i.flagSignature(n, `no "alg"`)
+	case strings.EqualFold(p.Algorithm, "none"):
+		i.flagSignature(n, `"alg" is "none": the message is not signed`)
+	default:
+		if _, ok := jwa.LookupSignatureAlgorithm(p.Algorithm); !ok {
+			i.flagSignature(n, "unknown algorithm %q", p.Algorithm)
+		}
+	}
+
+	if v, ok := members["b64"]; ok && json.Unmarshal(v, &p.B64) != nil {
+		i.flagSignature(n, `"b64" is not a boolean`)
+	}
+	if v, ok := members["crit"]; ok {
+		if err := json.Unmarshal(v, &p.Critical); err != nil {
+			i.flagSignature(n, `"crit" is not a list of names`)
+		} else if len(p.Critical) == 0 {
+			i.flagSignature(n, `"crit" is empty`)
+		}
+	}
+	for _, name := range p.Critical {
+		if !contains(understoodCritical, name) {
+			i.flagSignature(n, "critical extension %q is not understood", name)
+		}
+		if _, ok := members[name]; !ok {
+			i.flagSignature(n, "critical extension %q is not in the header", name)
+		}
+	}
+	if p.B64 != nil && !*p.B64 && !contains(p.Critical, "b64") {
+		i.flagSignature(n, `"b64" is false but not listed in "crit"`)
+	}
+
+	if v, ok := members["x5c"]; ok {
+		var chain []string
+		if err := json.Unmarshal(v, &chain); err != nil {
+			i.flagSignature(n, `"x5c" is not a list of certificates`)
+		}
+		for k, c := range chain {
+			summary := summarizeCertificate(c)
+			if summary.Error != "" {
+				i.flagSignature(n, "x5c certificate %d: %s", k, summary.Error)
+			}
+			p.X5C = append(p.X5C, summary)
+		}
+	}
+
+	if v, ok := members["jwk"]; ok {
+		key, err := jwk.ParseKey(v)
+		if err != nil {
+			i.flagSignature(n, `"jwk" is not a key: %v`, err)
+			return p
+		}
+		if key.KeyType() == jwa.OctetSeq() {
+			i.flagSignature(n, `"jwk" holds a symmetric key`)
+		} else if private, err := jwk.IsPrivateKey(key); err == nil && private {
+			i.flagSignature(n, `"jwk" holds a private key`)
+		}
+		if thumbprint, err := key.Thumbprint(crypto.SHA256); err == nil {
+			p.JWKThumbprint = base64.RawURLEncoding.EncodeToString(thumbprint)
+		}
+	}
+	return p
+}
+
+// summarizeCertificate describes one base64 DER certificate of an x5c chain.
+func summarizeCertificate(encoded string) certificateSummary {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return certificateSummary{Error: "not base64: " + err.Error()}
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		return certificateSummary{Error: err.Error()}
+	}
+	return certificateSummary{
+		Subject:   c.Subject.String(),
+		Issuer:    c.Issuer.String(),
+		NotBefore: c.NotBefore.UTC(),
+		NotAfter:  c.NotAfter.UTC(),
+	}
+}
+
+// decodeSegment decodes a base64url segment, tolerating the padding that
+// compact serializations forbid; padded reports whether it was there.
+func decodeSegment(s string) (decoded []byte, padded bool, err error) {
+	trimmed := strings.TrimRight(s, "=")
+	decoded, err = base64.RawURLEncoding.DecodeString(trimmed)
+	return decoded, trimmed != s, err
+}
+
+// shorten cuts s to a length that fits an anomaly line.
+func shorten(s string) string {
+	const limit = 40
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "..."
+}
+
+// writeText writes the inspection in a human-readable form.
+func (i *jwsInspection) writeText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "serialization: %s\n", i.Serialization)
+
+	p := i.Payload
+	switch {
+	case p.Detached:
+		fmt.Fprintln(&b, "payload: detached")
+	default:
+		kind := "base64url"
+		if p.Unencoded {
+			kind = "unencoded"
+		}
+		fmt.Fprintf(&b, "payload (%d bytes):\n  %s: %s\n", p.Size, kind, p.Raw)
+		switch {
+		case p.JSON != nil:
+			fmt.Fprintf(&b, "  decoded:\n%s\n", indentJSON(p.JSON, "    "))
+		case p.Text != "" && !p.Unencoded:
+			fmt.Fprintf(&b, "  decoded: %s\n", p.Text)
+		case p.Text == "" && p.Size != 0:
+			fmt.Fprintln(&b, "  decoded: (binary)")
+		}
+	}
+
+	for _, s := range i.Signatures {
+		fmt.Fprintf(&b, "signature %d:\n", s.Index)
+		fmt.Fprintf(&b, "  protected header:\n    base64url: %s\n", s.Protected.Raw)
+		if s.Protected.Decoded != nil {
+			fmt.Fprintf(&b, "    decoded:\n%s\n", indentJSON(s.Protected.Decoded, "      "))
+		}
+		if s.Header != nil {
+			fmt.Fprintf(&b, "  unprotected header:\n%s\n", indentJSON(s.Header, "    "))
+		}
+		writeParams(&b, s.Params)
+		fmt.Fprintf(&b, "  signature (%d bytes):\n    base64url: %s\n", s.Signature.Size, orNone(s.Signature.Raw))
+	}
+
+	if len(i.Anomalies) == 0 {
+		fmt.Fprintln(&b, "anomalies: none")
+	} else {
+		fmt.Fprintln(&b, "anomalies:")
+		for _, a := range i.Anomalies {
+			fmt.Fprintf(&b, "  - %s\n", a)
+		}
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return wrap(ErrWriteJSON, err.Error())
+	}
+	return nil
+}
+
+func writeParams(b *strings.Builder, p headerParams) {
+	for _, param := range []struct{ name, value string }{
+		{"alg", p.Algorithm},
+		{"kid", p.KeyID},
+		{"typ", p.Type},
+		{"cty", p.ContentType},
+		{"crit", strings.Join(p.Critical, ", ")},
+	} {
+		if param.value != "" {
+			fmt.Fprintf(b, "  %-5s %s\n", param.name+":", param.value)
+		}
+	}
+	if p.B64 != nil {
+		fmt.Fprintf(b, "  b64:  %t\n", *p.B64)
+	}
+	for n, c := range p.X5C {
+		if c.Error != "" {
+			fmt.Fprintf(b, "  x5c %d: %s\n", n, c.Error)
+			continue
+		}
+		fmt.Fprintf(b, "  x5c %d: subject %s, issuer %s, valid %s to %s\n", n, c.Subject, c.Issuer,
+			c.NotBefore.Format(time.DateOnly), c.NotAfter.Format(time.DateOnly))
+	}
+	if p.JWKThumbprint != "" {
+		fmt.Fprintf(b, "  jwk:  thumbprint %s\n", p.JWKThumbprint)
+	}
+}
+
+// indentJSON pretty-prints a JSON value with every line prefixed by prefix.
+func indentJSON(raw json.RawMessage, prefix string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(raw), prefix, "    "); err != nil {
+		return prefix + string(raw)
+	}
+	return prefix + buf.String()
+}
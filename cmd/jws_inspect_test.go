@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestInspectJWS(t *testing.T) {
+	t.Parallel()
+
+	enc := base64.RawURLEncoding.EncodeToString
+	sig := strings.Split(sampleJWS, ".")[2]
+	token := func(header, payload string) string {
+		return enc([]byte(header)) + "." + enc([]byte(payload)) + "." + sig
+	}
+
+	tests := []struct {
+		name          string
+		message       string
+		serialization string
+		wantAnomalies []string
+	}{
+		{name: "clean token", message: sampleJWS, serialization: "compact"},
+		{name: "trailing newline is not trailing data", message: sampleJWS + "\n", serialization: "compact"},
+		{
+			name:          "alg none",
+			message:       enc([]byte(`{"alg":"none"}`)) + "." + enc([]byte("hi")) + ".",
+			serialization: "compact",
+			wantAnomalies: []string{`signature 0: "alg" is "none": the message is not signed`},
+		},
+		{
+			name:          "unknown crit",
+			message:       token(`{"alg":"ES256","crit":["exp"],"exp":1}`, "hi"),
+			serialization: "compact",
+			wantAnomalies: []string{`signature 0: critical extension "exp" is not understood`},
+		},
+		{
+			name:          "padding",
+			message:       enc([]byte(`{"alg":"ES256"}`)) + "=." + enc([]byte("hi")) + "." + sig,
+			serialization: "compact",
+			wantAnomalies: []string{"signature 0: base64 padding (=) in the protected header"},
+		},
+		{
+			name:          "trailing segments",
+			message:       sampleJWS + ".extra",
+			serialization: "compact",
+			wantAnomalies: []string{"trailing data after the signature: 1 more segments"},
+		},
+		{
+			name:          "trailing data after JSON",
+			message:       `{"payload":"aGk","protected":"eyJhbGciOiJFUzI1NiJ9","signature":"` + sig + `"} junk`,
+			serialization: "flattened",
+			wantAnomalies: []string{`trailing data after the JSON object: "junk"`},
+		},
+		{
+			name:          "b64 false without crit",
+			message:       enc([]byte(`{"alg":"ES256","b64":false}`)) + ".hi." + sig,
+			serialization: "compact",
+			wantAnomalies: []string{`signature 0: "b64" is false but not listed in "crit"`},
+		},
+		{
+			name:          "header in both places",
+			message:       `{"payload":"aGk","signatures":[{"protected":"eyJhbGciOiJFUzI1NiJ9","header":{"alg":"HS256"},"signature":"` + sig + `"}]}`,
+			serialization: "json",
+			wantAnomalies: []string{`signature 0: "alg" is in both the protected and the unprotected header`},
+		},
+		{
+			name:          "jwk with a secret",
+			message:       token(`{"alg":"HS256","jwk":{"kty":"oct","k":"AQID"}}`, "hi"),
+			serialization: "compact",
+			wantAnomalies: []string{`signature 0: "jwk" holds a symmetric key`},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := inspectJWS([]byte(tt.message))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Serialization != tt.serialization {
+				t.Errorf("serialization = %q, want %q", got.Serialization, tt.serialization)
+			}
+			for _, want := range tt.wantAnomalies {
+				if !contains(got.Anomalies, want) {
+					t.Errorf("anomaly %q missing from %q", want, got.Anomalies)
+				}
+			}
+			if len(tt.wantAnomalies) == 0 && len(got.Anomalies) != 0 {
+				t.Errorf("unexpected anomalies %q", got.Anomalies)
+			}
+		})
+	}
+}
+
+func TestInspectJWSDecodes(t *testing.T) {
+	t.Parallel()
+
+	got, err := inspectJWS([]byte(signWith(t, genKey(t, "EC", "P-256", 0, "json", false), "ES256",
+		writeFile(t, "payload.json", `{"sub":"alice"}`), `{"kid":"k1","typ":"JWT"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := got.Signatures[0].Params
+	if p.Algorithm != "ES256" || p.KeyID != "k1" || p.Type != "JWT" {
+		t.Errorf("params = %+v", p)
+	}
+	if string(got.Payload.JSON) != `{"sub":"alice"}` || got.Signatures[0].Signature.Size != 64 {
+		t.Errorf("inspection = %+v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := got.writeText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"serialization: compact", `"sub": "alice"`, "alg:  ES256", "typ:  JWT", "signature (64 bytes)", "anomalies: none"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("text output lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	detached, err := inspectJWS([]byte("eyJhbGciOiJFUzI1NiJ9.." + strings.Split(sampleJWS, ".")[2]))
+	if err != nil || !detached.Payload.Detached {
+		t.Errorf("detached payload not recognized: %+v, %v", detached, err)
+	}
+
+	if _, err := inspectJWS([]byte("not-a-token")); !errors.Is(err, ErrParseMessage) {
+		t.Errorf("want ErrParseMessage, got %v", err)
+	}
+}
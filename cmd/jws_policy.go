@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bytes"
+	"cmp"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+)
+
+// Values of "jws verify --require" besides a number of signatures.
+const (
+	requireAny = "any"
+	requireAll = "all"
+)
+
+// signatureResult is the outcome of verifying one signature of a message.
+type signatureResult struct {
+	Index     int
+	Algorithm string
+	KeyID     string
+	Verified  bool
+	// Key is the position of the verifying key in the key set, and
+	// thumbprint its RFC 7638 thumbprint; both are only set when Verified.
+	Key        int
+	KeyKeyID   string
+	thumbprint string
+	// Critical is the "crit" header of the signature.
+	Critical []string
+	// protected is the decoded protected header.
+	protected json.RawMessage
+	Err       error
+}
+
+// validRequire reports whether require is "any", "all" or a positive number.
+func validRequire(require string) bool {
+	switch require {
+	case "", requireAny, requireAll:
+		return true
+	}
+	n, err := strconv.Atoi(require)
+	return err == nil && n > 0
+}
+
+// policySatisfied reports whether results meet --require, "any" when it is
+// not given, and describes the outcome. A number N needs N signatures verified
+// by N different keys, so a key that signed twice is not mistaken for a second
+// approver.
+func (j *jwsVerifier) policySatisfied(results []signatureResult) (bool, string) {
+	require := cmp.Or(j.Require, requireAny)
+	verified := 0
+	keys := map[string]struct{}{}
+	for _, r := range results {
+		if r.Verified {
+			verified++
+			keys[r.thumbprint] = struct{}{}
+		}
+	}
+	summary := fmt.Sprintf("%d of %d signatures verified (require %s)", verified, len(results), require)
+	switch require {
+	case requireAny:
+		return verified > 0, summary
+	case requireAll:
+		return verified == len(results), summary
+	}
+	n, _ := strconv.Atoi(require)
+	return len(keys) >= n, fmt.Sprintf("%s, by %d different keys", summary, len(keys))
+}
+
+// writePolicyResult verifies every signature of the message on its own and
+// writes the payload when --require is met. --explain reports each outcome.
+func (j *jwsVerifier) writePolicyResult(w io.Writer, jwsMessage []byte, keyset jwk.Set) error {
+	results, payload, err := j.verifySignatures(jwsMessage, keyset)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Verified {
+			j.explainf("signature %d: verified by key %d, alg %s, kid %s", r.Index, r.Key, orNone(r.Algorithm), orNone(r.KeyID))
+			continue
+		}
+		j.explainf("signature %d: not verified, alg %s, kid %s", r.Index, orNone(r.Algorithm), orNone(r.KeyID))
+	}
+	ok, summary := j.policySatisfied(results)
+	if !ok {
+		return wrap(ErrVerifyPolicy, summary)
+	}
+	j.explainf("%s", summary)
+	j.writePayload(w, payload)
+	return nil
+}
+
+// verifySignatures checks each signature of jwsMessage against every key of
+// keyset, with --algorithm or, for --match-kid and --allow-alg, with the key
+// named by kid.
+func (j *jwsVerifier) verifySignatures(jwsMessage []byte, keyset jwk.Set) ([]signatureResult, []byte, error) {
+	msg, err := jws.Parse(jwsMessage)
+	if err != nil {
+		return nil, nil, wrap(ErrParseMessage, err.Error())
+	}
+	parts, err := splitJWSSignatures(jwsMessage)
+	if err != nil {
+		return nil, nil, wrap(ErrParseMessage, err.Error())
+	}
+
+	var alg jwa.SignatureAlgorithm
+	if !j.selectsKeyByKid() {
+		var ok bool
+		if alg, ok = jwa.LookupSignatureAlgorithm(j.Algorithm); !ok {
+			return nil, nil, wrap(ErrInvalidAlgorithm, j.Algorithm)
+		}
+	}
+	pubset, err := jwk.PublicSetOf(keyset, jwk.WithAllowSymmetric(true))
+	if err != nil {
+		return nil, nil, wrap(ErrVerifyJWSMessage, err.Error())
+	}
+
+	if len(parts) != len(msg.Signatures()) {
+		return nil, nil, wrap(ErrParseMessage, "signatures do not match the message")
+	}
+
+	results := make([]signatureResult, 0, len(parts))
+	for i, sig := range msg.Signatures() {
+		r := signatureResult{Index: i, Key: -1}
+		if v, ok := sig.ProtectedHeaders().Algorithm(); ok {
+			r.Algorithm = v.String()
+		}
+		if v, ok := sig.ProtectedHeaders().KeyID(); ok {
+			r.KeyID = v
+		}
+		r.Critical, _ = sig.ProtectedHeaders().Critical()
+		if r.protected, err = json.Marshal(sig.ProtectedHeaders()); err != nil {
+			return nil, nil, wrap(ErrSerializeJOSN, err.Error())
+		}
+		for k, key := range pubset.All() {
+			var err error
+			switch {
+			case j.MatchKeyID:
+				err = j.verifyWithKeySet(parts[i], key)
+			case len(j.AllowAlgs) != 0:
+				err = j.verifyAllowedWith(parts[i], key)
+			default:
+				if err = checkSignatureKey(alg.String(), key); err == nil {
+					_, err = jws.Verify(parts[i], j.verifyOptions(jws.WithKey(alg, key))...)
+				}
+			}
+			if err != nil {
+				r.Err = err
+				continue
+			}
+			r.Verified, r.Key, r.Err = true, k, nil
+			r.KeyKeyID, _ = key.KeyID()
+			thumbprint, err := key.Thumbprint(crypto.SHA256)
+			if err != nil {
+				return nil, nil, wrap(ErrParseKey, err.Error())
+			}
+			r.thumbprint = base64.RawURLEncoding.EncodeToString(thumbprint)
+			break
+		}
+		results = append(results, r)
+	}
+	return results, msg.Payload(), nil
+}
+
+// verifyWithKeySet verifies with key under the --match-kid rules: the key
+// must carry the kid the signature names and an alg it fits.
+func (j *jwsVerifier) verifyWithKeySet(message []byte, key jwk.Key) error {
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return err
+	}
+	_, err := j.verifyByKid(message, set, kidKey)
+	return err
+}
+
+// splitJWSSignatures returns one message per signature of data, so that each
+// signature can be verified on its own. A compact or flattened message has a
+// single signature and is returned as is; the signatures of a general JSON
+// message are each combined with the payload into a flattened message.
+func splitJWSSignatures(data []byte) ([][]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return [][]byte{data}, nil
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &members); err != nil {
+		return nil, err
+	}
+	raw, ok := members["signatures"]
+	if !ok {
+		return [][]byte{data}, nil
+	}
+	var signatures []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &signatures); err != nil {
+		return nil, err
+	}
+	delete(members, "signatures")
+	parts := make([][]byte, 0, len(signatures))
+	for _, signature := range signatures {
+		for name, v := range members {
+			signature[name] = v
+		}
+		part, err := json.Marshal(signature)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
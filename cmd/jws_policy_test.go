@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// multiSigned signs payload with every key file using ES256 and returns the
+// general JSON message.
+func multiSigned(t *testing.T, payload string, keys ...string) []byte {
+	t.Helper()
+	algs := make([]string, len(keys))
+	for i := range keys {
+		algs[i] = "ES256"
+	}
+	s := &jwsSigner{
+		Algorithms:    algs,
+		Keys:          keys,
+		KeyFormat:     "json",
+		Serialization: "json",
+		InputFilePath: writeFile(t, "payload.txt", payload),
+		Output:        filepath.Join(t.TempDir(), "out.json"),
+	}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// keysOf reads the key of every file into one set.
+func keysOf(t *testing.T, paths ...string) jwk.Set {
+	t.Helper()
+	set := jwk.NewSet()
+	for _, p := range paths {
+		if err := set.AddKey(keyOf(t, p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return set
+}
+
+func TestJWSVerifyRequirePolicy(t *testing.T) {
+	t.Parallel()
+
+	alice := genKey(t, "EC", "P-256", 0, "json", false)
+	bob := genKey(t, "EC", "P-256", 0, "json", false)
+	mallory := genKey(t, "EC", "P-256", 0, "json", false)
+	approved := multiSigned(t, "config", alice, bob)
+	selfApproved := multiSigned(t, "config", alice, alice)
+
+	tests := []struct {
+		name    string
+		message []byte
+		keys    jwk.Set
+		require string
+		wantErr error
+	}{
+		{"all with both keys", approved, keysOf(t, alice, bob), "all", nil},
+		{"all with one key", approved, keysOf(t, alice), "all", ErrVerifyPolicy},
+		{"any with one key", approved, keysOf(t, bob), "any", nil},
+		{"any with a stranger", approved, keysOf(t, mallory), "any", ErrVerifyPolicy},
+		{"two of two", approved, keysOf(t, alice, bob, mallory), "2", nil},
+		{"three of two", approved, keysOf(t, alice, bob), "3", ErrVerifyPolicy},
+		{"two signatures by one key", selfApproved, keysOf(t, alice, bob), "2", ErrVerifyPolicy},
+		{"all of a self signed message", selfApproved, keysOf(t, alice), "all", nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf, stderr bytes.Buffer
+			err := (&jwsVerifier{Algorithm: "ES256", Require: tt.require, stderr: &stderr}).writeVerifyResult(&buf, tt.message, tt.keys)
+			if stderr.Len() != 0 {
+				t.Errorf("report written without --explain: %q", stderr.String())
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && buf.String() != "config" {
+				t.Errorf("payload = %q", buf.String())
+			}
+			if tt.wantErr != nil && buf.Len() != 0 {
+				t.Errorf("payload written although the policy failed: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestJWSVerifySignaturesReportsKeys(t *testing.T) {
+	t.Parallel()
+
+	alice := genKey(t, "EC", "P-256", 0, "json", false)
+	bob := genKey(t, "EC", "P-256", 0, "json", false)
+	message := multiSigned(t, "config", alice, bob)
+
+	results, payload, err := (&jwsVerifier{Algorithm: "ES256", Require: "all"}).verifySignatures(message, keysOf(t, bob, alice))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(payload) != "config" {
+		t.Errorf("payload = %q", payload)
+	}
+	// Signature 0 is alice's, the second key of the set, and signature 1 bob's.
+	for i, wantKey := range []int{1, 0} {
+		if r := results[i]; !r.Verified || r.Key != wantKey || r.KeyID == "" {
+			t.Errorf("signature %d: %+v, want verified by key %d", i, r, wantKey)
+		}
+	}
+
+	// --match-kid uses the kid of each signature instead of --algorithm. The
+	// keys have no kid, so the signer named them by thumbprint.
+	withAlg := keysOf(t, alice, bob)
+	for _, key := range withAlg.All() {
+		if err := key.Set(jwk.AlgorithmKey, "ES256"); err != nil {
+			t.Fatal(err)
+		}
+		if err := setThumbprintKeyID(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := (&jwsVerifier{MatchKeyID: true, Require: "all"}).writeVerifyResult(&buf, message, withAlg); err != nil {
+		t.Fatalf("match-kid: %v", err)
+	}
+}
+
+func TestJWSVerifyRequireExplain(t *testing.T) {
+	t.Parallel()
+
+	alice := genKey(t, "EC", "P-256", 0, "json", false)
+	bob := genKey(t, "EC", "P-256", 0, "json", false)
+	message := multiSigned(t, "config", alice, bob)
+
+	var buf, stderr bytes.Buffer
+	v := &jwsVerifier{Algorithm: "ES256", Require: "all", Explain: true, stderr: &stderr}
+	if err := v.writeVerifyResult(&buf, message, keysOf(t, alice)); !errors.Is(err, ErrVerifyPolicy) {
+		t.Fatalf("want ErrVerifyPolicy, got %v", err)
+	}
+	for _, want := range []string{"signature 0: verified by key 0", "signature 1: not verified, alg ES256"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, stderr.String())
+		}
+	}
+
+	stderr.Reset()
+	v.Require = "any"
+	if err := v.writeVerifyResult(&buf, message, keysOf(t, alice)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "1 of 2 signatures verified (require any)") {
+		t.Errorf("report lacks the summary:\n%s", stderr.String())
+	}
+}
+
+func TestSplitJWSSignatures(t *testing.T) {
+	t.Parallel()
+
+	parts, err := splitJWSSignatures([]byte(`{"payload":"cA","signatures":[{"protected":"e30","signature":"YQ"},{"protected":"e30","header":{"kid":"b"},"signature":"Yg"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("want 2 parts, got %d", len(parts))
+	}
+	var second map[string]any
+	if err := json.Unmarshal(parts[1], &second); err != nil {
+		t.Fatal(err)
+	}
+	if second["payload"] != "cA" || second["signature"] != "Yg" || second["header"] == nil {
+		t.Errorf("second part = %s", parts[1])
+	}
+
+	compact := []byte(sampleJWS)
+	if parts, err := splitJWSSignatures(compact); err != nil || len(parts) != 1 || !bytes.Equal(parts[0], compact) {
+		t.Errorf("compact message split into %q, %v", parts, err)
+	}
+}
+
+func TestValidRequire(t *testing.T) {
+	t.Parallel()
+
+	for in, want := range map[string]bool{"": true, "any": true, "all": true, "2": true, "0": false, "-1": false, "most": false} {
+		if got := validRequire(in); got != want {
+			t.Errorf("validRequire(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if err := (&jwsVerifier{Algorithm: "ES256", Key: "k.json", KeyFormat: "json", Require: "most"}).valid(); !errors.Is(err, ErrInvalidRequire) {
+		t.Errorf("want ErrInvalidRequire, got %v", err)
+	}
+}
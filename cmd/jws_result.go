@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// verifyResult is the document "jws verify --result-json" writes.
+type verifyResult struct {
+	Verified bool `json:"verified"`
+	// Algorithm, Key, Protected and Critical describe the first verified
+	// signature.
+	Algorithm     string            `json:"algorithm,omitempty"`
+	Key           *verifyResultKey  `json:"key,omitempty"`
+	Protected     json.RawMessage   `json:"protected,omitempty"`
+	Critical      []string          `json:"crit,omitempty"`
+	Payload       json.RawMessage   `json:"payload,omitempty"`
+	PayloadBase64 string            `json:"payload_base64,omitempty"`
+	Signatures    []signatureReport `json:"signatures"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// verifyResultKey identifies the key that verified a signature.
+type verifyResultKey struct {
+	Index      int    `json:"index"`
+	KeyID      string `json:"kid,omitempty"`
+	Thumbprint string `json:"thumbprint"`
+}
+
+// signatureReport is the outcome for one signature in a verifyResult.
+type signatureReport struct {
+	Index     int              `json:"index"`
+	Verified  bool             `json:"verified"`
+	Algorithm string           `json:"algorithm,omitempty"`
+	KeyID     string           `json:"kid,omitempty"`
+	Critical  []string         `json:"crit,omitempty"`
+	Protected json.RawMessage  `json:"protected"`
+	Key       *verifyResultKey `json:"key,omitempty"`
+}
+
+// writeResultJSON verifies jwsMessage like writePolicyResult and writes the
+// outcome as a verifyResult instead of the payload. The document is written
+// whether or not verification succeeds; the error still tells the caller,
+// and so the exit status, that it failed.
+func (j *jwsVerifier) writeResultJSON(w io.Writer, jwsMessage []byte, keyset jwk.Set) error {
+	doc, verifyErr := j.resultOf(jwsMessage, keyset)
+	if doc == nil {
+		return verifyErr
+	}
+	if err := writeJSON(w, doc); err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// resultOf verifies jwsMessage and describes the outcome. The error tells
+// whether verification failed; the document is nil only when the message
+// cannot be parsed.
+func (j *jwsVerifier) resultOf(jwsMessage []byte, keyset jwk.Set) (*verifyResult, error) {
+	results, payload, err := j.verifySignatures(jwsMessage, keyset)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := verifyResult{Signatures: make([]signatureReport, 0, len(results))}
+	first := -1
+	for _, r := range results {
+		report := signatureReport{
+			Index:     r.Index,
+			Verified:  r.Verified,
+			Algorithm: r.Algorithm,
+			KeyID:     r.KeyID,
+			Critical:  r.Critical,
+			Protected: r.protected,
+		}
+		if r.Verified {
+			report.Key = &verifyResultKey{Index: r.Key, KeyID: r.KeyKeyID, Thumbprint: r.thumbprint}
+		}
+		doc.Signatures = append(doc.Signatures, report)
+		if r.Verified && first < 0 {
+			first = len(doc.Signatures) - 1
+		}
+	}
+
+	verifyErr := j.checkHeaders(jwsMessage)
+	ok, summary := j.policySatisfied(results)
+	if ok && verifyErr == nil {
+		doc.Verified = true
+		f := doc.Signatures[first]
+		doc.Algorithm, doc.Key, doc.Protected, doc.Critical = f.Algorithm, f.Key, f.Protected, f.Critical
+		if !j.suppliesPayload() {
+			doc.setPayload(payload)
+		}
+	} else {
+		switch {
+		case verifyErr != nil:
+		case j.Require == "":
+			verifyErr = wrap(ErrVerifyJWSMessage, "no key verifies any signature")
+		default:
+			verifyErr = wrap(ErrVerifyPolicy, summary)
+		}
+		doc.Error = verifyErr.Error()
+	}
+	return &doc, verifyErr
+}
+
+// setPayload stores payload as JSON when it is a JSON text, and base64
+// encoded otherwise.
+func (r *verifyResult) setPayload(payload []byte) {
+	if json.Valid(payload) {
+		r.Payload = json.RawMessage(payload)
+		return
+	}
+	r.PayloadBase64 = base64.StdEncoding.EncodeToString(payload)
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestJWSVerifyResultJSON(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	keyset := keysOf(t, keyPath)
+
+	tests := []struct {
+		name        string
+		payload     string
+		keys        []string
+		wantErr     error
+		wantPayload string
+		wantBase64  string
+	}{
+		{name: "JSON payload", payload: `{"sub":"alice"}`, keys: []string{keyPath}, wantPayload: `{"sub":"alice"}`},
+		{name: "binary payload", payload: "\x00\x01plain", keys: []string{keyPath}, wantBase64: "AAFwbGFpbg=="},
+		{name: "wrong key", payload: `{"sub":"alice"}`, keys: []string{genKey(t, "EC", "P-256", 0, "json", false)}, wantErr: ErrVerifyJWSMessage},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			message := []byte(signWith(t, keyPath, "ES256", writeFile(t, "payload", tt.payload), `{"kid":"k1"}`))
+			var buf bytes.Buffer
+			err := (&jwsVerifier{Algorithm: "ES256", ResultJSON: true}).writeVerifyResult(&buf, message, keysOf(t, tt.keys...))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("want %v, got %v", tt.wantErr, err)
+			}
+
+			var doc struct {
+				Verified  bool              `json:"verified"`
+				Algorithm string            `json:"algorithm"`
+				Key       *verifyResultKey  `json:"key"`
+				Protected map[string]any    `json:"protected"`
+				Payload   json.RawMessage   `json:"payload"`
+				Base64    string            `json:"payload_base64"`
+				Sigs      []signatureReport `json:"signatures"`
+				Error     string            `json:"error"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+				t.Fatalf("result is not JSON: %v\n%s", err, buf.String())
+			}
+			if doc.Verified != (tt.wantErr == nil) || len(doc.Sigs) != 1 {
+				t.Fatalf("result: %s", buf.String())
+			}
+			if tt.wantErr != nil {
+				if doc.Error == "" || doc.Key != nil || doc.Payload != nil {
+					t.Errorf("failed result: %s", buf.String())
+				}
+				return
+			}
+			if doc.Algorithm != "ES256" || doc.Protected["kid"] != "k1" || doc.Key == nil || doc.Key.Thumbprint == "" {
+				t.Errorf("result: %s", buf.String())
+			}
+			// writeJSON indents the payload along with the rest.
+			var payload bytes.Buffer
+			if doc.Payload != nil {
+				if err := json.Compact(&payload, doc.Payload); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if payload.String() != tt.wantPayload || doc.Base64 != tt.wantBase64 {
+				t.Errorf("payload %s / %q", doc.Payload, doc.Base64)
+			}
+		})
+	}
+
+	// The thumbprint names the verifying key, whatever its position.
+	var buf bytes.Buffer
+	message := []byte(signWith(t, keyPath, "ES256", writeFile(t, "payload", "x"), ""))
+	if err := (&jwsVerifier{Algorithm: "ES256", ResultJSON: true}).writeVerifyResult(&buf, message, keyset); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := keyset.Key(0)
+	if err := setThumbprintKeyID(key); err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := key.KeyID()
+	if !bytes.Contains(buf.Bytes(), []byte(`"thumbprint": "`+kid+`"`)) {
+		t.Errorf("thumbprint %s not reported:\n%s", kid, buf.String())
+	}
+}
@@ -2,13 +2,17 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
 )
 
 // issueRSAPrivateJWK is the RSA private key reported in issue #54.
@@ -44,8 +48,8 @@ func TestJWSSignVerifySelfSigned(t *testing.T) {
 	}
 
 	signer := &jwsSigner{
-		Algorithm:     "RS256",
-		Key:           keyPath,
+		Algorithms:    []string{"RS256"},
+		Keys:          []string{keyPath},
 		KeyFormat:     "json",
 		InputFilePath: payloadPath,
 		Output:        jwsPath,
@@ -83,8 +87,8 @@ func signWith(t *testing.T, keyPath, alg, payloadPath, header string) string {
 	t.Helper()
 	out := filepath.Join(t.TempDir(), "out.jws")
 	s := &jwsSigner{
-		Algorithm:     alg,
-		Key:           keyPath,
+		Algorithms:    []string{alg},
+		Keys:          []string{keyPath},
 		KeyFormat:     "json",
 		Header:        header,
 		InputFilePath: payloadPath,
@@ -117,6 +121,7 @@ func TestJWSSignVerifyRoundTripAcrossAlgorithms(t *testing.T) {
 		{name: "RSA PS512", keyType: "RSA", size: 2048, alg: "PS512"},
 		{name: "EC ES256", keyType: "EC", curve: "P-256", size: 2048, alg: "ES256"},
 		{name: "EC ES512", keyType: "EC", curve: "P-521", size: 2048, alg: "ES512"},
+		{name: "EC ES256K", keyType: "EC", curve: "secp256k1", size: 2048, alg: "ES256K"},
 		{name: "OKP EdDSA", keyType: "OKP", curve: "Ed25519", size: 2048, alg: "EdDSA"},
 		{name: "oct HS256", keyType: "oct", size: 256, alg: "HS256"},
 	}
@@ -264,22 +269,22 @@ func TestJWSSignValidation(t *testing.T) {
 	}{
 		{
 			name:    "missing algorithm",
-			signer:  &jwsSigner{Algorithm: "", Key: "k.json", KeyFormat: "json"},
+			signer:  &jwsSigner{Algorithms: []string{""}, Keys: []string{"k.json"}, KeyFormat: "json"},
 			wantErr: ErrInvalidAlgorithm,
 		},
 		{
 			name:    "missing key",
-			signer:  &jwsSigner{Algorithm: "ES256", Key: "", KeyFormat: "json"},
+			signer:  &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{""}, KeyFormat: "json"},
 			wantErr: ErrRequireKeyFile,
 		},
 		{
 			name:    "invalid algorithm",
-			signer:  &jwsSigner{Algorithm: "FOO", Key: "k.json", KeyFormat: "json"},
+			signer:  &jwsSigner{Algorithms: []string{"FOO"}, Keys: []string{"k.json"}, KeyFormat: "json"},
 			wantErr: ErrInvalidAlgorithm,
 		},
 		{
 			name:    "invalid key format",
-			signer:  &jwsSigner{Algorithm: "ES256", Key: "k.json", KeyFormat: "der"},
+			signer:  &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{"k.json"}, KeyFormat: "der"},
 			wantErr: ErrInvalidKeyFormat,
 		},
 	}
@@ -345,3 +350,527 @@ func TestNewJWSSignerMissingArgs(t *testing.T) {
 		t.Errorf("expected empty input path, got %q", s.InputFilePath)
 	}
 }
+
+func TestJWSSignSerializations(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	keyset, err := getKeyFile(keyPath, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serialization string
+		wantMembers   []string
+	}{
+		{serialization: "json", wantMembers: []string{`"signatures":[`, `"header":{"kid":"k1"}`}},
+		{serialization: "flattened", wantMembers: []string{`"signature":"`, `"header":{"kid":"k1"}`}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.serialization, func(t *testing.T) {
+			t.Parallel()
+
+			out := filepath.Join(t.TempDir(), "out.json")
+			s := &jwsSigner{
+				Algorithms:        []string{"ES256"},
+				Keys:              []string{keyPath},
+				KeyFormat:         "json",
+				UnprotectedHeader: `{"kid":"k1"}`,
+				Serialization:     tt.serialization,
+				InputFilePath:     writeFile(t, "payload.txt", "serialized"),
+				Output:            out,
+			}
+			if err := s.valid(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.signer(); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			data, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range tt.wantMembers {
+				if !strings.Contains(string(data), m) {
+					t.Errorf("%s output lacks %s: %s", tt.serialization, m, data)
+				}
+			}
+			if tt.serialization == "flattened" && strings.Contains(string(data), `"signatures"`) {
+				t.Errorf("flattened output has a signatures array: %s", data)
+			}
+
+			// The inline message is recognised as a JWS, not taken for a path.
+			inline, err := readJWSMessage(string(data))
+			if err != nil {
+				t.Fatalf("read inline message: %v", err)
+			}
+			var buf bytes.Buffer
+			if err := (&jwsVerifier{Algorithm: "ES256"}).writeVerifyResult(&buf, inline, keyset); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if buf.String() != "serialized" {
+				t.Errorf("payload mismatch: %q", buf.String())
+			}
+
+			msg, err := jws.Parse(inline)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			buf.Reset()
+			if err := printAll(&buf, msg); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(buf.String(), "unprotected header") {
+				t.Errorf("parse --all does not show the unprotected header: %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestJWSSignUnprotectedHeaderNeedsJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, serialization := range []string{"", "compact"} {
+		s := &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{"k.json"}, KeyFormat: "json", Serialization: serialization, UnprotectedHeader: `{"kid":"k1"}`}
+		if err := s.valid(); !errors.Is(err, ErrUnprotectedHeaderInCompact) {
+			t.Errorf("%q: want ErrUnprotectedHeaderInCompact, got %v", serialization, err)
+		}
+	}
+	s := &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{"k.json"}, KeyFormat: "json", Serialization: "xml"}
+	if err := s.valid(); !errors.Is(err, ErrInvalidSerialization) {
+		t.Errorf("want ErrInvalidSerialization, got %v", err)
+	}
+}
+
+func TestJWSSignUnprotectedHeaderRejects(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "oct", "", 256, "json", false)
+	payloadPath := writeFile(t, "payload.txt", "x")
+	for name, header := range map[string]string{
+		"also protected": `{"alg":"none"}`,
+		"null":           `null`,
+		"array":          `[]`,
+		"crit":           `{"crit":["exp"],"exp":1}`,
+		"b64":            `{"b64":false}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := &jwsSigner{
+				Algorithms:        []string{"HS256"},
+				Keys:              []string{keyPath},
+				KeyFormat:         "json",
+				UnprotectedHeader: header,
+				Serialization:     "flattened",
+				InputFilePath:     payloadPath,
+				Output:            filepath.Join(t.TempDir(), "out.json"),
+			}
+			if err := s.signer(); !errors.Is(err, ErrParseHeader) {
+				t.Errorf("want ErrParseHeader, got %v", err)
+			}
+			if _, err := os.Stat(s.Output); !os.IsNotExist(err) {
+				t.Errorf("output was written: %v", err)
+			}
+		})
+	}
+}
+
+func TestJWSSignMultipleSignatures(t *testing.T) {
+	t.Parallel()
+
+	rsaPath := genKey(t, "RSA", "", 2048, "json", false)
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	payloadPath := writeFile(t, "payload.txt", "dual-signed")
+
+	// The JWK set form: every key names its algorithm and one has a kid.
+	rsaKey, ecKey := keyOf(t, rsaPath), keyOf(t, ecPath)
+	if err := rsaKey.Set(jwk.AlgorithmKey, "RS256"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rsaKey.Set(jwk.KeyIDKey, "rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ecKey.Set(jwk.AlgorithmKey, "ES256"); err != nil {
+		t.Fatal(err)
+	}
+	set := jwk.NewSet()
+	for _, k := range []jwk.Key{rsaKey, ecKey} {
+		if err := set.AddKey(k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setJSON, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setPath := writeFile(t, "jwks.json", string(setJSON))
+
+	tests := []struct {
+		name   string
+		signer *jwsSigner
+	}{
+		{
+			name:   "key and algorithm pairs",
+			signer: &jwsSigner{Algorithms: []string{"RS256", "ES256"}, Keys: []string{rsaPath, ecPath}},
+		},
+		{
+			name:   "JWK set whose keys carry alg",
+			signer: &jwsSigner{Keys: []string{setPath}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := tt.signer
+			s.KeyFormat, s.Serialization, s.InputFilePath = "json", "json", payloadPath
+			s.Output = filepath.Join(t.TempDir(), "out.json")
+			if err := s.valid(); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.signer(); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			data, err := os.ReadFile(s.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg, err := jws.Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sigs := msg.Signatures()
+			if len(sigs) != 2 {
+				t.Fatalf("want 2 signatures, got %d", len(sigs))
+			}
+			for i, want := range []string{"RS256", "ES256"} {
+				h := sigs[i].ProtectedHeaders()
+				if alg, _ := h.Algorithm(); alg.String() != want {
+					t.Errorf("signature %d alg = %v, want %s", i, alg, want)
+				}
+				if kid, _ := h.KeyID(); kid == "" {
+					t.Errorf("signature %d has no kid", i)
+				}
+			}
+
+			// Either key verifies the message on its own.
+			for alg, path := range map[string]string{"RS256": rsaPath, "ES256": ecPath} {
+				keyset, err := getKeyFile(genKeyPublicOf(t, path), "json")
+				if err != nil {
+					t.Fatal(err)
+				}
+				var buf bytes.Buffer
+				if err := (&jwsVerifier{Algorithm: alg}).writeVerifyResult(&buf, data, keyset); err != nil {
+					t.Fatalf("verify %s: %v", alg, err)
+				}
+				if buf.String() != "dual-signed" {
+					t.Errorf("payload mismatch: %q", buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestJWSSignMultipleSignaturesValidation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		signer  *jwsSigner
+		wantErr error
+	}{
+		{
+			name:    "fewer algorithms than keys",
+			signer:  &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{"a.json", "b.json"}, KeyFormat: "json", Serialization: "json"},
+			wantErr: ErrKeyAlgorithmPairs,
+		},
+		{
+			name:    "no algorithm with several key files",
+			signer:  &jwsSigner{Keys: []string{"a.json", "b.json"}, KeyFormat: "json", Serialization: "json"},
+			wantErr: ErrKeyAlgorithmPairs,
+		},
+		{
+			name:    "several keys in compact",
+			signer:  &jwsSigner{Algorithms: []string{"ES256", "RS256"}, Keys: []string{"a.json", "b.json"}, KeyFormat: "json"},
+			wantErr: ErrMultipleSignatures,
+		},
+		{
+			name:    "several keys flattened",
+			signer:  &jwsSigner{Algorithms: []string{"ES256", "RS256"}, Keys: []string{"a.json", "b.json"}, KeyFormat: "json", Serialization: "flattened"},
+			wantErr: ErrMultipleSignatures,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tt.signer.valid(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("valid() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Without --algorithm, a key file of one key is the old "algorithm
+	// required" mistake, not a JWK set to take algorithms from.
+	s := &jwsSigner{
+		Keys:          []string{genKey(t, "EC", "P-256", 0, "json", false)},
+		KeyFormat:     "json",
+		InputFilePath: writeFile(t, "payload.txt", "x"),
+		Output:        filepath.Join(t.TempDir(), "out.jws"),
+	}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); !errors.Is(err, ErrInvalidAlgorithm) {
+		t.Errorf("want ErrInvalidAlgorithm, got %v", err)
+	}
+}
+
+func TestJWSDetachedPayload(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	keyset, err := getKeyFile(keyPath, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := []byte("a large artifact")
+
+	for _, serialization := range []string{"compact", "json", "flattened"} {
+		t.Run(serialization, func(t *testing.T) {
+			t.Parallel()
+
+			s := &jwsSigner{
+				Algorithms:    []string{"ES256"},
+				Keys:          []string{keyPath},
+				KeyFormat:     "json",
+				Serialization: serialization,
+				Detached:      true,
+				InputFilePath: writeFile(t, "artifact.bin", string(payload)),
+				Output:        filepath.Join(t.TempDir(), "out"),
+			}
+			if err := s.signer(); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			message, err := os.ReadFile(s.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hasDetachedPayload(message) {
+				t.Fatalf("payload is embedded: %s", message)
+			}
+			if serialization == "compact" && !looksLikeCompactJWS(string(message)) {
+				t.Errorf("detached token is not recognised as a JWS: %s", message)
+			}
+
+			var buf bytes.Buffer
+			if err := (&jwsVerifier{Algorithm: "ES256"}).writeVerifyResult(&buf, message, keyset); !errors.Is(err, ErrRequireDetachedPayload) {
+				t.Errorf("without --payload: want ErrRequireDetachedPayload, got %v", err)
+			}
+			for _, require := range []string{"", "all"} {
+				v := &jwsVerifier{Algorithm: "ES256", Require: require, detached: payload}
+				if err := v.writeVerifyResult(&buf, message, keyset); err != nil {
+					t.Errorf("require %q: verify: %v", require, err)
+				}
+				tampered := &jwsVerifier{Algorithm: "ES256", Require: require, detached: []byte("another artifact")}
+				if err := tampered.writeVerifyResult(&buf, message, keyset); err == nil {
+					t.Errorf("require %q: a different payload verified", require)
+				}
+			}
+			if buf.Len() != 0 {
+				t.Errorf("detached payload was printed: %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestJWSVerifyPayloadAndMessageFromStdin(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{"", "-"} {
+		v := &jwsVerifier{Algorithm: "ES256", Key: "k.json", KeyFormat: "json", Payload: "-", InputFilePath: input}
+		if err := v.valid(); !errors.Is(err, ErrPayloadAndMessageFromStdin) {
+			t.Errorf("input %q: want ErrPayloadAndMessageFromStdin, got %v", input, err)
+		}
+	}
+}
+
+func TestJWSUnencodedPayload(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 0, "json", false)
+	keyset, err := getKeyFile(keyPath, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const text = "pay $100, now"
+
+	tests := []struct {
+		serialization string
+		detached      bool
+	}{
+		{serialization: "compact"},
+		{serialization: "compact", detached: true},
+		{serialization: "json"},
+		{serialization: "flattened"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(fmt.Sprintf("%s detached=%v", tt.serialization, tt.detached), func(t *testing.T) {
+			t.Parallel()
+
+			s := &jwsSigner{
+				Algorithms:       []string{"ES256"},
+				Keys:             []string{keyPath},
+				KeyFormat:        "json",
+				Serialization:    tt.serialization,
+				Detached:         tt.detached,
+				UnencodedPayload: true,
+				InputFilePath:    writeFile(t, "payload.txt", text),
+				Output:           filepath.Join(t.TempDir(), "out"),
+			}
+			if err := s.signer(); err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+			message, err := os.ReadFile(s.Output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.detached && !strings.Contains(string(message), text) {
+				t.Errorf("payload is not carried as is: %s", message)
+			}
+
+			msg, err := jws.Parse(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := msg.Signatures()[0].ProtectedHeaders()
+			if b64, ok := h.B64(); !ok || b64 {
+				t.Errorf("b64 = %v, %v; want false", b64, ok)
+			}
+			if crit, _ := h.Critical(); len(crit) != 1 || crit[0] != "b64" {
+				t.Errorf("crit = %v, want [b64]", crit)
+			}
+
+			v := &jwsVerifier{Algorithm: "ES256"}
+			if tt.detached {
+				v.detached = []byte(text)
+			}
+			var buf bytes.Buffer
+			if err := v.writeVerifyResult(&buf, message, keyset); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if !tt.detached && buf.String() != text {
+				t.Errorf("payload = %q", buf.String())
+			}
+		})
+	}
+
+	// A compact message cannot carry an unencoded payload with a ".".
+	s := &jwsSigner{
+		Algorithms:       []string{"ES256"},
+		Keys:             []string{keyPath},
+		KeyFormat:        "json",
+		UnencodedPayload: true,
+		InputFilePath:    writeFile(t, "payload.txt", "a.b"),
+		Output:           filepath.Join(t.TempDir(), "out"),
+	}
+	if err := s.signer(); !errors.Is(err, ErrSignPayload) {
+		t.Errorf("want ErrSignPayload, got %v", err)
+	}
+}
+
+func TestJWSDetachedPayloadIsStreamed(t *testing.T) {
+	// --max-input-size bounds what is read into memory, not what is streamed:
+	// only the detached payloads of digest algorithms sign and verify past it.
+	withMaxInputSize(t, 1024)
+
+	artifact := writeFile(t, "artifact.bin", strings.Repeat("x", 4096))
+	tests := []struct {
+		name     string
+		kty      string
+		crv      string
+		size     int
+		alg      string
+		detached bool
+		wantErr  error
+	}{
+		{name: "ES256", kty: "EC", crv: "P-256", alg: "ES256", detached: true},
+		{name: "HS256", kty: "oct", size: 256, alg: "HS256", detached: true},
+		{name: "PS256", kty: "RSA", size: 2048, alg: "PS256", detached: true},
+		{name: "EdDSA", kty: "OKP", crv: "Ed25519", alg: "EdDSA", detached: true, wantErr: ErrInputTooLarge},
+		{name: "embedded", kty: "EC", crv: "P-256", alg: "ES256", wantErr: ErrInputTooLarge},
+	}
+	for _, tt := range tests {
+		keyPath := genKey(t, tt.kty, tt.crv, tt.size, "json", false)
+		s := &jwsSigner{
+			Algorithms:    []string{tt.alg},
+			Keys:          []string{keyPath},
+			KeyFormat:     "json",
+			Detached:      tt.detached,
+			InputFilePath: artifact,
+			Output:        filepath.Join(t.TempDir(), "out.jws"),
+		}
+		err := s.signer()
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.wantErr, err)
+			continue
+		}
+		if err != nil || !tt.detached {
+			continue
+		}
+		v := &jwsVerifier{Algorithm: tt.alg, Key: keyPath, KeyFormat: "json", Payload: artifact, InputFilePath: s.Output, Output: filepath.Join(t.TempDir(), "payload")}
+		if err := v.verify(); err != nil {
+			t.Errorf("%s: the detached signature does not verify: %v", tt.name, err)
+		}
+		// --explain tries the payload more than once, so reads it into memory.
+		v.Explain, v.stderr = true, io.Discard
+		if err := v.verify(); !errors.Is(err, ErrInputTooLarge) {
+			t.Errorf("%s: explain: want ErrInputTooLarge, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestJWSVerifyStreamsThePayload(t *testing.T) {
+	t.Parallel()
+
+	ecPath := genKey(t, "EC", "P-256", 0, "json", false)
+	artifact := writeFile(t, "artifact.bin", strings.Repeat("x", 4096))
+	s := &jwsSigner{Algorithms: []string{"ES256"}, Keys: []string{ecPath}, KeyFormat: "json", Detached: true, InputFilePath: artifact, Output: filepath.Join(t.TempDir(), "out.jws")}
+	if err := s.signer(); err != nil {
+		t.Fatal(err)
+	}
+	message, err := os.ReadFile(s.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name    string
+		v       jwsVerifier
+		keyset  jwk.Set
+		streams bool
+	}{
+		{name: "one key", v: jwsVerifier{Algorithm: "ES256"}, keyset: keysOf(t, ecPath), streams: true},
+		{name: "key set", v: jwsVerifier{Algorithm: "ES256"}, keyset: keysOf(t, ecPath, genKey(t, "EC", "P-256", 0, "json", false))},
+		{name: "require", v: jwsVerifier{Algorithm: "ES256", Require: requireAll}, keyset: keysOf(t, ecPath)},
+		{name: "explain", v: jwsVerifier{Algorithm: "ES256", Explain: true}, keyset: keysOf(t, ecPath)},
+	} {
+		v := tt.v
+		v.Payload = artifact
+		payload, err := v.openPayload(message, tt.keyset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.payload != nil; got != tt.streams {
+			t.Errorf("%s: streams = %v, want %v", tt.name, got, tt.streams)
+		}
+		if err := v.writeVerifyResult(io.Discard, message, tt.keyset); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		_ = payload.Close()
+	}
+}
@@ -0,0 +1,578 @@
+package cmd
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwe"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/nao1215/gorky/file"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// keystoreKeyPrefix marks a --key value that names a keystore entry
+	// ("keystore:signer") instead of a key file.
+	keystoreKeyPrefix = "keystore:"
+	// keystorePathEnv overrides the default keystore location.
+	keystorePathEnv = "JOSE_KEYSTORE"
+	// keystorePasswordEnv holds the master password. It is the only password
+	// source for "keystore:<name>" references, because those are resolved deep
+	// inside other commands that have no keystore flags of their own.
+	keystorePasswordEnv = "JOSE_KEYSTORE_PASSWORD"
+	// keystoreVersion is the version of the sealed JSON document.
+	keystoreVersion = 1
+)
+
+// keystoreNamePattern restricts entry names to characters that are safe in a
+// "keystore:<name>" reference and in file names derived from it.
+var keystoreNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func newKeystoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "keystore",
+		Short: "Manage a local keystore sealed with a master password",
+		Long: `Manage a local keystore: a single file that holds named JWKs and is
+sealed as a JWE with PBES2-HS512+A256KW and A256GCM under a master password.
+
+Every command that takes --key also accepts "keystore:<name>" to use an
+entry of the keystore instead of a key file.
+
+The keystore lives at $JOSE_KEYSTORE, or at jose/keystore.jwe under the user
+configuration directory when that is unset. The master password is read from
+--password-file, or from $JOSE_KEYSTORE_PASSWORD.
+`,
+	}
+
+	cmd.PersistentFlags().StringP("keystore", "S", "", "keystore file (default $JOSE_KEYSTORE or <config dir>/jose/keystore.jwe)")
+	cmd.PersistentFlags().StringP("password-file", "P", "", "file that holds the master password (default $JOSE_KEYSTORE_PASSWORD)")
+
+	cmd.AddCommand(newKeystoreInitCmd())
+	cmd.AddCommand(newKeystoreAddCmd())
+	cmd.AddCommand(newKeystoreListCmd())
+	cmd.AddCommand(newKeystoreExportCmd())
+	cmd.AddCommand(newKeystoreDeleteCmd())
+	return cmd
+}
+
+// keystore is the JSON document sealed inside the keystore file.
+type keystore struct {
+	Version int              `json:"version"`
+	Entries []*keystoreEntry `json:"entries"`
+}
+
+// keystoreEntry is one named key in the keystore. The key is kept as raw JSON
+// so that every member of the original JWK survives a load/save cycle.
+type keystoreEntry struct {
+	Name  string          `json:"name"`
+	Added time.Time       `json:"added"`
+	Key   json.RawMessage `json:"key"`
+}
+
+// key parses the stored JWK.
+func (e *keystoreEntry) key() (jwk.Key, error) {
+	key, err := jwk.ParseKey(e.Key)
+	if err != nil {
+		return nil, wrap(ErrParseKey, fmt.Sprintf("keystore entry %q: %s", e.Name, err.Error()))
+	}
+	return key, nil
+}
+
+// lookup returns the entry called name, or nil.
+func (ks *keystore) lookup(name string) *keystoreEntry {
+	for _, e := range ks.Entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// remove deletes the entry called name and reports whether it existed.
+func (ks *keystore) remove(name string) bool {
+	before := len(ks.Entries)
+	ks.Entries = slices.DeleteFunc(ks.Entries, func(e *keystoreEntry) bool {
+		return e.Name == name
+	})
+	return len(ks.Entries) != before
+}
+
+// defaultKeystorePath returns the keystore location used when neither
+// --keystore nor $JOSE_KEYSTORE is given.
+func defaultKeystorePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", wrap(ErrKeystoreNotFound, err.Error())
+	}
+	return filepath.Join(dir, "jose", "keystore.jwe"), nil
+}
+
+// resolveKeystorePath picks the keystore location: the flag value, then
+// $JOSE_KEYSTORE, then the default under the user configuration directory.
+func resolveKeystorePath(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	if env := os.Getenv(keystorePathEnv); env != "" {
+		return env, nil
+	}
+	return defaultKeystorePath()
+}
+
+// keystorePassword reads the master password from passwordFile, or from
+// $JOSE_KEYSTORE_PASSWORD when no file is given. A trailing newline in the
+// file is ignored so "echo secret > pw" works.
+func keystorePassword(passwordFile string) ([]byte, error) {
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile) //nolint:gosec // password path is supplied by the user on purpose
+		if err != nil {
+			return nil, wrap(ErrOpenFile, err.Error())
+		}
+		if password := chop(string(data)); password != "" {
+			return []byte(password), nil
+		}
+		return nil, ErrKeystorePassword
+	}
+	if env := os.Getenv(keystorePasswordEnv); env != "" {
+		return []byte(env), nil
+	}
+	return nil, ErrKeystorePassword
+}
+
+// openKeystore reads and unseals the keystore at path.
+func openKeystore(path string, password []byte) (*keystore, error) {
+	if !file.IsFile(path) {
+		return nil, wrap(ErrKeystoreNotFound, path)
+	}
+	sealed, err := os.ReadFile(path) //nolint:gosec // keystore path is supplied by the user on purpose
+	if err != nil {
+		return nil, wrap(ErrOpenFile, err.Error())
+	}
+
+	plain, err := jwe.Decrypt(sealed, jwe.WithKey(jwa.PBES2_HS512_A256KW(), password))
+	if err != nil {
+		return nil, wrap(ErrOpenKeystore, err.Error())
+	}
+
+	var ks keystore
+	if err := json.Unmarshal(plain, &ks); err != nil {
+		return nil, wrap(ErrOpenKeystore, err.Error())
+	}
+	if ks.Version != keystoreVersion {
+		return nil, wrap(ErrOpenKeystore, fmt.Sprintf("unsupported keystore version %d", ks.Version))
+	}
+	return &ks, nil
+}
+
+// save seals the keystore and writes it to path. The file is written next to
+// its destination and renamed into place so an interrupted write never leaves
+// a truncated keystore behind.
+func (ks *keystore) save(path string, password []byte) error {
+	plain, err := json.Marshal(ks)
+	if err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+
+	sealed, err := jwe.Encrypt(plain,
+		jwe.WithKey(jwa.PBES2_HS512_A256KW(), password),
+		jwe.WithContentEncryption(jwa.A256GCM()))
+	if err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(sealed); err != nil {
+		_ = tmp.Close()
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+	if err := tmp.Close(); err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return wrap(ErrSaveKeystore, err.Error())
+	}
+	return nil
+}
+
+// isKeystoreRef reports whether a --key value names a keystore entry.
+func isKeystoreRef(keyFile string) bool {
+	return strings.HasPrefix(keyFile, keystoreKeyPrefix)
+}
+
+// loadKeystoreKey resolves a "keystore:<name>" reference to a key set holding
+// that single entry. The keystore location and password come from the
+// environment because the calling command has no keystore flags.
+func loadKeystoreKey(ref string) (jwk.Set, error) {
+	name := strings.TrimPrefix(ref, keystoreKeyPrefix)
+	if !keystoreNamePattern.MatchString(name) {
+		return nil, wrap(ErrKeystoreEntryName, name)
+	}
+
+	path, err := resolveKeystorePath("")
+	if err != nil {
+		return nil, err
+	}
+	password, err := keystorePassword("")
+	if err != nil {
+		return nil, err
+	}
+	ks, err := openKeystore(path, password)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := ks.lookup(name)
+	if entry == nil {
+		return nil, wrap(ErrKeystoreEntryNotFound, name)
+	}
+	key, err := entry.key()
+	if err != nil {
+		return nil, err
+	}
+
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	return set, nil
+}
+
+// keystoreOptions carries the flags shared by every keystore subcommand.
+type keystoreOptions struct {
+	Path     string
+	Password []byte
+}
+
+func newKeystoreOptions(cmd *cobra.Command) (*keystoreOptions, error) {
+	path, err := cmd.Flags().GetString("keystore")
+	if err != nil {
+		return nil, err
+	}
+	passwordFile, err := cmd.Flags().GetString("password-file")
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = resolveKeystorePath(path)
+	if err != nil {
+		return nil, err
+	}
+	password, err := keystorePassword(passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	return &keystoreOptions{Path: path, Password: password}, nil
+}
+
+// keystoreName returns the entry name given as the first argument.
+func keystoreName(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", ErrKeystoreEntryName
+	}
+	if !keystoreNamePattern.MatchString(args[0]) {
+		return "", wrap(ErrKeystoreEntryName, args[0])
+	}
+	return args[0], nil
+}
+
+func newKeystoreInitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Create an empty keystore",
+		Args:  cobra.NoArgs,
+		RunE:  runKeystoreInit,
+	}
+	cmd.Flags().BoolP("force", "f", false, "overwrite an existing keystore (its keys are lost)")
+	return cmd
+}
+
+func runKeystoreInit(cmd *cobra.Command, _ []string) error {
+	opts, err := newKeystoreOptions(cmd)
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	return opts.init(force)
+}
+
+func (o *keystoreOptions) init(force bool) error {
+	if file.Exists(o.Path) && !force {
+		return wrap(ErrKeystoreExists, o.Path)
+	}
+	ks := &keystore{Version: keystoreVersion, Entries: []*keystoreEntry{}}
+	return ks.save(o.Path, o.Password)
+}
+
+func newKeystoreAddCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add NAME",
+		Short: "Add a key to the keystore under NAME",
+		Long: `Add the single key in --key to the keystore under NAME.
+NAME may contain letters, digits, '.', '_' and '-'.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runKeystoreAdd,
+	}
+	cmd.Flags().StringP("key", "k", "", "file name that contains the key to add (single JWK)")
+	cmd.Flags().StringP("key-format", "F", "json", "format of the store key (json/pem/p12/jks)")
+	cmd.Flags().String("key-password-file", "", "file that holds the password of a p12 or jks key (default $JOSE_KEY_PASSWORD)")
+	cmd.Flags().String("alias", "", "alias of the jks entry to use (may be omitted when the keystore holds one entry)")
+	cmd.Flags().String("entry-password-file", "", "file that holds the password of the jks entry (default: the keystore password)")
+	cmd.Flags().BoolP("force", "f", false, "replace an existing entry with the same name")
+	return cmd
+}
+
+func runKeystoreAdd(cmd *cobra.Command, args []string) error {
+	opts, err := newKeystoreOptions(cmd)
+	if err != nil {
+		return err
+	}
+	name, err := keystoreName(args)
+	if err != nil {
+		return err
+	}
+	keyFile, err := cmd.Flags().GetString("key")
+	if err != nil {
+		return err
+	}
+	keyFormat, err := cmd.Flags().GetString("key-format")
+	if err != nil {
+		return err
+	}
+	keyPasswordFile, err := cmd.Flags().GetString("key-password-file")
+	if err != nil {
+		return err
+	}
+	alias, err := cmd.Flags().GetString("alias")
+	if err != nil {
+		return err
+	}
+	entryPasswordFile, err := cmd.Flags().GetString("entry-password-file")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	if keyFile == "" {
+		return ErrRequireKeyFile
+	}
+	if isKeystoreRef(keyFile) {
+		return wrap(ErrInvalidKeyFormat, "a keystore entry cannot be added from the keystore itself")
+	}
+
+	keyset, err := keySource{
+		Path:              keyFile,
+		Format:            keyFormat,
+		PasswordFile:      keyPasswordFile,
+		Alias:             alias,
+		EntryPasswordFile: entryPasswordFile,
+	}.load()
+	if err != nil {
+		return err
+	}
+	if keyset.Len() != 1 {
+		return ErrNotContainKey
+	}
+	key, _ := keyset.Key(0)
+	return opts.add(name, key, force)
+}
+
+func (o *keystoreOptions) add(name string, key jwk.Key, force bool) error {
+	ks, err := openKeystore(o.Path, o.Password)
+	if err != nil {
+		return err
+	}
+	if ks.lookup(name) != nil {
+		if !force {
+			return wrap(ErrKeystoreEntryExists, name)
+		}
+		ks.remove(name)
+	}
+
+	raw, err := json.Marshal(key)
+	if err != nil {
+		return wrap(ErrSerializeJOSN, err.Error())
+	}
+	ks.Entries = append(ks.Entries, &keystoreEntry{
+		Name:  name,
+		Added: time.Now().UTC().Truncate(time.Second),
+		Key:   raw,
+	})
+	return ks.save(o.Path, o.Password)
+}
+
+func newKeystoreListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List the keys in the keystore",
+		Long: `List the keys in the keystore with their type, algorithm, key ID,
+RFC 7638 SHA-256 thumbprint and the time they were added.`,
+		Args: cobra.NoArgs,
+		RunE: runKeystoreList,
+	}
+}
+
+func runKeystoreList(cmd *cobra.Command, _ []string) error {
+	opts, err := newKeystoreOptions(cmd)
+	if err != nil {
+		return err
+	}
+	return opts.list(os.Stdout)
+}
+
+func (o *keystoreOptions) list(w io.Writer) error {
+	ks, err := openKeystore(o.Path, o.Password)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tKTY\tALG\tKID\tTHUMBPRINT\tADDED")
+	for _, e := range ks.Entries {
+		key, err := e.key()
+		if err != nil {
+			return err
+		}
+		alg := "-"
+		if v, ok := key.Algorithm(); ok {
+			alg = v.String()
+		}
+		kid := "-"
+		if v, ok := key.KeyID(); ok {
+			kid = v
+		}
+		thumbprint, err := key.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return wrap(ErrParseKey, err.Error())
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			e.Name, key.KeyType(), alg, kid,
+			base64.RawURLEncoding.EncodeToString(thumbprint), e.Added.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func newKeystoreExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export NAME",
+		Short: "Export a key from the keystore as JWK",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runKeystoreExport,
+	}
+	cmd.Flags().BoolP("public-key", "p", false, "export the public key instead of the private key")
+	cmd.Flags().StringP("output", "o", "-", "output to file")
+	return cmd
+}
+
+func runKeystoreExport(cmd *cobra.Command, args []string) error {
+	opts, err := newKeystoreOptions(cmd)
+	if err != nil {
+		return err
+	}
+	name, err := keystoreName(args)
+	if err != nil {
+		return err
+	}
+	public, err := cmd.Flags().GetBool("public-key")
+	if err != nil {
+		return err
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	return opts.export(name, public, output)
+}
+
+func (o *keystoreOptions) export(name string, public bool, path string) (err error) {
+	ks, err := openKeystore(o.Path, o.Password)
+	if err != nil {
+		return err
+	}
+	entry := ks.lookup(name)
+	if entry == nil {
+		return wrap(ErrKeystoreEntryNotFound, name)
+	}
+	key, err := entry.key()
+	if err != nil {
+		return err
+	}
+	if public {
+		if key.KeyType() == jwa.OctetSeq() {
+			return ErrPublicKeyForOct
+		}
+		if key, err = jwk.PublicKeyOf(key); err != nil {
+			return wrap(ErrGeneratePublicKey, err.Error())
+		}
+	}
+
+	output, err := openOutputFile(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := output.Close(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}()
+	return writeJSON(output, key)
+}
+
+func newKeystoreDeleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "delete NAME",
+		Aliases: []string{"rm"},
+		Short:   "Delete a key from the keystore",
+		Args:    cobra.ExactArgs(1),
+		RunE:    runKeystoreDelete,
+	}
+}
+
+func runKeystoreDelete(cmd *cobra.Command, args []string) error {
+	opts, err := newKeystoreOptions(cmd)
+	if err != nil {
+		return err
+	}
+	name, err := keystoreName(args)
+	if err != nil {
+		return err
+	}
+	return opts.delete(name)
+}
+
+func (o *keystoreOptions) delete(name string) error {
+	ks, err := openKeystore(o.Path, o.Password)
+	if err != nil {
+		return err
+	}
+	if !ks.remove(name) {
+		return wrap(ErrKeystoreEntryNotFound, name)
+	}
+	return ks.save(o.Path, o.Password)
+}
@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// newTestKeystore creates an empty keystore in a temporary directory and
+// returns its options.
+func newTestKeystore(t *testing.T) *keystoreOptions {
+	t.Helper()
+	o := &keystoreOptions{
+		Path:     filepath.Join(t.TempDir(), "jose", "keystore.jwe"),
+		Password: []byte("correct horse battery staple"),
+	}
+	if err := o.init(false); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	return o
+}
+
+// keyOf reads the single key in a JWK file.
+func keyOf(t *testing.T, path string) jwk.Key {
+	t.Helper()
+	set, err := getKeyFile(path, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := set.Key(0)
+	return key
+}
+
+func TestKeystoreAddListExportDelete(t *testing.T) {
+	t.Parallel()
+
+	o := newTestKeystore(t)
+	ecPath := genKey(t, "EC", "P-256", 2048, "json", false)
+	if err := o.add("signer", keyOf(t, ecPath), false); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+	if err := o.add("secret", keyOf(t, genKey(t, "oct", "", 256, "json", false)), false); err != nil {
+		t.Fatalf("add: %v", err)
+	}
+
+	var list bytes.Buffer
+	if err := o.list(&list); err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	for _, want := range []string{"NAME", "signer", "EC", "secret", "oct"} {
+		if !strings.Contains(list.String(), want) {
+			t.Errorf("list output missing %q:\n%s", want, list.String())
+		}
+	}
+
+	out := filepath.Join(t.TempDir(), "pub.jwk")
+	if err := o.export("signer", true, out); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	pub := keyOf(t, out)
+	if _, ok := pub.(jwk.ECDSAPublicKey); !ok {
+		t.Errorf("export --public-key produced %T", pub)
+	}
+	if err := o.export("secret", true, out); !errors.Is(err, ErrPublicKeyForOct) {
+		t.Errorf("want ErrPublicKeyForOct, got %v", err)
+	}
+
+	if err := o.delete("signer"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := o.export("signer", false, out); !errors.Is(err, ErrKeystoreEntryNotFound) {
+		t.Errorf("want ErrKeystoreEntryNotFound after delete, got %v", err)
+	}
+	if err := o.delete("signer"); !errors.Is(err, ErrKeystoreEntryNotFound) {
+		t.Errorf("want ErrKeystoreEntryNotFound, got %v", err)
+	}
+}
+
+func TestKeystoreAddExistingNeedsForce(t *testing.T) {
+	t.Parallel()
+
+	o := newTestKeystore(t)
+	key := keyOf(t, genKey(t, "OKP", "Ed25519", 2048, "json", false))
+	if err := o.add("k", key, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.add("k", key, false); !errors.Is(err, ErrKeystoreEntryExists) {
+		t.Errorf("want ErrKeystoreEntryExists, got %v", err)
+	}
+	if err := o.add("k", key, true); err != nil {
+		t.Errorf("add --force: %v", err)
+	}
+}
+
+func TestKeystoreInitRefusesOverwrite(t *testing.T) {
+	t.Parallel()
+
+	o := newTestKeystore(t)
+	if err := o.init(false); !errors.Is(err, ErrKeystoreExists) {
+		t.Errorf("want ErrKeystoreExists, got %v", err)
+	}
+	if err := o.init(true); err != nil {
+		t.Errorf("init --force: %v", err)
+	}
+}
+
+func TestKeystoreWrongPassword(t *testing.T) {
+	t.Parallel()
+
+	o := newTestKeystore(t)
+	wrong := &keystoreOptions{Path: o.Path, Password: []byte("wrong")}
+	if err := wrong.list(&bytes.Buffer{}); !errors.Is(err, ErrOpenKeystore) {
+		t.Errorf("want ErrOpenKeystore, got %v", err)
+	}
+}
+
+func TestKeystoreMissing(t *testing.T) {
+	t.Parallel()
+
+	o := &keystoreOptions{Path: filepath.Join(t.TempDir(), "none.jwe"), Password: []byte("pw")}
+	if err := o.list(&bytes.Buffer{}); !errors.Is(err, ErrKeystoreNotFound) {
+		t.Errorf("want ErrKeystoreNotFound, got %v", err)
+	}
+}
+
+func TestKeystorePasswordSources(t *testing.T) {
+	t.Setenv(keystorePasswordEnv, "")
+
+	if _, err := keystorePassword(""); !errors.Is(err, ErrKeystorePassword) {
+		t.Errorf("want ErrKeystorePassword, got %v", err)
+	}
+
+	pwFile := writeFile(t, "pw", "from-file\n")
+	got, err := keystorePassword(pwFile)
+	if err != nil || string(got) != "from-file" {
+		t.Errorf("password file: got %q, %v", got, err)
+	}
+
+	t.Setenv(keystorePasswordEnv, "from-env")
+	got, err = keystorePassword("")
+	if err != nil || string(got) != "from-env" {
+		t.Errorf("password env: got %q, %v", got, err)
+	}
+}
+
+// TestKeystoreReferenceSignsAndVerifies checks that "keystore:<name>" works as
+// --key for jws sign and verify.
+func TestKeystoreReferenceSignsAndVerifies(t *testing.T) {
+	o := newTestKeystore(t)
+	t.Setenv(keystorePathEnv, o.Path)
+	t.Setenv(keystorePasswordEnv, string(o.Password))
+
+	if err := o.add("signer", keyOf(t, genKey(t, "EC", "P-256", 2048, "json", false)), false); err != nil {
+		t.Fatal(err)
+	}
+
+	payloadPath := writeFile(t, "payload.txt", "from the keystore")
+	jwsMessage := signWith(t, "keystore:signer", "ES256", payloadPath, "")
+
+	keyset, err := getKeyFile("keystore:signer", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := &jwsVerifier{Algorithm: "ES256"}
+	var buf bytes.Buffer
+	if err := verifier.writeVerifyResult(&buf, []byte(jwsMessage), keyset); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if buf.String() != "from the keystore" {
+		t.Errorf("payload mismatch: %q", buf.String())
+	}
+
+	if _, err := getKeyFile("keystore:missing", "json"); !errors.Is(err, ErrKeystoreEntryNotFound) {
+		t.Errorf("want ErrKeystoreEntryNotFound, got %v", err)
+	}
+	if _, err := getKeyFile("keystore:../etc", "json"); !errors.Is(err, ErrKeystoreEntryName) {
+		t.Errorf("want ErrKeystoreEntryName, got %v", err)
+	}
+}
+
+func TestCLIKeystoreFlow(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "ks.jwe")
+	pw := filepath.Join(dir, "pw")
+	if err := os.WriteFile(pw, []byte("s3cret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := genKey(t, "RSA", "", 2048, "json", false)
+
+	if _, code := runCLI(t, "keystore", "init", "--keystore", store, "--password-file", pw); code != 0 {
+		t.Fatalf("init exit = %d", code)
+	}
+	if _, code := runCLI(t, "keystore", "add", "rsa", "--key", keyPath, "--keystore", store, "--password-file", pw); code != 0 {
+		t.Fatalf("add exit = %d", code)
+	}
+	out, code := runCLI(t, "keystore", "list", "--keystore", store, "--password-file", pw)
+	if code != 0 || !strings.Contains(out, "rsa") || !strings.Contains(out, "RSA") {
+		t.Fatalf("list exit = %d, out = %s", code, out)
+	}
+	out, code = runCLI(t, "keystore", "export", "rsa", "--keystore", store, "--password-file", pw)
+	if code != 0 || !strings.Contains(out, `"d"`) {
+		t.Fatalf("export exit = %d, out = %s", code, out)
+	}
+	if _, code := runCLI(t, "keystore", "delete", "rsa", "--keystore", store, "--password-file", pw); code != 0 {
+		t.Fatalf("delete exit = %d", code)
+	}
+	if _, code := runCLI(t, "keystore", "export", "rsa", "--keystore", store, "--password-file", pw); code != 1 {
+		t.Errorf("export after delete exit = %d", code)
+	}
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/circl/dh/x448"
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	"github.com/lestrrat-go/jwx/v4/jwe/jwebb"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/lestrrat-go/jwx/v4/jws/jwsbb"
+)
+
+// This file plugs the Ed448 and X448 curves into jwx. The Go standard library
+// implements neither, so the arithmetic comes from cloudflare/circl and jwx
+// reaches it through its extension points:
+//
+//   - raw key importers and exporters, so OKP JWKs with "crv":"Ed448" or
+//     "crv":"X448" convert to and from circl keys;
+//   - an "EdDSA" signer and verifier that handle Ed448 keys and hand every
+//     other key to jwx's built-in Ed25519 implementation;
+//   - the ECDH-ES key generator and deriver interfaces on the X448 key types.
+
+// x448PublicKey and x448PrivateKey give X448 keys distinct Go types: circl uses
+// the same x448.Key array for both halves, which jwk could not tell apart.
+type x448PublicKey x448.Key
+
+type x448PrivateKey struct {
+	d x448.Key
+	x x448.Key
+}
+
+func init() {
+	if err := jwa.RegisterEllipticCurveAlgorithm(jwa.NewEllipticCurveAlgorithm("Ed448")); err != nil {
+		panic(err)
+	}
+	for _, err := range []error{
+		jwk.RegisterKeyImporter(jwk.KeyImportFunc[ed448.PrivateKey](func(k ed448.PrivateKey) (jwk.Key, error) {
+			return importOKP448("Ed448", k.Public().(ed448.PublicKey), k.Seed())
+		})),
+		jwk.RegisterKeyImporter(jwk.KeyImportFunc[ed448.PublicKey](func(k ed448.PublicKey) (jwk.Key, error) {
+			return importOKP448("Ed448", k, nil)
+		})),
+		jwk.RegisterKeyImporter(jwk.KeyImportFunc[*x448PrivateKey](func(k *x448PrivateKey) (jwk.Key, error) {
+			return importOKP448("X448", k.x[:], k.d[:])
+		})),
+		jwk.RegisterKeyImporter(jwk.KeyImportFunc[x448PublicKey](func(k x448PublicKey) (jwk.Key, error) {
+			return importOKP448("X448", k[:], nil)
+		})),
+		jwk.RegisterKeyExporter("OKP:Ed448", jwk.KeyExportFunc(exportEd448)),
+		jwk.RegisterKeyExporter("OKP:X448", jwk.KeyExportFunc(exportX448)),
+		jws.RegisterSigner(jwa.EdDSA(), jws.SignerFunc(signEdDSA)),
+		jws.RegisterVerifier(jwa.EdDSA(), jws.VerifierFunc(verifyEdDSA)),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// importOKP448 builds an OKP JWK from its curve name and raw members. d is nil
+// for public keys.
+func importOKP448(crv string, x, d []byte) (jwk.Key, error) {
+	members := map[string]string{
+		"kty": jwa.OKP().String(),
+		"crv": crv,
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+	}
+	if d != nil {
+		members["d"] = base64.RawURLEncoding.EncodeToString(d)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return nil, err
+	}
+	return jwk.ParseKey(data)
+}
+
+// okpMembers returns the "x" member of an OKP key and, for private keys, "d".
+func okpMembers(key jwk.Key) (x, d []byte, err error) {
+	switch k := key.(type) {
+	case jwk.OKPPrivateKey:
+		x, _ = k.X()
+		d, _ = k.D()
+	case jwk.OKPPublicKey:
+		x, _ = k.X()
+	default:
+		return nil, nil, jwk.ContinueError()
+	}
+	return x, d, nil
+}
+
+func exportEd448(key jwk.Key, _ any) (any, error) {
+	x, d, err := okpMembers(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != ed448.PublicKeySize {
+		return nil, errors.New("ed448: wrong public key size")
+	}
+	if d == nil {
+		return ed448.PublicKey(x), nil
+	}
+	if len(d) != ed448.SeedSize {
+		return nil, errors.New("ed448: wrong private key size")
+	}
+	priv := ed448.NewKeyFromSeed(d)
+	if !bytes.Equal(priv.Public().(ed448.PublicKey), x) {
+		return nil, errors.New("ed448: invalid x value given d value")
+	}
+	return priv, nil
+}
+
+func exportX448(key jwk.Key, _ any) (any, error) {
+	x, d, err := okpMembers(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) != x448.Size {
+		return nil, errors.New("x448: wrong public key size")
+	}
+	if d == nil {
+		return x448PublicKey(x), nil
+	}
+	if len(d) != x448.Size {
+		return nil, errors.New("x448: wrong private key size")
+	}
+	priv := &x448PrivateKey{d: x448.Key(d)}
+	x448.KeyGen(&priv.x, &priv.d)
+	if !bytes.Equal(priv.x[:], x) {
+		return nil, errors.New("x448: invalid x value given d value")
+	}
+	return priv, nil
+}
+
+// generateX448 returns a fresh X448 private key.
+func generateX448() (*x448PrivateKey, error) {
+	priv := &x448PrivateKey{}
+	if _, err := rand.Read(priv.d[:]); err != nil {
+		return nil, err
+	}
+	x448.KeyGen(&priv.x, &priv.d)
+	return priv, nil
+}
+
+// rawEd448Key returns the Ed448 key behind key, which jws hands over either
+// as a JWK or as a raw key. ok is false for keys of any other curve.
+func rawEd448Key(key any) (raw any, ok bool, err error) {
+	if k, isJWK := key.(jwk.Key); isJWK {
+		if crv, _ := okpCurveOf(k); crv != "Ed448" {
+			return nil, false, nil
+		}
+		raw, err := jwk.Export[any](k)
+		return raw, true, err
+	}
+	switch key.(type) {
+	case ed448.PrivateKey, ed448.PublicKey:
+		return key, true, nil
+	}
+	return nil, false, nil
+}
+
+// okpCurveOf returns the "crv" member of an OKP key.
+func okpCurveOf(key jwk.Key) (string, bool) {
+	c, ok := key.(interface {
+		Crv() (jwa.EllipticCurveAlgorithm, bool)
+	})
+	if !ok || key.KeyType() != jwa.OKP() {
+		return "", false
+	}
+	crv, ok := c.Crv()
+	return crv.String(), ok
+}
+
+// signEdDSA signs with Ed448 keys and leaves Ed25519 keys to jwx.
+func signEdDSA(key any, payload []byte) ([]byte, error) {
+	raw, ok, err := rawEd448Key(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return jwsbb.Sign(key, jwa.EdDSA().String(), payload, nil)
+	}
+	priv, ok := raw.(ed448.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("ed448: signing needs a private key, got %T", raw)
+	}
+	return ed448.Sign(priv, payload, ""), nil
+}
+
+// verifyEdDSA verifies with Ed448 keys and leaves Ed25519 keys to jwx.
+func verifyEdDSA(key any, payload, signature []byte) error {
+	raw, ok, err := rawEd448Key(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return jwsbb.Verify(key, jwa.EdDSA().String(), payload, signature)
+	}
+	var pub ed448.PublicKey
+	switch k := raw.(type) {
+	case ed448.PublicKey:
+		pub = k
+	case ed448.PrivateKey:
+		pub = k.Public().(ed448.PublicKey)
+	}
+	if !ed448.Verify(pub, payload, signature, "") {
+		return errors.New("ed448: invalid signature")
+	}
+	return nil
+}
+
+// GenerateECDHES implements jwebb.ECDHESKeyGenerator: it agrees on a key with
+// a fresh ephemeral X448 key pair.
+func (pub x448PublicKey) GenerateECDHES(alg string, keysize int, apu, apv []byte) ([]byte, any, error) {
+	ephemeral, err := generateX448()
+	if err != nil {
+		return nil, nil, err
+	}
+	derived, err := ephemeral.DeriveECDHES(alg, keysize, pub, apu, apv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return derived, x448PublicKey(ephemeral.x), nil
+}
+
+// DeriveECDHES implements jwebb.ECDHESKeyDeriver for the recipient side.
+func (priv *x448PrivateKey) DeriveECDHES(alg string, keysize int, ephemeralPubKey any, apu, apv []byte) ([]byte, error) {
+	epk, ok := ephemeralPubKey.(x448PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("x448: ephemeral key must be an X448 public key, got %T", ephemeralPubKey)
+	}
+	var shared x448.Key
+	peer := x448.Key(epk)
+	if !x448.Shared(&shared, &priv.d, &peer) {
+		return nil, errors.New("x448: shared secret is zero (low order ephemeral key)")
+	}
+	return jwebb.DeriveECDHESRaw(alg, shared[:], apu, apv, keysize)
+}
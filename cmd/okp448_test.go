@@ -0,0 +1,221 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/lestrrat-go/jwx/v4/jwe/jwebb"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+// unhex decodes a hex test vector.
+func unhex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// okpJWK parses an OKP JWK of curve crv from raw x and, if not nil, d.
+func okpJWK(t *testing.T, crv string, x, d []byte) jwk.Key {
+	t.Helper()
+	data := `{"kty":"OKP","crv":"` + crv + `","x":"` + base64.RawURLEncoding.EncodeToString(x) + `"`
+	if d != nil {
+		data += `,"d":"` + base64.RawURLEncoding.EncodeToString(d) + `"`
+	}
+	key, err := jwk.ParseKey([]byte(data + "}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// TestEd448RFC8032Vector checks the Ed448 JWK conversion and the signature
+// against the "1 octet" test vector of RFC 8032, section 7.4.
+func TestEd448RFC8032Vector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		secret    = unhex(t, "c4eab05d357007c632f3dbb48489924d552b08fe0c353a0d4a1f00acda2c463afbea67c5e8d2877c5e3bc397a659949ef8021e954e0a12274e")
+		public    = unhex(t, "43ba28f430cdff456ae531545f7ecd0ac834a55d9358c0372bfa0c6c6798c0866aea01eb00742802b8438ea4cb82169c235160627b4c3a9480")
+		message   = []byte{0x03}
+		signature = unhex(t, "26b8f91727bd62897af15e41eb43c377efb9c610d48f2335cb0bd0087810f4352541b143c4b981b7e18f62de8ccdf633fc1bf037ab7cd779805e0dbcc0aae1cbcee1afb2e027df36bc04dcecbf154336c19f0af7e0a6472905e799f1953d2a0ff3348ab21aa4adafd1d234441cf807c03a00")
+	)
+
+	key := okpJWK(t, "Ed448", public, secret)
+	raw, err := jwk.Export[any](key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, ok := raw.(ed448.PrivateKey)
+	if !ok || !bytes.Equal(priv.Seed(), secret) || !bytes.Equal(priv.Public().(ed448.PublicKey), public) {
+		t.Fatalf("export gave %T %x", raw, raw)
+	}
+
+	imported, err := jwk.Import[jwk.Key](priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, d, err := okpMembers(imported)
+	if err != nil || !bytes.Equal(x, public) || !bytes.Equal(d, secret) {
+		t.Errorf("import gave x=%x d=%x, %v", x, d, err)
+	}
+	if crv, _ := okpCurveOf(imported); crv != "Ed448" {
+		t.Errorf("import gave crv %q", crv)
+	}
+
+	got, err := signEdDSA(key, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, signature) {
+		t.Errorf("signature = %x, want %x", got, signature)
+	}
+	if err := verifyEdDSA(okpJWK(t, "Ed448", public, nil), message, signature); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+	if err := verifyEdDSA(okpJWK(t, "Ed448", public, nil), []byte{0x04}, signature); err == nil {
+		t.Error("verify of another message succeeded")
+	}
+}
+
+// TestX448RFC7748Vector checks the X448 JWK conversion and the shared secret
+// against the Diffie-Hellman test vector of RFC 7748, section 6.2.
+func TestX448RFC7748Vector(t *testing.T) {
+	t.Parallel()
+
+	var (
+		alicePrivate = unhex(t, "9a8f4925d1519f5775cf46b04b5800d4ee9ee8bae8bc5565d498c28dd9c9baf574a9419744897391006382a6f127ab1d9ac2d8c0a598726b")
+		alicePublic  = unhex(t, "9b08f7cc31b7e3e67d22d5aea121074a273bd2b83de09c63faa73d2c22c5d9bbc836647241d953d40c5b12da88120d53177f80e532c41fa0")
+		bobPrivate   = unhex(t, "1c306a7ac2a0e2e0990b294470cba339e6453772b075811d8fad0d1d6927c120bb5ee8972b0d3e21374c9c921b09d1b0366f10b65173992d")
+		bobPublic    = unhex(t, "3eb7a829b0cd20f5bcfc0b599b6feccf6da4627107bdb0d4f345b43027d8b972fc3e34fb4232a13ca706dcb57aec3dae07bdc1c67bf33609")
+		shared       = unhex(t, "07fff4181ac6cc95ec1c16a94a0f74d12da232ce40a77552281d282bb60c0b56fd2464c335543936521c24403085d59a449a5037514a879d")
+	)
+
+	// The ECDH-ES key derived from the RFC's shared secret; the deriver has to
+	// arrive at the same bytes from either side.
+	want, err := jwebb.DeriveECDHESRaw("A256GCM", shared, nil, nil, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name            string
+		private, public []byte
+		peer            []byte
+	}{
+		{"alice", alicePrivate, alicePublic, bobPublic},
+		{"bob", bobPrivate, bobPublic, alicePublic},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw, err := jwk.Export[any](okpJWK(t, "X448", tt.public, tt.private))
+			if err != nil {
+				t.Fatal(err)
+			}
+			priv, ok := raw.(*x448PrivateKey)
+			if !ok || !bytes.Equal(priv.x[:], tt.public) {
+				t.Fatalf("export gave %T %v", raw, raw)
+			}
+			imported, err := jwk.Import[jwk.Key](priv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if x, d, err := okpMembers(imported); err != nil || !bytes.Equal(x, tt.public) || !bytes.Equal(d, tt.private) {
+				t.Errorf("import gave x=%x d=%x, %v", x, d, err)
+			}
+
+			rawPeer, err := jwk.Export[any](okpJWK(t, "X448", tt.peer, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			peer, ok := rawPeer.(x448PublicKey)
+			if !ok {
+				t.Fatalf("export of the public key gave %T", rawPeer)
+			}
+			got, err := priv.DeriveECDHES("A256GCM", 32, peer, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("derived key = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestEd448SignVerify(t *testing.T) {
+	t.Parallel()
+
+	privPath := genKey(t, "OKP", "Ed448", 0, "json", false)
+	key := keyOf(t, privPath)
+	if crv, _ := okpCurveOf(key); crv != "Ed448" {
+		t.Fatalf("crv = %q, want Ed448", crv)
+	}
+	raw, err := jwk.Export[any](key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw.(ed448.PrivateKey); !ok {
+		t.Fatalf("export gave %T, want ed448.PrivateKey", raw)
+	}
+
+	payloadPath := writeFile(t, "payload.txt", "Ed448 payload")
+	jwsMessage := signWith(t, privPath, "EdDSA", payloadPath, "")
+
+	pubset, err := getKeyFile(genKeyPublicOf(t, privPath), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&jwsVerifier{Algorithm: "EdDSA"}).writeVerifyResult(&buf, []byte(jwsMessage), pubset); err != nil {
+		t.Fatalf("verify with public key: %v", err)
+	}
+	if buf.String() != "Ed448 payload" {
+		t.Errorf("payload mismatch: %q", buf.String())
+	}
+
+	// Another Ed448 key and an Ed25519 key must both reject the signature.
+	for _, curve := range []string{"Ed448", "Ed25519"} {
+		other, err := getKeyFile(genKey(t, "OKP", curve, 0, "json", false), "json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := (&jwsVerifier{Algorithm: "EdDSA"}).writeVerifyResult(&bytes.Buffer{}, []byte(jwsMessage), other); !errors.Is(err, ErrVerifyJWSMessage) {
+			t.Errorf("%s: want ErrVerifyJWSMessage, got %v", curve, err)
+		}
+	}
+}
+
+func TestX448EncryptDecrypt(t *testing.T) {
+	t.Parallel()
+
+	for _, keyEnc := range []string{"ECDH-ES", "ECDH-ES+A256KW"} {
+		t.Run(keyEnc, func(t *testing.T) {
+			t.Parallel()
+
+			privPath := genKey(t, "OKP", "X448", 0, "json", false)
+			payloadPath := writeFile(t, "payload.txt", "X448 secret")
+
+			jweMessage := encryptWith(t, genKeyPublicOf(t, privPath), keyEnc, "A256GCM", payloadPath, false)
+			got, err := decryptWith(t, privPath, jweMessage)
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+			if got != "X448 secret" {
+				t.Errorf("round-trip mismatch: %q", got)
+			}
+
+			other := genKey(t, "OKP", "X448", 0, "json", false)
+			if _, err := decryptWith(t, other, jweMessage); err == nil {
+				t.Error("decrypt with another X448 key succeeded")
+			}
+		})
+	}
+}
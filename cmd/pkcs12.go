@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/lestrrat-go/jwx/v4/cert"
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// parsePKCS12 reads a PKCS#12 (.p12/.pfx) bundle into a key set. A bundle
+// with a private key yields that key, carrying its certificate chain as "x5c"
+// (end-entity certificate first). A trust store that holds only certificates
+// yields the public key of each certificate, so it can still be used to
+// verify or encrypt.
+func parsePKCS12(data []byte, password string) (jwk.Set, error) {
+	priv, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err == nil {
+		key, err := importWithChain(priv, append([]*x509.Certificate{leaf}, caCerts...))
+		if err != nil {
+			return nil, err
+		}
+		return keySetOf(key)
+	}
+
+	certs, trustErr := pkcs12.DecodeTrustStore(data, password)
+	if trustErr != nil || len(certs) == 0 {
+		// Report the private key error: it is what most users expect to load.
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	set := jwk.NewSet()
+	for _, c := range certs {
+		key, err := importWithChain(c.PublicKey, []*x509.Certificate{c})
+		if err != nil {
+			return nil, err
+		}
+		if err := set.AddKey(key); err != nil {
+			return nil, wrap(ErrParseKey, err.Error())
+		}
+	}
+	return set, nil
+}
+
+// importWithChain converts a raw Go key into a JWK and attaches chain as its
+// "x5c" member.
+func importWithChain(raw any, chain []*x509.Certificate) (jwk.Key, error) {
+	key, err := jwk.Import[jwk.Key](raw)
+	if err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	if err := setCertificateChain(key, chain); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// setCertificateChain stores chain (end entity first) as the "x5c" member of
+// key. An empty chain leaves the key untouched.
+func setCertificateChain(key jwk.Key, chain []*x509.Certificate) error {
+	if len(chain) == 0 {
+		return nil
+	}
+
+	var x5c cert.Chain
+	for _, c := range chain {
+		encoded, err := cert.EncodeBase64(c.Raw)
+		if err != nil {
+			return wrap(ErrParseCertificate, err.Error())
+		}
+		if err := x5c.Add(encoded); err != nil {
+			return wrap(ErrParseCertificate, err.Error())
+		}
+	}
+	if err := key.Set(jwk.X509CertChainKey, &x5c); err != nil {
+		return wrap(ErrParseCertificate, err.Error())
+	}
+	return nil
+}
+
+// keySetOf returns a key set holding only key.
+func keySetOf(key jwk.Key) (jwk.Set, error) {
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return nil, wrap(ErrParseKey, err.Error())
+	}
+	return set, nil
+}
+
+// certificateChainOf returns the certificates in the "x5c" member of key, end
+// entity first. A key without "x5c" returns an empty chain.
+func certificateChainOf(key jwk.Key) ([]*x509.Certificate, error) {
+	x5c, ok := key.X509CertChain()
+	if !ok {
+		return nil, nil
+	}
+	return parseCertificateChain(x5c)
+}
+
+// parseCertificateChain parses the base64 DER certificates of an "x5c" chain.
+func parseCertificateChain(x5c *cert.Chain) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, x5c.Len())
+	for i := range x5c.Len() {
+		encoded, _ := x5c.Get(i)
+		c, err := cert.Parse(encoded)
+		if err != nil {
+			return nil, wrap(ErrParseCertificate, err.Error())
+		}
+		certs = append(certs, c)
+	}
+	return certs, nil
+}
+
+// readCertificates reads the PEM CERTIFICATE blocks in path, end entity first.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // certificate path is supplied by the user on purpose
+	if err != nil {
+		return nil, wrap(ErrOpenFile, err.Error())
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, wrap(ErrParseCertificate, err.Error())
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, wrap(ErrParseCertificate, "no PEM CERTIFICATE block in "+path)
+	}
+	return certs, nil
+}
+
+// encodePKCS12 writes a private JWK and its certificate chain (end entity
+// first) as a PKCS#12 bundle protected by password. The end-entity
+// certificate must belong to the key.
+func encodePKCS12(key jwk.Key, chain []*x509.Certificate, password string) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, ErrRequireCertificate
+	}
+
+	priv, err := jwk.Export[any](key)
+	if err != nil {
+		return nil, wrap(ErrEncodePKCS12, err.Error())
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, wrap(ErrEncodePKCS12, fmt.Sprintf("%T is not a private key", priv))
+	}
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(chain[0].PublicKey) {
+		return nil, ErrCertificateKeyMismatch
+	}
+
+	data, err := pkcs12.Modern.Encode(priv, chain[0], chain[1:], password)
+	if err != nil {
+		return nil, wrap(ErrEncodePKCS12, err.Error())
+	}
+	return data, nil
+}
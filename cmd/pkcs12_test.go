@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// selfSignedCert issues a self-signed certificate for priv.
+func selfSignedCert(t *testing.T, priv crypto.Signer) *x509.Certificate {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "jose test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, priv.Public(), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// p12File writes an EC key and its self-signed certificate as a PKCS#12
+// bundle protected by password, returning the path and the certificate.
+func p12File(t *testing.T, password string) (string, *x509.Certificate) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := selfSignedCert(t, priv)
+	data, err := pkcs12.Modern.Encode(priv, c, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.p12")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, c
+}
+
+func TestPKCS12SignVerifyWithX5C(t *testing.T) {
+	t.Parallel()
+
+	path, c := p12File(t, "changeit")
+	pwFile := writeFile(t, "pw", "changeit\n")
+
+	keyset, err := keySource{Path: path, Format: "p12", PasswordFile: pwFile}.load()
+	if err != nil {
+		t.Fatalf("load p12: %v", err)
+	}
+	key, _ := keyset.Key(0)
+	chain, err := certificateChainOf(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 1 || !chain[0].Equal(c) {
+		t.Fatalf("x5c does not hold the bundle certificate: %v", chain)
+	}
+
+	payloadPath := writeFile(t, "payload.txt", "p12 signed")
+	out := filepath.Join(t.TempDir(), "out.jws")
+	s := &jwsSigner{
+		Algorithms:      []string{"ES256"},
+		Keys:            []string{path},
+		KeyFormat:       "p12",
+		KeyPasswordFile: pwFile,
+		InputFilePath:   payloadPath,
+		Output:          out,
+	}
+	if err := s.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.signer(); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	jwsMessage, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &jwsVerifier{Algorithm: "ES256"}
+	var buf bytes.Buffer
+	if err := verifier.writeVerifyResult(&buf, jwsMessage, keyset); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if buf.String() != "p12 signed" {
+		t.Errorf("payload mismatch: %q", buf.String())
+	}
+}
+
+func TestPKCS12WrongPassword(t *testing.T) {
+	t.Parallel()
+
+	path, _ := p12File(t, "changeit")
+	pwFile := writeFile(t, "pw", "wrong")
+	if _, err := (keySource{Path: path, Format: "p12", PasswordFile: pwFile}).load(); !errors.Is(err, ErrParseKey) {
+		t.Errorf("want ErrParseKey, got %v", err)
+	}
+}
+
+func TestPKCS12TrustStoreYieldsPublicKeys(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{selfSignedCert(t, priv)}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "trust.p12")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty password file stands for the empty password.
+	keyset, err := keySource{Path: path, Format: "p12", PasswordFile: writeFile(t, "pw", "")}.load()
+	if err != nil {
+		t.Fatalf("load trust store: %v", err)
+	}
+	key, _ := keyset.Key(0)
+	if _, ok := key.(jwk.ECDSAPublicKey); !ok {
+		t.Errorf("trust store entry should be a public key, got %T", key)
+	}
+}
+
+func TestJWKExportPKCS12RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	priv, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.Import[jwk.Key](priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keyJSON bytes.Buffer
+	if err := writeJSON(&keyJSON, key); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := writeFile(t, "key.jwk", keyJSON.String())
+	certPath := writeFile(t, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: selfSignedCert(t, priv).Raw})))
+	pwFile := writeFile(t, "pw", "export-pw")
+
+	out := filepath.Join(t.TempDir(), "out.p12")
+	e := &jwkExporter{
+		Key:                keyPath,
+		KeyFormat:          "json",
+		Cert:               certPath,
+		OutputFormat:       "p12",
+		OutputPasswordFile: pwFile,
+		Output:             out,
+	}
+	if err := e.valid(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.export(); err != nil {
+		t.Fatalf("export p12: %v", err)
+	}
+
+	keyset, err := keySource{Path: out, Format: "p12", PasswordFile: pwFile}.load()
+	if err != nil {
+		t.Fatalf("reload p12: %v", err)
+	}
+	got, _ := keyset.Key(0)
+	want, _ := key.Thumbprint(crypto.SHA256)
+	have, _ := got.Thumbprint(crypto.SHA256)
+	if !bytes.Equal(want, have) {
+		t.Error("p12 round trip changed the key")
+	}
+
+	// Back to JWK: the certificate survives as x5c.
+	jsonOut := filepath.Join(t.TempDir(), "out.jwk")
+	e = &jwkExporter{Key: out, KeyFormat: "p12", KeyPasswordFile: pwFile, OutputFormat: "json", Output: jsonOut}
+	if err := e.export(); err != nil {
+		t.Fatalf("export json: %v", err)
+	}
+	back := keyOf(t, jsonOut)
+	if _, ok := back.X509CertChain(); !ok {
+		t.Error("json export of a p12 key lost x5c")
+	}
+}
+
+func TestJWKExportPKCS12Errors(t *testing.T) {
+	t.Parallel()
+
+	keyPath := genKey(t, "EC", "P-256", 2048, "json", false)
+	out := filepath.Join(t.TempDir(), "out.p12")
+
+	e := &jwkExporter{Key: keyPath, KeyFormat: "json", OutputFormat: "p12", Output: out}
+	if err := e.export(); !errors.Is(err, ErrRequireCertificate) {
+		t.Errorf("want ErrRequireCertificate, got %v", err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPath := writeFile(t, "cert.pem", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: selfSignedCert(t, other).Raw})))
+	e.Cert = certPath
+	if err := e.export(); !errors.Is(err, ErrCertificateKeyMismatch) {
+		t.Errorf("want ErrCertificateKeyMismatch, got %v", err)
+	}
+
+	e = &jwkExporter{Key: keyPath, KeyFormat: "json", OutputFormat: "p12", PublicKey: true}
+	if err := e.valid(); !errors.Is(err, ErrPublicKeyForP12) {
+		t.Errorf("want ErrPublicKeyForP12, got %v", err)
+	}
+	e = &jwkExporter{Key: keyPath, KeyFormat: "json", OutputFormat: "der"}
+	if err := e.valid(); !errors.Is(err, ErrInvalidKeyFormat) {
+		t.Errorf("want ErrInvalidKeyFormat, got %v", err)
+	}
+}
@@ -20,6 +20,19 @@ func newRootCmd() *cobra.Command {
 	// two never drift apart.
 	cmd.SetVersionTemplate(versionLine() + "\n")
 
+	cmd.PersistentFlags().String("max-input-size", defaultMaxInputSize,
+		"largest payload or message read into memory, e.g. 512KiB, 64MiB, 2GB (0: no limit); streamed detached payloads are not limited")
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, _ []string) error {
+		size, err := cmd.Flags().GetString("max-input-size")
+		if err != nil {
+			return err
+		}
+		if maxInputSize, err = parseByteSize(size); err != nil {
+			return err
+		}
+		return nil
+	}
+
 	cmd.AddCommand(newVersionCmd())
 	cmd.AddCommand(newCompletionCmd())
 	cmd.AddCommand(newJWKCmd())
@@ -28,6 +41,8 @@ func newRootCmd() *cobra.Command {
 	cmd.AddCommand(newJWACmd())
 	cmd.AddCommand(newJWECmd())
 	cmd.AddCommand(newJWSCmd())
+	cmd.AddCommand(newKeystoreCmd())
+	cmd.AddCommand(newJWKSCmd())
 
 	return cmd
 }
@@ -51,7 +51,7 @@ func TestExecute(t *testing.T) {
 			name:         "get elliptic curve types",
 			args:         []string{"jose", "jwa", "--elliptic-curve"},
 			wantExitCode: 0,
-			wantStdOut:   "Ed25519\nP-256\nP-384\nP-521\nX25519",
+			wantStdOut:   "Ed25519\nEd448\nP-256\nP-384\nP-521\nX25519\nX448\nsecp256k1",
 		},
 		{
 			name:         "get key encryption algorithms",
@@ -69,7 +69,7 @@ func TestExecute(t *testing.T) {
 			name:         "get signature algorithms",
 			args:         []string{"jose", "jwa", "--signature"},
 			wantExitCode: 0,
-			wantStdOut:   "ES256\nES384\nES512\nEdDSA\nHS256\nHS384\nHS512\nPS256\nPS384\nPS512\nRS256\nRS384\nRS512",
+			wantStdOut:   "ES256\nES256K\nES384\nES512\nEdDSA\nHS256\nHS384\nHS512\nPS256\nPS384\nPS512\nRS256\nRS384\nRS512",
 		},
 		{
 			name:         "set no options",
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	dsigsecp256k1 "github.com/lestrrat-go/dsig-secp256k1"
+	"github.com/lestrrat-go/jwx/v4/jwa"
+	jwkecdsa "github.com/lestrrat-go/jwx/v4/jwk/ecdsa"
+	"github.com/lestrrat-go/jwx/v4/jws"
+	"github.com/lestrrat-go/jwx/v4/jws/jwsbb"
+)
+
+// This file plugs the secp256k1 curve and the ES256K signature algorithm
+// (RFC 8812) into jwx. jwx moved ES256K out of its core module, so the curve
+// comes from decred's secp256k1 package and the signing from dsig-secp256k1,
+// whose init registers the ECDSA-with-SHA-256 dsig algorithm jws dispatches to.
+
+const (
+	curveSecp256k1 = "secp256k1"
+	algES256K      = "ES256K"
+)
+
+func init() {
+	crv := jwa.NewEllipticCurveAlgorithm(curveSecp256k1)
+	alg := jwa.NewSignatureAlgorithm(algES256K)
+	for _, err := range []error{
+		jwa.RegisterEllipticCurveAlgorithm(crv),
+		jwa.RegisterSignatureAlgorithm(alg),
+		jwkecdsa.RegisterCurve(crv, secp256k1.S256(), jwkecdsa.PointValidatorFunc(validateSecp256k1Point)),
+		jwsbb.RegisterDsigAlgorithm(algES256K, dsigsecp256k1.ECDSAWithSecp256k1AndSHA256),
+		jws.RegisterAlgorithmForKeyType(jwa.EC(), alg),
+		jws.RegisterAlgorithmForCurve(crv, alg),
+	} {
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// validateSecp256k1Point rejects public keys that are not on secp256k1. jwk has
+// already rejected the identity point and coordinates wider than the field.
+func validateSecp256k1Point(x, y *big.Int) error {
+	var fx, fy secp256k1.FieldVal
+	if fx.SetByteSlice(x.Bytes()) || fy.SetByteSlice(y.Bytes()) {
+		return errors.New("secp256k1: coordinate exceeds the field")
+	}
+	if !secp256k1.NewPublicKey(&fx, &fy).IsOnCurve() {
+		return errors.New("secp256k1: point is not on the curve")
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/lestrrat-go/jwx/v4/jwk"
+)
+
+func TestES256KVerifiesWithPublicKeyOnly(t *testing.T) {
+	t.Parallel()
+
+	privPath := genKey(t, "EC", "secp256k1", 0, "json", false)
+	jwsMessage := signWith(t, privPath, "ES256K", writeFile(t, "payload.txt", "secp256k1"), "")
+
+	pubset, err := getKeyFile(genKeyPublicOf(t, privPath), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&jwsVerifier{Algorithm: "ES256K"}).writeVerifyResult(&buf, []byte(jwsMessage), pubset); err != nil {
+		t.Fatalf("verify with public key: %v", err)
+	}
+	if buf.String() != "secp256k1" {
+		t.Errorf("payload mismatch: %q", buf.String())
+	}
+
+	// A P-256 key is not an ES256K key, whatever the signature says.
+	p256, err := getKeyFile(genKey(t, "EC", "P-256", 0, "json", false), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (&jwsVerifier{Algorithm: "ES256K"}).writeVerifyResult(&bytes.Buffer{}, []byte(jwsMessage), p256); !errors.Is(err, ErrKeyAlgorithmMismatch) {
+		t.Errorf("want ErrKeyAlgorithmMismatch, got %v", err)
+	}
+}
+
+func TestSecp256k1RejectsOffCurvePoint(t *testing.T) {
+	t.Parallel()
+
+	one := base64.RawURLEncoding.EncodeToString(big.NewInt(1).FillBytes(make([]byte, 32)))
+	_, err := jwk.ParseKey([]byte(`{"kty":"EC","crv":"secp256k1","x":"` + one + `","y":"` + one + `"}`))
+	if err == nil {
+		t.Fatal("parsed a secp256k1 key whose point is not on the curve")
+	}
+}
@@ -0,0 +1,25 @@
+#!/bin/sh
+# Generates the keytool fixtures of TestJKSKeytoolFixtures. Needs a JDK.
+set -eu
+cd "$(dirname "$0")"
+rm -f keytool.jks keytool.jceks signer.crt
+
+# keytool.jks: PrivateKeyEntry "signer" (entry password entrypw) and
+# trustedCertEntry "ca" holding the signer's certificate.
+keytool -genkeypair -keystore keytool.jks -storetype JKS -storepass storepw \
+	-keypass entrypw -alias signer -keyalg EC -groupname secp256r1 \
+	-dname CN=signer -validity 36500
+keytool -exportcert -keystore keytool.jks -storetype JKS -storepass storepw \
+	-alias signer -file signer.crt
+keytool -importcert -noprompt -keystore keytool.jks -storetype JKS \
+	-storepass storepw -alias ca -file signer.crt
+
+# keytool.jceks: SecretKeyEntry "aes" next to the PrivateKeyEntry "signer".
+keytool -genseckey -keystore keytool.jceks -storetype JCEKS -storepass storepw \
+	-keypass storepw -alias aes -keyalg AES -keysize 256
+keytool -importkeystore -srckeystore keytool.jks -srcstoretype JKS \
+	-srcstorepass storepw -srcalias signer -srckeypass entrypw \
+	-destkeystore keytool.jceks -deststoretype JCEKS -deststorepass storepw \
+	-destkeypass entrypw
+
+rm signer.crt
@@ -283,6 +283,7 @@ JWS_ALGS = [
     ("ES256", "--type EC --curve P-256"),
     ("ES384", "--type EC --curve P-384"),
     ("ES512", "--type EC --curve P-521"),
+    ("ES256K", "--type EC --curve secp256k1"),
     ("RS256", "--type RSA --size 2048"),
     ("RS384", "--type RSA --size 2048"),
     ("RS512", "--type RSA --size 2048"),
@@ -559,6 +560,9 @@ def gen_jwk():
         out.append(jwk_case(f"jwk EC {curve} json public", f"jose jwk generate --type EC --curve {curve} --public-key", ['"kty"', '"EC"'], ['"d"']))
         out.append(jwk_case(f"jwk EC {curve} pem private", f"jose jwk generate --type EC --curve {curve} --output-format pem", ["BEGIN", "PRIVATE KEY"]))
         out.append(jwk_case(f"jwk EC {curve} pem public", f"jose jwk generate --type EC --curve {curve} --public-key --output-format pem", ["BEGIN", "PUBLIC KEY"]))
+    # secp256k1 has no X.509 PEM form, so it is json only.
+    out.append(jwk_case("jwk EC secp256k1 json private", "jose jwk generate --type EC --curve secp256k1", ['"kty"', '"secp256k1"', '"d"']))
+    out.append(jwk_case("jwk EC secp256k1 json public", "jose jwk generate --type EC --curve secp256k1 --public-key", ['"kty"', '"secp256k1"'], ['"d"']))
     # OKP
     out.append(jwk_case("jwk OKP Ed25519 json private", "jose jwk generate --type OKP --curve Ed25519", ['"OKP"', '"d"']))
     out.append(jwk_case("jwk OKP Ed25519 json public", "jose jwk generate --type OKP --curve Ed25519 --public-key", ['"OKP"'], ['"d"']))